@@ -0,0 +1,116 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// amqpConsumer consumes a queue with manual acknowledgements.
+type amqpConsumer struct {
+	conn       *amqp.Connection
+	channel    *amqp.Channel
+	deliveries <-chan amqp.Delivery
+	// requeueCodes are the exit codes of failed batches whose message is requeued,
+	// the messages of other failures are rejected (and dead-lettered if the queue has a dead letter exchange).
+	requeueCodes []int
+	// requeueAll requeues the messages of every failed batch.
+	requeueAll bool
+}
+
+// openAMQP consumes the queue named by the queue query parameter, the path is the virtual host.
+// Query parameters: queue (required), requeue (comma separated exit codes whose message is requeued, e.g. 75,
+// or "all"), the prefetch count is the number of parallel workers.
+func openAMQP(_ context.Context, u *url.URL, opts Options) (Consumer, error) {
+	q := u.Query()
+	queue := q.Get("queue")
+	if queue == "" {
+		return nil, errors.New("amqp url requires the queue parameter (amqp://host:5672/vhost?queue=<queue>)")
+	}
+	consumer := &amqpConsumer{}
+	for _, raw := range strings.Split(q.Get("requeue"), ",") {
+		switch raw = strings.TrimSpace(raw); raw {
+		case "":
+		case "all":
+			consumer.requeueAll = true
+		default:
+			code, err := strconv.Atoi(raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid requeue exit code %q: %w", raw, err)
+			}
+			consumer.requeueCodes = append(consumer.requeueCodes, code)
+		}
+	}
+	server := *u
+	server.RawQuery = ""
+	conn, err := amqp.Dial(server.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to amqp: %w", err)
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, errors.Join(err, conn.Close())
+	}
+	if err := channel.Qos(max(opts.Prefetch, 1), 0, false); err != nil {
+		return nil, errors.Join(err, conn.Close())
+	}
+	deliveries, err := channel.Consume(queue, "executor", false, false, false, false, nil)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to consume queue %s: %w", queue, err), conn.Close())
+	}
+	consumer.conn, consumer.channel, consumer.deliveries = conn, channel, deliveries
+	return consumer, nil
+}
+
+func (c *amqpConsumer) Fetch(ctx context.Context, wait time.Duration) (Message, bool, error) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return Message{}, false, ctx.Err()
+	case <-timer.C:
+		return Message{}, false, nil
+	case d, ok := <-c.deliveries:
+		if !ok {
+			return Message{}, false, errors.New("amqp channel closed")
+		}
+		headers := make(map[string]any, len(d.Headers))
+		for name, value := range d.Headers {
+			headers[name] = value
+		}
+		return Message{
+			Seq:  int64(d.DeliveryTag),
+			Data: d.Body,
+			Vars: map[string]any{
+				"payload":     string(d.Body),
+				"exchange":    d.Exchange,
+				"routingKey":  d.RoutingKey,
+				"headers":     headers,
+				"redelivered": d.Redelivered,
+				"messageID":   d.MessageId,
+			},
+			handle: d,
+		}, true, nil
+	}
+}
+
+func (c *amqpConsumer) Ack(_ context.Context, msg Message) error {
+	return msg.handle.(amqp.Delivery).Ack(false)
+}
+
+// Nak requeues the message if the exit code is one of the requeue codes, otherwise it is rejected.
+func (c *amqpConsumer) Nak(_ context.Context, msg Message, exitCode int) error {
+	requeue := c.requeueAll || slices.Contains(c.requeueCodes, exitCode)
+	return msg.handle.(amqp.Delivery).Nack(false, requeue)
+}
+
+func (c *amqpConsumer) Close() error {
+	return errors.Join(c.channel.Close(), c.conn.Close())
+}
@@ -0,0 +1,253 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaDefaultNakDelay is the delay before a failed message is delivered again the first time (without a dead-letter topic).
+const kafkaDefaultNakDelay = 10 * time.Second
+
+// kafkaConsumer reads a topic as a member of a consumer group.
+// Offsets are committed per partition once every earlier fetched message of the partition is settled,
+// so a crash never skips a message that was not processed: it is delivered again after the next restart
+// or rebalance, together with the later messages of its partition. With a dead-letter topic a failed message
+// is written to it and settled, so it does not hold back the commits of its partition. Without one the failed
+// message stays unsettled and is delivered again after a backoff (a consumer group cannot seek back).
+type kafkaConsumer struct {
+	reader *kafka.Reader
+	// deadLetters receives the failed messages, nil without a dead-letter topic.
+	deadLetters *kafka.Writer
+	nakDelay    time.Duration
+
+	lock       sync.Mutex
+	partitions map[int]*partitionOffsets
+	// retries holds the failed messages waiting to be delivered again, by the time they are due.
+	retries []kafkaRetry
+	// deliveries counts the deliveries of the messages delivered more than once.
+	deliveries map[kafkaPosition]uint64
+}
+
+// kafkaPosition identifies a message of the topic.
+type kafkaPosition struct {
+	partition int
+	offset    int64
+}
+
+// kafkaRetry is a failed message waiting to be delivered again.
+type kafkaRetry struct {
+	msg kafka.Message
+	due time.Time
+}
+
+// partitionOffsets tracks the fetched messages of a partition until they can be committed.
+type partitionOffsets struct {
+	// fetched holds the offsets in the order they were fetched (ascending).
+	fetched []int64
+	// settled holds the offsets that are settled but not committed yet.
+	settled map[int64]bool
+}
+
+// openKafka joins the consumer group of the topic named by the path.
+// Query parameters: group (consumer group, default executor), dlq (topic the failed messages are written to) and
+// nak_delay (without dlq, delay before a failed message is delivered again, doubled on every delivery).
+func openKafka(_ context.Context, u *url.URL, _ Options) (Consumer, error) {
+	topic := strings.Trim(u.Path, "/")
+	if topic == "" {
+		return nil, errors.New("kafka url requires the topic as path (kafka://host:9092/<topic>)")
+	}
+	group := u.Query().Get("group")
+	if group == "" {
+		group = "executor"
+	}
+	nakDelay, err := durationParam(u.Query(), "nak_delay", kafkaDefaultNakDelay)
+	if err != nil {
+		return nil, err
+	}
+	if nakDelay < 0 {
+		return nil, errors.New("nak_delay cannot be negative")
+	}
+	brokers := strings.Split(u.Host, ",")
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  brokers,
+		GroupID:  group,
+		Topic:    topic,
+		MinBytes: 1,
+		MaxBytes: 10 << 20,
+	})
+	c := &kafkaConsumer{
+		reader:     reader,
+		nakDelay:   nakDelay,
+		partitions: make(map[int]*partitionOffsets),
+		deliveries: make(map[kafkaPosition]uint64),
+	}
+	if dlq := u.Query().Get("dlq"); dlq != "" {
+		c.deadLetters = &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        dlq,
+			RequiredAcks: kafka.RequireAll,
+		}
+	}
+	return c, nil
+}
+
+// Fetch returns the failed messages once they are due again, then the next message of the topic.
+func (c *kafkaConsumer) Fetch(ctx context.Context, wait time.Duration) (Message, bool, error) {
+	if msg, ok := c.dueRetry(); ok {
+		return c.message(msg), true, nil
+	}
+	if due, ok := c.nextRetry(); ok {
+		wait = max(min(wait, time.Until(due)), 0)
+	}
+	fetchCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	msg, err := c.reader.FetchMessage(fetchCtx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return Message{}, false, ctx.Err()
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			if msg, ok := c.dueRetry(); ok {
+				return c.message(msg), true, nil
+			}
+			return Message{}, false, nil
+		}
+		return Message{}, false, fmt.Errorf("failed to fetch kafka message: %w", err)
+	}
+	c.lock.Lock()
+	p, ok := c.partitions[msg.Partition]
+	if !ok {
+		p = &partitionOffsets{settled: make(map[int64]bool)}
+		c.partitions[msg.Partition] = p
+	}
+	p.fetched = append(p.fetched, msg.Offset)
+	c.lock.Unlock()
+	return c.message(msg), true, nil
+}
+
+// dueRetry removes and returns the failed message that is due first, if any is due.
+func (c *kafkaConsumer) dueRetry() (kafka.Message, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.retries) == 0 || c.retries[0].due.After(time.Now()) {
+		return kafka.Message{}, false
+	}
+	msg := c.retries[0].msg
+	c.retries = c.retries[1:]
+	return msg, true
+}
+
+// nextRetry returns the time the next failed message is due, if any waits.
+func (c *kafkaConsumer) nextRetry() (time.Time, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.retries) == 0 {
+		return time.Time{}, false
+	}
+	return c.retries[0].due, true
+}
+
+// message exposes a kafka message as a broker message.
+func (c *kafkaConsumer) message(msg kafka.Message) Message {
+	c.lock.Lock()
+	delivered := c.deliveries[kafkaPosition{msg.Partition, msg.Offset}] + 1
+	c.lock.Unlock()
+
+	headers := make(map[string]any, len(msg.Headers))
+	for _, h := range msg.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	return Message{
+		Seq:    msg.Offset,
+		Stream: "p" + strconv.Itoa(msg.Partition),
+		Data:   msg.Value,
+		Vars: map[string]any{
+			"payload":   string(msg.Value),
+			"topic":     msg.Topic,
+			"partition": msg.Partition,
+			"key":       string(msg.Key),
+			"headers":   headers,
+			"delivered": delivered,
+		},
+		handle: msg,
+	}
+}
+
+// Ack settles the message and commits the offsets of its partition up to the last message before which every
+// fetched message is settled.
+func (c *kafkaConsumer) Ack(ctx context.Context, msg Message) error {
+	return c.settle(ctx, msg.handle.(kafka.Message))
+}
+
+// Nak writes the message to the dead-letter topic and settles it, it is not delivered again. A message that
+// cannot be written to the dead-letter topic stays unsettled, it is delivered again after the next restart or
+// rebalance. Without a dead-letter topic the message is not settled (its offset is not committed) and is
+// delivered again after a backoff growing with its deliveries.
+func (c *kafkaConsumer) Nak(ctx context.Context, msg Message, exitCode int) error {
+	m := msg.handle.(kafka.Message)
+	if c.deadLetters == nil {
+		c.retry(m)
+		return nil
+	}
+	dead := kafka.Message{
+		Key:   m.Key,
+		Value: m.Value,
+		Headers: append(slices.Clone(m.Headers),
+			kafka.Header{Key: "executor-topic", Value: []byte(m.Topic)},
+			kafka.Header{Key: "executor-partition", Value: []byte(strconv.Itoa(m.Partition))},
+			kafka.Header{Key: "executor-offset", Value: []byte(strconv.FormatInt(m.Offset, 10))},
+			kafka.Header{Key: "executor-exit-code", Value: []byte(strconv.Itoa(exitCode))},
+		),
+	}
+	if err := c.deadLetters.WriteMessages(ctx, dead); err != nil {
+		return fmt.Errorf("failed to write the message to the dead-letter topic: %w", err)
+	}
+	return c.settle(ctx, m)
+}
+
+// retry schedules the failed message to be delivered again.
+func (c *kafkaConsumer) retry(m kafka.Message) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	position := kafkaPosition{m.Partition, m.Offset}
+	c.deliveries[position]++
+	due := time.Now().Add(redeliveryDelay(c.nakDelay, c.deliveries[position]))
+	i, _ := slices.BinarySearchFunc(c.retries, due, func(r kafkaRetry, t time.Time) int { return r.due.Compare(t) })
+	c.retries = slices.Insert(c.retries, i, kafkaRetry{msg: m, due: due})
+}
+
+// settle marks the message as settled and commits the offsets that became contiguous.
+func (c *kafkaConsumer) settle(ctx context.Context, m kafka.Message) error {
+	c.lock.Lock()
+	delete(c.deliveries, kafkaPosition{m.Partition, m.Offset})
+	p := c.partitions[m.Partition]
+	p.settled[m.Offset] = true
+	commit := int64(-1)
+	for len(p.fetched) != 0 && p.settled[p.fetched[0]] {
+		commit = p.fetched[0]
+		delete(p.settled, commit)
+		p.fetched = p.fetched[1:]
+	}
+	c.lock.Unlock()
+	if commit < 0 {
+		return nil
+	}
+	// only the position is committed, the payload is not needed
+	return c.reader.CommitMessages(ctx, kafka.Message{Topic: m.Topic, Partition: m.Partition, Offset: commit})
+}
+
+func (c *kafkaConsumer) Close() error {
+	if c.deadLetters != nil {
+		return errors.Join(c.deadLetters.Close(), c.reader.Close())
+	}
+	return c.reader.Close()
+}
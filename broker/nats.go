@@ -0,0 +1,201 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// natsDefaultAckWait is how long a fetched message may stay unacknowledged before JetStream delivers it again.
+const natsDefaultAckWait = 5 * time.Minute
+
+// natsDefaultMaxDeliver bounds the deliveries of a message whose batch keeps failing.
+const natsDefaultMaxDeliver = 5
+
+// natsDefaultNakDelay is the delay before a failed message is delivered again the first time.
+const natsDefaultNakDelay = 10 * time.Second
+
+// natsConsumer pulls messages from a durable JetStream consumer.
+// Messages in flight are marked as in progress every third of the ack wait, so JetStream does not deliver
+// a message whose batch runs longer than the ack wait again (like the leases of the redis queue).
+type natsConsumer struct {
+	conn     *nats.Conn
+	consumer jetstream.Consumer
+	ackWait  time.Duration
+	nakDelay time.Duration
+	stop     context.CancelFunc
+
+	lock sync.Mutex
+	// inFlight holds the fetched messages that are not settled yet, by stream sequence.
+	inFlight map[uint64]jetstream.Msg
+}
+
+// openNATS connects to the server and creates (or updates) the durable pull consumer of the stream named by the path.
+// Query parameters: subject (filter subject), durable (consumer name, default executor), ack_wait,
+// max_deliver (maximum number of deliveries of a message, default 5, -1 is unlimited) and nak_delay (delay before
+// a failed message is delivered again, doubled on every delivery).
+func openNATS(ctx context.Context, u *url.URL, _ Options) (Consumer, error) {
+	stream := strings.Trim(u.Path, "/")
+	if stream == "" {
+		return nil, errors.New("nats url requires the stream as path (nats://host:4222/<stream>)")
+	}
+	q := u.Query()
+	ackWait, err := durationParam(q, "ack_wait", natsDefaultAckWait)
+	if err != nil {
+		return nil, err
+	}
+	if ackWait <= 0 {
+		return nil, errors.New("ack_wait must be positive")
+	}
+	durable := q.Get("durable")
+	if durable == "" {
+		durable = "executor"
+	}
+	maxDeliver := natsDefaultMaxDeliver
+	if raw := q.Get("max_deliver"); raw != "" {
+		if maxDeliver, err = strconv.Atoi(raw); err != nil {
+			return nil, fmt.Errorf("invalid max_deliver: %w", err)
+		}
+		if maxDeliver == 0 || maxDeliver < -1 {
+			return nil, errors.New("max_deliver must be positive (or -1 for unlimited deliveries)")
+		}
+	}
+	nakDelay, err := durationParam(q, "nak_delay", natsDefaultNakDelay)
+	if err != nil {
+		return nil, err
+	}
+	if nakDelay < 0 {
+		return nil, errors.New("nak_delay cannot be negative")
+	}
+	server := *u
+	server.Path, server.RawQuery = "", ""
+	conn, err := nats.Connect(server.String(), nats.Name("executor"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to nats: %w", err)
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	consumer, err := js.CreateOrUpdateConsumer(ctx, stream, jetstream.ConsumerConfig{
+		Durable:       durable,
+		FilterSubject: q.Get("subject"),
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       ackWait,
+		MaxDeliver:    maxDeliver,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create jetstream consumer: %w", err)
+	}
+	renewCtx, stop := context.WithCancel(context.WithoutCancel(ctx))
+	c := &natsConsumer{
+		conn:     conn,
+		consumer: consumer,
+		ackWait:  ackWait,
+		nakDelay: nakDelay,
+		stop:     stop,
+		inFlight: make(map[uint64]jetstream.Msg),
+	}
+	go c.markInProgress(renewCtx)
+	return c, nil
+}
+
+// markInProgress resets the ack wait of the messages in flight until ctx is done.
+func (c *natsConsumer) markInProgress(ctx context.Context) {
+	ticker := time.NewTicker(c.ackWait / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		c.lock.Lock()
+		msgs := make([]jetstream.Msg, 0, len(c.inFlight))
+		for _, msg := range c.inFlight {
+			msgs = append(msgs, msg)
+		}
+		c.lock.Unlock()
+		for _, msg := range msgs {
+			// a failure is retried on the next tick, the message is delivered again if it keeps failing
+			_ = msg.InProgress()
+		}
+	}
+}
+
+func (c *natsConsumer) Fetch(ctx context.Context, wait time.Duration) (Message, bool, error) {
+	batch, err := c.consumer.Fetch(1, jetstream.FetchMaxWait(wait))
+	if err != nil {
+		if errors.Is(err, context.Canceled) || ctx.Err() != nil {
+			return Message{}, false, ctx.Err()
+		}
+		return Message{}, false, err
+	}
+	msg, ok := <-batch.Messages()
+	if !ok {
+		return Message{}, false, batch.Error()
+	}
+	meta, err := msg.Metadata()
+	if err != nil {
+		return Message{}, false, err
+	}
+	c.lock.Lock()
+	c.inFlight[meta.Sequence.Stream] = msg
+	c.lock.Unlock()
+
+	headers := make(map[string]any, len(msg.Headers()))
+	for name := range msg.Headers() {
+		headers[name] = msg.Headers().Get(name)
+	}
+	return Message{
+		Seq:  int64(meta.Sequence.Stream),
+		Data: msg.Data(),
+		Vars: map[string]any{
+			"payload":   string(msg.Data()),
+			"subject":   msg.Subject(),
+			"headers":   headers,
+			"delivered": meta.NumDelivered,
+		},
+		handle: msg,
+	}, true, nil
+}
+
+func (c *natsConsumer) Ack(_ context.Context, msg Message) error {
+	c.settle(msg)
+	return msg.handle.(jetstream.Msg).Ack()
+}
+
+// Nak delivers the message again after a backoff growing with its deliveries, so a message that keeps failing
+// does not hot-loop the consumer until max_deliver is reached.
+func (c *natsConsumer) Nak(_ context.Context, msg Message, _ int) error {
+	c.settle(msg)
+	handle := msg.handle.(jetstream.Msg)
+	delivery := uint64(1)
+	if meta, err := handle.Metadata(); err == nil {
+		delivery = meta.NumDelivered
+	}
+	return handle.NakWithDelay(redeliveryDelay(c.nakDelay, delivery))
+}
+
+// settle stops marking the message as in progress.
+func (c *natsConsumer) settle(msg Message) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.inFlight, uint64(msg.Seq))
+}
+
+// Close stops marking messages as in progress, the messages in flight are delivered again once their ack wait elapsed.
+func (c *natsConsumer) Close() error {
+	c.stop()
+	return c.conn.Drain()
+}
@@ -0,0 +1,111 @@
+/*
+Copyright © 2025 Motalleb Fallahnezhad
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/FMotalleb/executor/cmd/executor"
+	"github.com/FMotalleb/executor/input"
+	"github.com/spf13/cobra"
+)
+
+// knownShells are looked up on PATH in addition to the entries of /etc/shells.
+var knownShells = []string{"sh", "bash", "zsh", "dash", "ksh", "fish", "pwsh", "powershell", "cmd"}
+
+// runDirPattern matches the per-run log directories (run IDs), they are not instance names.
+var runDirPattern = regexp.MustCompile(`^\d{8}T\d{6}-[0-9a-f]+$`)
+
+// registerCompletions adds the dynamic value completions of the root command flags.
+func registerCompletions() {
+	complete := func(flag string, fn func() []string) {
+		cobra.CheckErr(rootCmd.RegisterFlagCompletionFunc(flag, fixedCompletion(fn)))
+	}
+	complete("shell", availableShells)
+	complete("runner", executor.AvailableRunners)
+	complete("strategy", executor.StrategyNames)
+	complete("in-flight", func() []string {
+		return []string{executor.InFlightFail, executor.InFlightSkip, executor.InFlightRerun}
+	})
+	complete("on-duplicate", func() []string {
+		return []string{executor.OnDuplicateWarn, executor.OnDuplicateFail}
+	})
+	complete("report-format", func() []string {
+		return []string{executor.ReportFormatJSON, executor.ReportFormatMarkdown}
+	})
+	complete("ionice-class", executor.IONiceClassNames)
+	complete("input-delimiter", func() []string {
+		return []string{input.DelimiterNewline, input.DelimiterNul}
+	})
+	cobra.CheckErr(rootCmd.RegisterFlagCompletionFunc("name", nameCompletion))
+}
+
+// fixedCompletion completes a flag from the values returned by fn, without falling back to file names.
+func fixedCompletion(fn func() []string) cobra.CompletionFunc {
+	return func(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+		return fn(), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// availableShells lists the shells of /etc/shells and the known shells found on PATH.
+func availableShells() []string {
+	var shells []string
+	if f, err := os.Open("/etc/shells"); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if _, err := os.Stat(line); err == nil {
+				shells = append(shells, line)
+			}
+		}
+		_ = f.Close()
+	}
+	for _, name := range knownShells {
+		if path, err := exec.LookPath(name); err == nil {
+			shells = append(shells, path)
+		}
+	}
+	slices.Sort(shells)
+	return slices.Compact(shells)
+}
+
+// nameCompletion completes instance names from the named log directories under --log-dir.
+func nameCompletion(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	logDir, err := cmd.Flags().GetString("log-dir")
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	entries, err := os.ReadDir(logDir)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() && !runDirPattern.MatchString(e.Name()) && !strings.HasPrefix(e.Name(), ".") {
+			names = append(names, e.Name())
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,91 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// CPUSetAuto partitions the available cores across the workers.
+const CPUSetAuto = "auto"
+
+// AffinityConfig pins the processes spawned by workers to a set of CPUs, set on the thread starting the process
+// which the process inherits it from.
+// CPUSet is either a cpu list (e.g. `0-3,6`) shared by all workers, or `auto` which gives each
+// worker its own slice of the available cores.
+type AffinityConfig struct {
+	CPUSet string
+
+	workers int
+}
+
+func (a AffinityConfig) enabled() bool {
+	return a.CPUSet != ""
+}
+
+// Validate checks the cpu list.
+func (a AffinityConfig) Validate() error {
+	if !a.enabled() {
+		return nil
+	}
+	if a.CPUSet != CPUSetAuto {
+		if _, err := parseCPUList(a.CPUSet); err != nil {
+			return err
+		}
+	}
+	return validateAffinitySupport()
+}
+
+// cpusFor returns the cpus the given worker (1 based index) is pinned to.
+func (a AffinityConfig) cpusFor(worker int) ([]int, error) {
+	if a.CPUSet != CPUSetAuto {
+		return parseCPUList(a.CPUSet)
+	}
+	cores := runtime.NumCPU()
+	workers := max(a.workers, 1)
+	slot := (worker - 1) % workers
+	if workers >= cores {
+		return []int{slot % cores}, nil
+	}
+	begin := slot * cores / workers
+	end := (slot + 1) * cores / workers
+	cpus := make([]int, 0, end-begin)
+	for cpu := begin; cpu < end; cpu++ {
+		cpus = append(cpus, cpu)
+	}
+	return cpus, nil
+}
+
+// parseCPUList parses the kernel cpu list format (e.g. `0-3,6,8-9`).
+func parseCPUList(list string) ([]int, error) {
+	var cpus []int
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		low, high, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(low)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpu list %q: %w", list, err)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(high); err != nil {
+				return nil, fmt.Errorf("invalid cpu list %q: %w", list, err)
+			}
+		}
+		if first < 0 || last < first {
+			return nil, fmt.Errorf("invalid cpu range %q in cpu list", part)
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	if len(cpus) == 0 {
+		return nil, errors.New("cpu list is empty")
+	}
+	return cpus, nil
+}
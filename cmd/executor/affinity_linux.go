@@ -0,0 +1,44 @@
+//go:build linux
+
+package executor
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const cpuMaskWordBits = 64
+
+func validateAffinitySupport() error {
+	return nil
+}
+
+// apply pins the process (or thread) to the cpus assigned to the worker.
+func (a AffinityConfig) apply(pid int, worker int) error {
+	if !a.enabled() {
+		return nil
+	}
+	cpus, err := a.cpusFor(worker)
+	if err != nil {
+		return err
+	}
+	highest := 0
+	for _, cpu := range cpus {
+		highest = max(highest, cpu)
+	}
+	mask := make([]uint64, highest/cpuMaskWordBits+1)
+	for _, cpu := range cpus {
+		mask[cpu/cpuMaskWordBits] |= 1 << (uint(cpu) % cpuMaskWordBits)
+	}
+	_, _, errno := syscall.RawSyscall(
+		syscall.SYS_SCHED_SETAFFINITY,
+		uintptr(pid),
+		uintptr(len(mask)*int(unsafe.Sizeof(mask[0]))),
+		uintptr(unsafe.Pointer(&mask[0])),
+	)
+	if errno != 0 {
+		return fmt.Errorf("failed to set cpu affinity: %w", errno)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package executor
+
+import "errors"
+
+func validateAffinitySupport() error {
+	return errors.New("cpu affinity is only available on linux")
+}
+
+func (a AffinityConfig) apply(_ int, _ int) error {
+	return nil
+}
@@ -0,0 +1,173 @@
+package executor
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/FMotalleb/executor/logger"
+)
+
+const (
+	// annotationPrefix marks an output line as an annotation, e.g. `::executor::note=processed 1000 rows`.
+	annotationPrefix = "::executor::"
+	// maxAnnotations caps the annotations kept per batch so a chatty child cannot exhaust memory.
+	maxAnnotations = 100
+	// maxAnnotationLine caps the length of a line buffered while looking for an annotation.
+	maxAnnotationLine = 64 << 10
+	// cursorAnnotation is the annotation kind exposed as `.prev.cursor` to the next batch.
+	cursorAnnotation = "cursor"
+)
+
+// Annotation is a message the child process attached to its batch by printing
+// a line formatted as `::executor::<kind>=<message>` (kind being note, warning, error, ...).
+type Annotation struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// annotationSet collects annotations of a batch across all attempts.
+type annotationSet struct {
+	lock  sync.Mutex
+	items []Annotation
+}
+
+func (a *annotationSet) add(kind string, message string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if len(a.items) >= maxAnnotations {
+		return
+	}
+	a.items = append(a.items, Annotation{Kind: kind, Message: message})
+}
+
+func (a *annotationSet) list() []Annotation {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return append([]Annotation(nil), a.items...)
+}
+
+// wrap returns a writer that scans each written line for annotations before passing it to out.
+// Lines are reassembled per output stream (see outputStreams), so a line split across writes is still found
+// and the output of one stream cannot cut a line of the other one.
+func (a *annotationSet) wrap(out io.Writer) io.Writer {
+	w := &annotationWriter{set: a, output: out}
+	w.direct = w.newStream()
+	return w
+}
+
+// outputStreams is implemented by writers keeping a state per output stream of the process (stdout, stderr),
+// each stream is then written through the writer returned for its name.
+type outputStreams interface {
+	stream(name string) io.Writer
+}
+
+// streamWriter returns the writer the named stream of the process is copied into.
+func streamWriter(out io.Writer, name string) io.Writer {
+	if s, ok := out.(outputStreams); ok {
+		return s.stream(name)
+	}
+	return out
+}
+
+type annotationWriter struct {
+	set    *annotationSet
+	output io.Writer
+	// direct receives the writes not tied to a stream.
+	direct *annotationStream
+
+	lock    sync.Mutex
+	streams []*annotationStream
+}
+
+func (w *annotationWriter) stream(string) io.Writer {
+	return w.newStream()
+}
+
+func (w *annotationWriter) newStream() *annotationStream {
+	s := &annotationStream{writer: w}
+	w.lock.Lock()
+	w.streams = append(w.streams, s)
+	w.lock.Unlock()
+	return s
+}
+
+func (w *annotationWriter) Write(p []byte) (int, error) {
+	return w.direct.Write(p)
+}
+
+// Close scans the last line of every stream, even when it has no line break, then closes the output.
+func (w *annotationWriter) Close() error {
+	w.lock.Lock()
+	for _, s := range w.streams {
+		s.endLine()
+	}
+	w.lock.Unlock()
+	return logger.CloseWriter(w.output)
+}
+
+// annotationStream reassembles the lines of a stream, lines longer than maxAnnotationLine are not scanned.
+type annotationStream struct {
+	writer *annotationWriter
+
+	lock     sync.Mutex
+	line     []byte
+	overflow bool
+}
+
+func (s *annotationStream) Write(p []byte) (int, error) {
+	s.lock.Lock()
+	for rest := p; len(rest) != 0; {
+		chunk, after, found := bytes.Cut(rest, []byte("\n"))
+		s.append(chunk)
+		if !found {
+			break
+		}
+		s.scan()
+		rest = after
+	}
+	s.lock.Unlock()
+	return s.writer.output.Write(p)
+}
+
+func (s *annotationStream) append(chunk []byte) {
+	if s.overflow {
+		return
+	}
+	if len(s.line)+len(chunk) > maxAnnotationLine {
+		s.line, s.overflow = s.line[:0], true
+		return
+	}
+	s.line = append(s.line, chunk...)
+}
+
+// scan looks for an annotation in the buffered line and starts the next one.
+func (s *annotationStream) scan() {
+	if !s.overflow {
+		s.writer.set.parse(string(s.line))
+	}
+	s.line, s.overflow = s.line[:0], false
+}
+
+// endLine scans the line left without a line break.
+func (s *annotationStream) endLine() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.line) != 0 || s.overflow {
+		s.scan()
+	}
+}
+
+// parse adds the annotation carried by the line, if any.
+func (a *annotationSet) parse(line string) {
+	rest, found := strings.CutPrefix(strings.TrimSpace(line), annotationPrefix)
+	if !found {
+		return
+	}
+	kind, message, found := strings.Cut(rest, "=")
+	if !found || kind == "" {
+		return
+	}
+	a.add(kind, message)
+}
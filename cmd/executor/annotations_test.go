@@ -0,0 +1,33 @@
+package executor
+
+import (
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestAnnotationsPerStream(t *testing.T) {
+	set := new(annotationSet)
+	out := set.wrap(io.Discard)
+	stdout, stderr := streamWriter(out, "stdout"), streamWriter(out, "stderr")
+	for _, write := range []struct {
+		stream io.Writer
+		data   string
+	}{
+		{stdout, "::executor::no"},
+		{stderr, "progress 50%\n"},
+		{stdout, "te=split across writes\n"},
+		{stderr, "::executor::warning=no line break"},
+	} {
+		if _, err := io.WriteString(write.stream, write.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := out.(io.Closer).Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := []Annotation{{Kind: "note", Message: "split across writes"}, {Kind: "warning", Message: "no line break"}}
+	if got := set.list(); !slices.Equal(got, want) {
+		t.Fatalf("got annotations %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,57 @@
+package executor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ByteSize is an amount of bytes that can be parsed from human friendly values like 512, 4K, 10M or 1G.
+// It implements pflag.Value so it can be used directly as a flag.
+type ByteSize int64
+
+var byteSizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+	{"B", 1},
+}
+
+func (b *ByteSize) String() string {
+	v := int64(*b)
+	for _, u := range byteSizeUnits {
+		if v != 0 && v%u.size == 0 {
+			return strconv.FormatInt(v/u.size, 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+func (b *ByteSize) Set(s string) error {
+	raw := strings.ToUpper(strings.TrimSpace(s))
+	raw = strings.TrimSuffix(raw, "IB")
+	multiplier := int64(1)
+	for _, u := range byteSizeUnits {
+		if strings.HasSuffix(raw, u.suffix) {
+			raw = strings.TrimSuffix(raw, u.suffix)
+			multiplier = u.size
+			break
+		}
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid byte size %q: %w", s, err)
+	}
+	if v < 0 {
+		return fmt.Errorf("byte size cannot be negative: %q", s)
+	}
+	*b = ByteSize(v * multiplier)
+	return nil
+}
+
+func (b *ByteSize) Type() string {
+	return "size"
+}
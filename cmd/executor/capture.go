@@ -0,0 +1,77 @@
+package executor
+
+import (
+	"io"
+	"sync"
+
+	"github.com/FMotalleb/executor/logger"
+)
+
+// outputCapture keeps the last bytes of a batch output in memory so they can be embedded
+// in the report and the state journal. Only the latest attempt is kept.
+type outputCapture struct {
+	lock  sync.Mutex
+	limit int
+	data  []byte
+}
+
+// newOutputCapture returns a capture of at most limit bytes, or nil (capture disabled) for a non-positive limit.
+func newOutputCapture(limit int) *outputCapture {
+	if limit <= 0 {
+		return nil
+	}
+	return &outputCapture{limit: limit}
+}
+
+// fresh returns an empty capture with the same limit, nil when capture is disabled.
+func (c *outputCapture) fresh() *outputCapture {
+	if c == nil {
+		return nil
+	}
+	return newOutputCapture(c.limit)
+}
+
+// wrap resets the capture for a new attempt and returns a writer feeding both out and the capture.
+func (c *outputCapture) wrap(out io.Writer) io.Writer {
+	if c == nil {
+		return out
+	}
+	c.lock.Lock()
+	c.data = c.data[:0]
+	c.lock.Unlock()
+	return &captureWriter{capture: c, output: out}
+}
+
+// String returns the captured output, an empty string when capture is disabled.
+func (c *outputCapture) String() string {
+	if c == nil {
+		return ""
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return string(c.data)
+}
+
+func (c *outputCapture) add(p []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.data = append(c.data, p...)
+	if extra := len(c.data) - c.limit; extra > 0 {
+		// keep the tail, the end of the output usually explains a failure
+		c.data = append(c.data[:0], c.data[extra:]...)
+	}
+}
+
+type captureWriter struct {
+	capture *outputCapture
+	output  io.Writer
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	w.capture.add(p)
+	return w.output.Write(p)
+}
+
+func (w *captureWriter) Close() error {
+	return logger.CloseWriter(w.output)
+}
@@ -0,0 +1,37 @@
+package executor
+
+import (
+	"errors"
+)
+
+const (
+	DefaultCgroupParent = "executor"
+	maxIOWeight         = 10000
+)
+
+// CgroupConfig describes the cgroup v2 limits applied to each batch.
+// Every spawned process is placed into its own cgroup under Parent (relative to the cgroup v2 mount point).
+type CgroupConfig struct {
+	Parent      string
+	CPULimit    float64
+	MemoryLimit ByteSize
+	IOWeight    int
+}
+
+func (c CgroupConfig) enabled() bool {
+	return c.CPULimit > 0 || c.MemoryLimit > 0 || c.IOWeight > 0
+}
+
+// Validate checks the limits.
+func (c CgroupConfig) Validate() error {
+	if c.CPULimit < 0 {
+		return errors.New("cpu limit cannot be negative")
+	}
+	if c.IOWeight < 0 || c.IOWeight > maxIOWeight {
+		return errors.New("io weight must be between 1 and 10000")
+	}
+	if c.enabled() && c.Parent == "" {
+		return errors.New("cgroup parent is required when cgroup limits are set")
+	}
+	return validateCgroupSupport(c)
+}
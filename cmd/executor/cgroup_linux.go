@@ -0,0 +1,112 @@
+//go:build linux
+
+package executor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/FMotalleb/executor/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	cgroupMountPoint = "/sys/fs/cgroup"
+	cgroupCPUPeriod  = 100000
+	cgroupDirMode    = 0o755
+	cgroupFileMode   = 0o644
+)
+
+func validateCgroupSupport(c CgroupConfig) error {
+	if !c.enabled() {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(cgroupMountPoint, "cgroup.controllers")); err != nil {
+		return fmt.Errorf("cgroup v2 is not mounted at %s: %w", cgroupMountPoint, err)
+	}
+	return nil
+}
+
+// attach creates a dedicated cgroup for the process and makes the process start inside it.
+func (c CgroupConfig) attach(proc *exec.Cmd, name string) (func(), error) {
+	if !c.enabled() {
+		return func() {}, nil
+	}
+	parent := filepath.Join(cgroupMountPoint, c.Parent)
+	if err := os.MkdirAll(parent, cgroupDirMode); err != nil {
+		return nil, fmt.Errorf("failed to create cgroup parent: %w", err)
+	}
+	if err := writeCgroupFile(parent, "cgroup.subtree_control", c.controllers()); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(parent, name+"-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cgroup: %w", err)
+	}
+	if err := c.writeLimits(dir); err != nil {
+		_ = os.Remove(dir)
+		return nil, err
+	}
+	fd, err := syscall.Open(dir, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		_ = os.Remove(dir)
+		return nil, fmt.Errorf("failed to open cgroup: %w", err)
+	}
+	if proc.SysProcAttr == nil {
+		proc.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	proc.SysProcAttr.UseCgroupFD = true
+	proc.SysProcAttr.CgroupFD = fd
+	return func() {
+		_ = syscall.Close(fd)
+		if err := os.Remove(dir); err != nil {
+			logger.Get("Cgroup").Warn("failed to remove batch cgroup", zap.String("cgroup", dir), zap.Error(err))
+		}
+	}, nil
+}
+
+func (c CgroupConfig) controllers() string {
+	var controllers []string
+	if c.CPULimit > 0 {
+		controllers = append(controllers, "+cpu")
+	}
+	if c.MemoryLimit > 0 {
+		controllers = append(controllers, "+memory")
+	}
+	if c.IOWeight > 0 {
+		controllers = append(controllers, "+io")
+	}
+	return strings.Join(controllers, " ")
+}
+
+func (c CgroupConfig) writeLimits(dir string) error {
+	if c.CPULimit > 0 {
+		quota := int(c.CPULimit * cgroupCPUPeriod)
+		if err := writeCgroupFile(dir, "cpu.max", fmt.Sprintf("%d %d", quota, cgroupCPUPeriod)); err != nil {
+			return err
+		}
+	}
+	if c.MemoryLimit > 0 {
+		if err := writeCgroupFile(dir, "memory.max", strconv.FormatInt(int64(c.MemoryLimit), 10)); err != nil {
+			return err
+		}
+	}
+	if c.IOWeight > 0 {
+		if err := writeCgroupFile(dir, "io.weight", "default "+strconv.Itoa(c.IOWeight)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeCgroupFile(dir string, file string, value string) error {
+	if err := os.WriteFile(filepath.Join(dir, file), []byte(value), cgroupFileMode); err != nil {
+		return fmt.Errorf("failed to write %s of cgroup %s: %w", file, dir, err)
+	}
+	return nil
+}
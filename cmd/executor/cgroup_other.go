@@ -0,0 +1,19 @@
+//go:build !linux
+
+package executor
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func validateCgroupSupport(c CgroupConfig) error {
+	if c.enabled() {
+		return errors.New("cgroup limits are only available on linux")
+	}
+	return nil
+}
+
+func (c CgroupConfig) attach(_ *exec.Cmd, _ string) (func(), error) {
+	return func() {}, nil
+}
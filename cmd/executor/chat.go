@@ -0,0 +1,184 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/FMotalleb/executor/template"
+)
+
+// DefaultChatTemplate is the message posted to chat channels, a Go template over the run and its summary
+// (event, run, hostname, total, succeeded, failed, ..., see messageVars).
+const DefaultChatTemplate = `{{ if eq .event "run.started" -}}
+executor run {{ .run }} started on {{ .hostname }}{{ if .total }} with {{ .total }} batches{{ end }}
+{{- else if eq .event "run.failure_threshold" -}}
+executor run {{ .run }} on {{ .hostname }} reached {{ .failed }} failed batches
+{{- else -}}
+executor run {{ .run }} on {{ .hostname }} {{ if .aborted }}was aborted{{ else }}finished{{ end }} after {{ .duration }}: ` +
+	`{{ .succeeded }} succeeded, {{ .failed }} failed{{ if .skipped }}, {{ .skipped }} skipped{{ end }}
+{{- end }}{{ if .reportPath }} (report: {{ .reportPath }}){{ end }}`
+
+// Chat platforms.
+const (
+	chatSlack = "slack"
+	chatTeams = "teams"
+)
+
+// chatChannel posts a message rendered from the template to a Slack or Microsoft Teams incoming webhook,
+// only for the end of the run and the failure threshold.
+type chatChannel struct {
+	platform string
+	template string
+	hook     *webhook
+}
+
+func newChatChannel(platform string, u string, tmpl string, retries int) *chatChannel {
+	if tmpl == "" {
+		tmpl = DefaultChatTemplate
+	}
+	return &chatChannel{platform: platform, template: tmpl, hook: newWebhook(u, "", retries)}
+}
+
+func (c *chatChannel) name() string {
+	return c.platform + " " + redactURL(c.hook.url)
+}
+
+func (c *chatChannel) send(ctx context.Context, e Event) error {
+	if !summaryEvent(e) {
+		return nil
+	}
+	text, err := template.EvaluateTemplate(c.template, messageVars(e))
+	if err != nil {
+		return fmt.Errorf("failed to evaluate message template: %w", err)
+	}
+	text = strings.TrimSpace(text)
+	var payload any
+	switch c.platform {
+	case chatTeams:
+		color := "2EB886"
+		if e.Summary.Aborted || e.Summary.Failed != 0 {
+			color = "D00000"
+		}
+		payload = map[string]string{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    e.Event,
+			"themeColor": color,
+			"text":       text,
+		}
+	default:
+		payload = map[string]string{"text": text}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return c.hook.deliver(ctx, e.Event, body)
+}
+
+// summaryEvent tells whether the event summarizes the run (its end or the failure threshold),
+// the only events sent to channels read by people.
+func summaryEvent(e Event) bool {
+	return e.Summary != nil && (e.Event == EventRunFinished || e.Event == EventFailureThreshold)
+}
+
+// messageVars are the variables of message templates: event, run (the name, or the id of unnamed runs), runId,
+// name, hostname, time, total (run.started only), succeeded, failed, skipped, attempts, aborted, duration and reportPath.
+func messageVars(e Event) map[string]any {
+	run := e.Name
+	if run == "" {
+		run = e.RunID
+	}
+	vars := map[string]any{
+		"event":    e.Event,
+		"run":      run,
+		"runId":    e.RunID,
+		"name":     e.Name,
+		"hostname": e.Hostname,
+		"time":     e.Time,
+		"total":    e.Total,
+	}
+	if e.Summary == nil {
+		return vars
+	}
+	for name, value := range map[string]any{
+		"succeeded":  e.Summary.Succeeded,
+		"failed":     e.Summary.Failed,
+		"skipped":    e.Summary.Skipped,
+		"attempts":   e.Summary.Attempts,
+		"aborted":    e.Summary.Aborted,
+		"duration":   e.Summary.Duration.Round(time.Second),
+		"reportPath": e.Summary.ReportPath,
+	} {
+		vars[name] = value
+	}
+	return vars
+}
+
+// telegramAPI is the base url of the Telegram Bot API.
+const telegramAPI = "https://api.telegram.org"
+
+// TelegramConfig sends the start and end of the run and the failure threshold to a Telegram chat through a bot.
+type TelegramConfig struct {
+	// Token of the bot, empty disables Telegram messages.
+	Token string
+	// ChatID is the id of the chat (or @channel username) messages are sent to.
+	ChatID string
+	// Template renders the message, DefaultChatTemplate when empty.
+	Template string
+}
+
+// Enabled tells whether messages are sent to Telegram.
+func (c TelegramConfig) Enabled() bool {
+	return c.Token != ""
+}
+
+// Validate checks that a chat is configured.
+func (c TelegramConfig) Validate() error {
+	if c.Enabled() && c.ChatID == "" {
+		return errors.New("telegram messages need a chat id")
+	}
+	return nil
+}
+
+// telegramChannel sends messages through the sendMessage method of the Bot API.
+type telegramChannel struct {
+	chatID   string
+	template string
+	hook     *webhook
+}
+
+func newTelegramChannel(cfg TelegramConfig, retries int) *telegramChannel {
+	tmpl := cfg.Template
+	if tmpl == "" {
+		tmpl = DefaultChatTemplate
+	}
+	return &telegramChannel{
+		chatID:   cfg.ChatID,
+		template: tmpl,
+		hook:     newWebhook(telegramAPI+"/bot"+cfg.Token+"/sendMessage", "", retries),
+	}
+}
+
+func (c *telegramChannel) name() string {
+	return "telegram " + c.chatID
+}
+
+func (c *telegramChannel) send(ctx context.Context, e Event) error {
+	if e.Event != EventRunStarted && !summaryEvent(e) {
+		return nil
+	}
+	text, err := template.EvaluateTemplate(c.template, messageVars(e))
+	if err != nil {
+		return fmt.Errorf("failed to evaluate message template: %w", err)
+	}
+	body, err := json.Marshal(map[string]string{"chat_id": c.chatID, "text": strings.TrimSpace(text)})
+	if err != nil {
+		return err
+	}
+	return c.hook.deliver(ctx, e.Event, body)
+}
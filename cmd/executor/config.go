@@ -3,35 +3,147 @@ package executor
 import (
 	"errors"
 	"fmt"
+	"math"
 	"os"
+	"regexp"
 	"time"
+
+	"github.com/FMotalleb/executor/input"
+	"github.com/FMotalleb/executor/secrets"
 )
 
+// namePattern restricts instance names to characters safe in paths, labels and file names.
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
 type Config struct {
-	Shell     string
+	// Name identifies the executor instance in logs, log directories, reports and notifications.
+	Name string
+
+	Shell string
+	// ShellArgs precede the command, nil uses those of the shell (see ShellArgs).
 	ShellArgs []string
+	// Runner replaces Shell/ShellArgs with a language runner (python, node, ...) evaluating the command inline.
+	Runner        string
+	runnerVersion string
 
-	Command          string
+	Command string
+	// Tasks (`name=template`) fan every batch out into one sibling batch per task, replacing Command.
+	Tasks            []string
+	tasks            []task
 	WorkingDirectory string
 	StdIn            string
+	// Hooks run once the result of a batch is known.
+	Hooks BatchHooks
+	// Middlewares wrap the processing of every attempt, the first one is the outermost.
+	Middlewares []Middleware
+	// ProcessRunner runs the process of every attempt, nil spawns local processes.
+	ProcessRunner ProcessRunner
+	// Wasm transforms the variables of the batches and decides retries with WASM modules.
+	Wasm WasmConfig
+
+	Env     EnvConfig
+	Secrets secrets.Config
+	Process ProcessConfig
+	Systemd SystemdConfig
+
+	Input input.Config
+	// Follow streams the items of the input source (stdin by default) into batches as they arrive,
+	// instead of reading the whole input before planning.
+	Follow bool
 
-	Limit     int
-	Offset    int
-	BatchSize int
+	// Limit and Offset bound the processed offsets, an Offset greater than Limit iterates downwards.
+	Limit  int64
+	Offset int64
+	// Ranges replace Offset/Limit with several disjoint ranges, batched independently.
+	Ranges    RangeList
+	BatchSize int64
+	// Step is the distance between the starts of consecutive batches, zero means BatchSize
+	// (or -BatchSize when iterating downwards).
+	Step  int64
+	Align int64
 
 	Timeout  time.Duration
 	Parallel int
 	Retry    uint
+	// RetryPolicy decides whether failed attempts are retried, nil uses MaxRetries(Retry).
+	RetryPolicy RetryPolicy
+
+	RetryParallel int
+
+	Strategy  string
+	Priority  string
+	Label     string
+	NotBefore string
+	// Shard restricts the run to the batches assigned to this node.
+	Shard Shard
+	// Filter is an expression evaluated per batch, only matching batches are dispatched.
+	Filter string
+	filter *batchFilter
+
+	// LogDir may be a template over the node identity (hostname, shard, ...), rendered once at startup.
+	LogDir       string
+	LogToStdErr  bool
+	LogRateLimit ByteSize
+	LogFileMode  OctalMode
+	// LogFlush trades the durability of the per batch log files against the IO overhead of writing them.
+	LogFlush LogFlush
+	// CaptureOutput is the number of trailing output bytes of each batch embedded in the report and state journal.
+	CaptureOutput ByteSize
+	// LogEncryption encrypts the per batch log files to age recipients.
+	LogEncryption LogEncryptionConfig
+	// Sample fully logs the output of a random subset of batches, the others only keep a tail on failure.
+	Sample       SampleConfig
+	PerRunLogDir bool
+	Retention    RetentionPolicy
+
+	Umask OctalMode
+	// TempDir is the scratch directory of spawned processes (TMPDIR), a template like LogDir, empty keeps the inherited one.
+	TempDir string
+	// ContextFile writes the batch context into a JSON file per attempt, passed to the process as EXECUTOR_CONTEXT.
+	ContextFile bool
 
-	LogDir      string
-	LogToStdErr bool
+	Report  ReportConfig
+	State   StateConfig
+	DoneKey DoneKeyConfig
+	History HistoryConfig
+	Queue   QueueConfig
+	// Consume runs one batch per message of a broker instead of planning batches.
+	Consume ConsumeConfig
+	// ControlSocket is a unix socket a newer instance may take the run over on (see Takeover), empty disables it.
+	ControlSocket string
+	// Takeover continues the run handed over by another instance instead of planning batches.
+	Takeover *Handoff
+
+	// Notify delivers run and batch events to external systems.
+	Notify NotifyConfig
+	// Listener observes the run from Go code, nil ignores the events.
+	Listener EventListener
+
+	// Reservation makes every attempt of a batch hold a token of an external capacity service while it runs.
+	Reservation ReservationConfig
+
+	HealthCheckInterval time.Duration
+	ReplaceUnhealthy    bool
 }
 
 // Validate checks the Config for any invalid or missing fields.
 func (c *Config) Validate() error {
+	if c.Runner != "" {
+		program, args, version, err := resolveRunner(c.Runner)
+		if err != nil {
+			return err
+		}
+		c.Shell, c.ShellArgs, c.runnerVersion = program, args, version
+	}
+	if c.Name != "" && !namePattern.MatchString(c.Name) {
+		return fmt.Errorf("invalid name %q, only letters, digits, '.', '_' and '-' are allowed", c.Name)
+	}
 	if c.Shell == "" {
 		return errors.New("shell is required")
 	}
+	if c.ShellArgs == nil {
+		c.ShellArgs = ShellArgs(c.Shell)
+	}
 	if c.Command == "" {
 		return errors.New("command is required")
 	}
@@ -44,24 +156,146 @@ func (c *Config) Validate() error {
 			return errors.New("working directory is not a directory")
 		}
 	}
-	if c.Limit <= 0 {
-		return errors.New("limit cannot be zero or negative")
+	if err := c.Secrets.Validate(); err != nil {
+		return err
 	}
-	if c.Offset < 0 {
-		return errors.New("offset cannot be negative")
+	if err := c.Wasm.Validate(); err != nil {
+		return err
 	}
-	if c.Offset > c.Limit {
-		return errors.New("offset cannot be greater than limit")
+	if err := c.Env.Load(); err != nil {
+		return err
+	}
+	c.Process.Affinity.workers = c.Parallel
+	if err := c.Process.Validate(); err != nil {
+		return err
+	}
+	if err := c.Systemd.Validate(); err != nil {
+		return err
+	}
+	if c.Follow && !c.Input.Enabled() {
+		c.Input.File = "-"
+	}
+	if err := c.Input.Validate(); err != nil {
+		return err
+	}
+	if c.Input.Enabled() && len(c.Ranges) != 0 {
+		return errors.New("ranges cannot be used with an input source")
+	}
+	if err := c.Ranges.validate(); err != nil {
+		return err
+	}
+	if err := c.validateTasks(); err != nil {
+		return err
+	}
+	if err := c.Consume.Validate(); err != nil {
+		return err
+	}
+	if c.Consume.Enabled() && (c.Input.Enabled() || len(c.Ranges) != 0 || c.Queue.Path != "") {
+		return errors.New("consuming messages cannot be combined with an input source, ranges or a queue")
+	}
+	if c.Follow && (c.Consume.Enabled() || c.Queue.Path != "" || c.State.Path != "") {
+		return errors.New("following the input cannot be combined with consuming messages, a queue or a state journal")
+	}
+	if (c.ControlSocket != "" || c.Takeover != nil) && (c.Consume.Enabled() || c.Follow || c.Queue.shared()) {
+		return errors.New("a run consuming messages, following the input or pulling from a redis queue cannot be taken over, start another instance instead")
+	}
+	if len(c.Ranges) == 0 && !c.Input.Enabled() && !c.Consume.Enabled() {
+		if c.Limit < 0 {
+			return errors.New("limit cannot be negative")
+		}
+		if c.Offset < 0 {
+			return errors.New("offset cannot be negative")
+		}
+		if c.Offset == c.Limit {
+			return errors.New("offset and limit cannot be equal, there is nothing to process")
+		}
 	}
 	if c.BatchSize <= 0 {
 		return errors.New("batch size must be greater than zero")
 	}
+	if end := c.planEnd(); end > math.MaxInt64-max(c.BatchSize, c.Step, -c.Step, c.Align) {
+		return fmt.Errorf("offsets up to %d overflow when batches of %d are planned, use smaller offsets", end, c.BatchSize)
+	}
+	if c.Input.Enabled() && c.Step != 0 {
+		return errors.New("step cannot be used with an input source")
+	}
+	if c.descending() && c.Step > 0 {
+		return errors.New("step must be negative when offset is greater than limit")
+	}
+	if !c.descending() && c.Step < 0 {
+		return errors.New("a negative step requires an offset greater than limit")
+	}
+	if c.Align < 0 {
+		return errors.New("align cannot be negative")
+	}
+	if c.Align != 0 && (c.Step != 0 || c.descending()) {
+		return errors.New("align cannot be combined with a custom step or a descending iteration")
+	}
 	if c.Timeout <= 0 {
 		return errors.New("timeout cannot be negative")
 	}
 	if c.Parallel <= 0 {
 		return errors.New("parallel must be greater than zero")
 	}
+	if c.RetryPolicy == nil {
+		c.RetryPolicy = MaxRetries(c.Retry)
+	}
+	if c.Listener == nil {
+		c.Listener = NopListener{}
+	}
+	if c.RetryParallel < 0 {
+		return errors.New("retry parallel cannot be negative")
+	}
+	if c.Strategy == "" {
+		c.Strategy = DefaultStrategy
+	}
+	if _, err := GetStrategy(c.Strategy); err != nil {
+		return err
+	}
+	filter, err := compileFilter(c.Filter)
+	if err != nil {
+		return err
+	}
+	c.filter = filter
+	if err := c.Report.Validate(); err != nil {
+		return err
+	}
+	if err := c.Retention.Validate(); err != nil {
+		return err
+	}
+	if err := c.State.Validate(); err != nil {
+		return err
+	}
+	if err := c.DoneKey.Validate(); err != nil {
+		return err
+	}
+	if err := c.History.Validate(); err != nil {
+		return err
+	}
+	if err := c.Queue.Validate(); err != nil {
+		return err
+	}
+	if err := c.Reservation.Validate(); err != nil {
+		return err
+	}
+	if err := c.Notify.Validate(); err != nil {
+		return err
+	}
+	if err := c.LogEncryption.Validate(); err != nil {
+		return err
+	}
+	if err := c.Sample.Validate(); err != nil {
+		return err
+	}
+	if c.LogEncryption.Enabled() && c.LogToStdErr {
+		return errors.New("log encryption cannot be used when logging to stderr")
+	}
+	if c.HealthCheckInterval < 0 {
+		return errors.New("health check interval cannot be negative")
+	}
+	if err := c.renderHostDirs(); err != nil {
+		return err
+	}
 	if !c.LogToStdErr && c.LogDir != "" {
 		info, err := os.Stat(c.LogDir)
 		if err != nil {
@@ -73,3 +307,29 @@ func (c *Config) Validate() error {
 	}
 	return nil
 }
+
+// planEnd returns the highest offset planned from the offset and limit or the ranges.
+func (c *Config) planEnd() int64 {
+	end := max(c.Offset, c.Limit)
+	for _, r := range c.Ranges {
+		end = max(end, r.End)
+	}
+	return end
+}
+
+// descending tells whether offsets are iterated downwards (from Offset to Limit).
+func (c *Config) descending() bool {
+	return len(c.Ranges) == 0 && !c.Input.Enabled() && c.Offset > c.Limit
+}
+
+// step returns the distance between the starts of consecutive batches.
+func (c *Config) step() int64 {
+	switch {
+	case c.Step != 0:
+		return c.Step
+	case c.descending():
+		return -c.BatchSize
+	default:
+		return c.BatchSize
+	}
+}
@@ -0,0 +1,139 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/FMotalleb/executor/broker"
+	"github.com/FMotalleb/executor/input"
+	"go.uber.org/zap"
+)
+
+// consumeFetchWait is how long a single fetch waits for a message before the dispatcher checks the run again.
+const consumeFetchWait = time.Second
+
+// ConsumeConfig turns executor into a worker running one batch per message received from a broker.
+// Messages are acknowledged once their batch succeeded and negatively acknowledged once it failed (after the retries).
+type ConsumeConfig struct {
+	// URL of the broker (e.g. nats://host:4222/<stream>?subject=jobs.>, kafka://host:9092/<topic> or amqp://host/?queue=jobs),
+	// empty disables the consumer mode.
+	URL string
+	// IdleExit stops the worker once no message arrived for this long, zero runs until executor is stopped.
+	IdleExit time.Duration
+}
+
+// Enabled tells whether executor consumes messages instead of planning batches.
+func (c ConsumeConfig) Enabled() bool {
+	return c.URL != ""
+}
+
+// Validate checks the broker url.
+func (c ConsumeConfig) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if c.IdleExit < 0 {
+		return errors.New("consume idle exit cannot be negative")
+	}
+	return broker.Validate(c.URL)
+}
+
+// consumerSource hands out one batch per message of the broker.
+type consumerSource struct {
+	ctx      context.Context
+	log      *zap.Logger
+	cfg      Config
+	run      runInfo
+	consumer broker.Consumer
+	// lastMessage is the time the last message arrived (or the worker started), used by the idle exit.
+	lastMessage time.Time
+
+	lock     sync.Mutex
+	inFlight map[*ExecRequest]broker.Message
+}
+
+// openConsumer connects to the broker of the consumer mode.
+func openConsumer(ctx context.Context, log *zap.Logger, cfg Config, run runInfo) (*consumerSource, error) {
+	consumer, err := broker.Open(ctx, cfg.Consume.URL, broker.Options{Prefetch: cfg.Parallel})
+	if err != nil {
+		return nil, err
+	}
+	log.Info("consuming messages", zap.Duration("idle_exit", cfg.Consume.IdleExit))
+	return &consumerSource{
+		ctx:         ctx,
+		log:         log,
+		cfg:         cfg,
+		run:         run,
+		consumer:    consumer,
+		lastMessage: time.Now(),
+		inFlight:    make(map[*ExecRequest]broker.Message),
+	}, nil
+}
+
+// next waits for the next message, once the idle exit elapsed without any message it returns nil and the zero time.
+func (s *consumerSource) next(now time.Time) (*ExecRequest, time.Time) {
+	msg, ok, err := s.consumer.Fetch(s.ctx, consumeFetchWait)
+	if err != nil {
+		if s.ctx.Err() == nil {
+			s.log.Error("failed to fetch a message", zap.Error(err))
+		}
+		return nil, now.Add(consumeFetchWait)
+	}
+	if !ok {
+		if s.cfg.Consume.IdleExit > 0 && time.Since(s.lastMessage) >= s.cfg.Consume.IdleExit {
+			s.log.Info("no message arrived within the idle exit, stopping")
+			return nil, time.Time{}
+		}
+		return nil, time.Now()
+	}
+	s.lastMessage = time.Now()
+	req := newRequest(s.ctx, s.cfg, s.run, msg.Seq, 1)
+	req.Stream = msg.Stream
+	req.items = []input.Item{{Value: payload(msg.Data), Vars: msg.Vars}}
+	if err := req.evaluate(s.cfg); err != nil {
+		// the message fails the same way on every delivery, it is dropped instead of being delivered forever
+		s.log.Error("message is not processed", zap.String("batch", req.name()), zap.Error(err))
+		if err := s.consumer.Ack(s.ctx, msg); err != nil {
+			s.log.Error("failed to ack message", zap.String("batch", req.name()), zap.Error(err))
+		}
+		return nil, time.Now()
+	}
+	s.lock.Lock()
+	s.inFlight[req] = msg
+	s.lock.Unlock()
+	return req, time.Time{}
+}
+
+// ack settles the message of the batch once the retry policy gave up or the batch succeeded,
+// what happens to the message of a failed batch depends on the broker (and the exit code).
+func (s *consumerSource) ack(r *ExecRequest, err error) error {
+	s.lock.Lock()
+	msg, ok := s.inFlight[r]
+	delete(s.inFlight, r)
+	s.lock.Unlock()
+	if !ok {
+		return nil
+	}
+	ctx := context.WithoutCancel(s.ctx)
+	if err != nil {
+		return s.consumer.Nak(ctx, msg, exitCodeOf(err))
+	}
+	return s.consumer.Ack(ctx, msg)
+}
+
+// Close disconnects from the broker, unsettled messages are delivered again by the broker.
+func (s *consumerSource) Close() error {
+	return s.consumer.Close()
+}
+
+// payload decodes a JSON message, other payloads are exposed as a string.
+func payload(data []byte) any {
+	var value any
+	if json.Valid(data) && json.Unmarshal(data, &value) == nil {
+		return value
+	}
+	return string(data)
+}
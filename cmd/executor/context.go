@@ -12,7 +12,7 @@ func NewSystemContext() context.Context {
 
 	// Set up a channel to listen for OS signals
 	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, syscall.SIGTERM)
+	signal.Notify(signalChan, syscall.SIGTERM, os.Interrupt)
 
 	// Goroutine to cancel the context when a signal is received
 	go func() {
@@ -0,0 +1,74 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// contextFileName is the name of the context file inside the temp dir of an attempt.
+const contextFileName = "context.json"
+
+// batchContext is the content of the context file, it describes the batch to the spawned process in one document.
+type batchContext struct {
+	RunID     string `json:"run_id"`
+	RunName   string `json:"run_name,omitempty"`
+	BatchID   string `json:"batch_id"`
+	Offset    int64  `json:"offset"`
+	BatchSize int64  `json:"batch_size"`
+	Limit     int64  `json:"limit"`
+	// Attempt is the number of the current attempt, starting at 1.
+	Attempt  uint   `json:"attempt"`
+	Deadline string `json:"deadline"`
+	Worker   int    `json:"worker"`
+	Hostname string `json:"hostname"`
+	// Vars are the template variables of the batch, without the secrets.
+	Vars map[string]any `json:"vars"`
+}
+
+// writeContextFile creates a temp dir for the attempt and writes the batch context into it,
+// the path is passed to the process as EXECUTOR_CONTEXT. The returned function removes the directory.
+func (e *ExecRequest) writeContextFile() (func(), error) {
+	if !e.contextFile {
+		return func() {}, nil
+	}
+	base := e.tempDir
+	if base == "" {
+		base = os.TempDir()
+	}
+	dir, err := os.MkdirTemp(base, "executor-"+e.name()+"-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create batch temp dir: %w", err)
+	}
+	cleanup := func() {
+		e.contextPath = ""
+		_ = os.RemoveAll(dir)
+	}
+	vars := e.getVarMap()
+	delete(vars, "secrets")
+	data, err := json.MarshalIndent(batchContext{
+		RunID:     e.RunID,
+		RunName:   e.RunName,
+		BatchID:   e.BatchID,
+		Offset:    e.Offset,
+		BatchSize: e.BatchSize,
+		Limit:     e.Offset + e.BatchSize,
+		Attempt:   e.TryCount + 1,
+		Deadline:  e.formatDeadline(),
+		Worker:    e.Worker,
+		Hostname:  e.hostname,
+		Vars:      vars,
+	}, "", "  ")
+	if err != nil {
+		cleanup()
+		return nil, fmt.Errorf("failed to encode batch context: %w", err)
+	}
+	path := filepath.Join(dir, contextFileName)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("failed to write batch context: %w", err)
+	}
+	e.contextPath = path
+	return cleanup, nil
+}
@@ -0,0 +1,127 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/FMotalleb/executor/logger"
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+)
+
+// Overlap policies, decide what happens when a scheduled run is due while the previous one still runs.
+const (
+	// OverlapSkip drops the due run.
+	OverlapSkip = "skip"
+	// OverlapQueue starts the due run once the previous one finished, at most one run waits.
+	OverlapQueue = "queue"
+	// OverlapKill cancels the previous run and starts the due one.
+	OverlapKill = "kill"
+)
+
+// CronConfig launches the configured run on a cron schedule.
+type CronConfig struct {
+	// Spec is a standard cron expression (`0 2 * * *`), a descriptor (`@hourly`, `@every 10m`), optionally
+	// prefixed by a time zone (`CRON_TZ=Europe/Berlin 0 2 * * *`).
+	Spec string
+	// Overlap is the policy applied when a run is due while the previous one still runs.
+	Overlap string
+}
+
+// Validate checks the cron expression and the overlap policy.
+func (c CronConfig) Validate() error {
+	if _, err := c.schedule(); err != nil {
+		return err
+	}
+	switch c.Overlap {
+	case OverlapSkip, OverlapQueue, OverlapKill:
+		return nil
+	default:
+		return fmt.Errorf("unknown overlap policy %q (expected %s, %s or %s)", c.Overlap, OverlapSkip, OverlapQueue, OverlapKill)
+	}
+}
+
+func (c CronConfig) schedule() (cron.Schedule, error) {
+	if c.Spec == "" {
+		return nil, errors.New("a cron expression is required")
+	}
+	schedule, err := cron.ParseStandard(c.Spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", c.Spec, err)
+	}
+	return schedule, nil
+}
+
+// Cron keeps running and launches the configured run whenever the schedule is due, until ctx is done.
+// Each run is recorded in the run history with the schedule as its trigger, failed runs are logged
+// and do not stop the schedule.
+func Cron(ctx context.Context, cfg Config, c CronConfig) error {
+	log := logger.Get("Cron").With(zap.String("cron", c.Spec), zap.String("overlap", c.Overlap))
+	if err := errors.Join(c.Validate(), validateRepeatedState(cfg)); err != nil {
+		return err
+	}
+	schedule, _ := c.schedule()
+	// every scheduled run is identical on purpose
+	cfg.History.DuplicateWindow = 0
+	cfg.History.Trigger = "cron " + c.Spec
+
+	runner := New(WithConfig(cfg), WithLogger(logger.Get("")))
+	var cancelRun context.CancelFunc
+	var done chan error
+	queued := false
+	start := func() {
+		runCtx, cancel := context.WithCancel(ctx)
+		cancelRun, done = cancel, make(chan error, 1)
+		go func() {
+			_, err := runner.Run(runCtx)
+			done <- err
+		}()
+	}
+	next := schedule.Next(time.Now())
+	log.Info("waiting for the schedule", zap.Time("next_run", next))
+	for {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if done != nil {
+				<-done
+			}
+			return nil
+		case err := <-done:
+			timer.Stop()
+			cancelRun()
+			cancelRun, done = nil, nil
+			if errors.Is(err, ErrInvalidConfig) {
+				return err
+			}
+			if err != nil && ctx.Err() == nil {
+				log.Warn("scheduled run failed", zap.Error(err))
+			}
+			if queued {
+				queued = false
+				log.Info("starting the queued run")
+				start()
+			}
+		case <-timer.C:
+			next = schedule.Next(time.Now())
+			switch {
+			case done == nil:
+				log.Info("starting the scheduled run", zap.Time("next_run", next))
+				start()
+			case c.Overlap == OverlapQueue:
+				log.Warn("previous run still running, the due run is queued", zap.Time("next_run", next))
+				queued = true
+			case c.Overlap == OverlapKill:
+				log.Warn("previous run still running, killing it", zap.Time("next_run", next))
+				cancelRun()
+				<-done
+				start()
+			default:
+				log.Warn("previous run still running, the due run is skipped", zap.Time("next_run", next))
+			}
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/FMotalleb/executor/logger"
+	"go.uber.org/zap"
+)
+
+// DaemonConfig runs the whole execution plan repeatedly in a long-lived process.
+type DaemonConfig struct {
+	// Every is the interval between the starts of consecutive runs, a run that takes longer delays the next one
+	// (runs never overlap).
+	Every time.Duration
+	// MetricsFile receives the run-level metrics after every run, in the Prometheus text format
+	// (e.g. for the textfile collector of node_exporter). Empty disables it.
+	MetricsFile string
+}
+
+// Enabled tells whether the daemon mode is requested.
+func (d DaemonConfig) Enabled() bool {
+	return d.Every > 0
+}
+
+// Validate checks the interval and the run configuration it repeats.
+func (d DaemonConfig) Validate(cfg Config) error {
+	if d.Every < 0 {
+		return errors.New("run interval cannot be negative")
+	}
+	if !d.Enabled() {
+		if d.MetricsFile != "" {
+			return errors.New("a metrics file requires a run interval")
+		}
+		return nil
+	}
+	if cfg.Consume.Enabled() || cfg.Follow || cfg.Queue.Path != "" || cfg.ControlSocket != "" {
+		return errors.New("repeated runs cannot be combined with consuming messages, following the input, a queue or a control socket")
+	}
+	return validateRepeatedState(cfg)
+}
+
+// validateRepeatedState refuses a state journal for repeated runs (--every, schedule and watch): every run
+// would resume the journal of the previous one and skip all the batches it completed.
+func validateRepeatedState(cfg Config) error {
+	if cfg.State.Path != "" {
+		return errors.New("a state journal cannot be used with repeated runs, every run after the first would skip the batches completed before")
+	}
+	return nil
+}
+
+// daemonMetrics are the run-level counters of a daemon.
+type daemonMetrics struct {
+	runs                int
+	succeeded           int
+	failed              int
+	consecutiveFailures int
+	lastStarted         time.Time
+	lastDuration        time.Duration
+	lastSuccess         time.Time
+	lastFailedBatches   int
+}
+
+// record counts a finished run, a run is successful when it was not aborted and none of its batches failed.
+func (m *daemonMetrics) record(started time.Time, report *Report, err error) bool {
+	m.runs++
+	m.lastStarted = started
+	m.lastDuration = time.Since(started)
+	m.lastFailedBatches = 0
+	if report != nil {
+		m.lastFailedBatches = report.Failed
+	}
+	ok := err == nil && report != nil && !report.Aborted && report.Failed == 0
+	if ok {
+		m.succeeded++
+		m.consecutiveFailures = 0
+		m.lastSuccess = time.Now()
+	} else {
+		m.failed++
+		m.consecutiveFailures++
+	}
+	return ok
+}
+
+func (m *daemonMetrics) fields() []zap.Field {
+	return []zap.Field{
+		zap.Int("runs", m.runs),
+		zap.Int("succeeded_runs", m.succeeded),
+		zap.Int("failed_runs", m.failed),
+		zap.Int("consecutive_failures", m.consecutiveFailures),
+		zap.Duration("last_duration", m.lastDuration),
+		zap.Int("last_failed_batches", m.lastFailedBatches),
+	}
+}
+
+// write stores the metrics in the Prometheus text format, the file is replaced atomically so a collector
+// never reads a partial file.
+func (m *daemonMetrics) write(path, name string) error {
+	labels := ""
+	if name != "" {
+		labels = fmt.Sprintf("{name=%q}", name)
+	}
+	var b strings.Builder
+	metric := func(key, kind, help string, value any) {
+		fmt.Fprintf(&b, "# HELP executor_%s %s\n# TYPE executor_%s %s\nexecutor_%s%s %v\n", key, help, key, kind, key, labels, value)
+	}
+	metric("runs_total", "counter", "Runs started by the daemon.", m.runs)
+	metric("runs_succeeded_total", "counter", "Runs finished without a failed batch.", m.succeeded)
+	metric("runs_failed_total", "counter", "Runs aborted or finished with failed batches.", m.failed)
+	metric("consecutive_failed_runs", "gauge", "Failed runs since the last successful one.", m.consecutiveFailures)
+	metric("last_run_start_timestamp_seconds", "gauge", "Start of the last run.", m.lastStarted.Unix())
+	metric("last_run_duration_seconds", "gauge", "Duration of the last run.", m.lastDuration.Seconds())
+	metric("last_run_failed_batches", "gauge", "Failed batches of the last run.", m.lastFailedBatches)
+	var lastSuccess int64
+	if !m.lastSuccess.IsZero() {
+		lastSuccess = m.lastSuccess.Unix()
+	}
+	metric("last_success_timestamp_seconds", "gauge", "End of the last successful run, zero before the first one.", lastSuccess)
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), reportFileMode); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Daemon runs the configured execution plan every d.Every until ctx is done. Failed runs are logged
+// and counted, they do not stop the daemon.
+func Daemon(ctx context.Context, cfg Config, d DaemonConfig) error {
+	log := logger.Get("Daemon").With(zap.Duration("every", d.Every))
+	if err := d.Validate(cfg); err != nil {
+		return err
+	}
+	// every run of a daemon is identical on purpose
+	cfg.History.DuplicateWindow = 0
+	cfg.History.Trigger = "every " + d.Every.String()
+	runner := New(WithConfig(cfg), WithLogger(logger.Get("")))
+
+	metrics := new(daemonMetrics)
+	for {
+		started := time.Now()
+		report, err := runner.Run(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(err, ErrInvalidConfig) {
+			return err
+		}
+		if metrics.record(started, report, err) {
+			log.Info("run finished", metrics.fields()...)
+		} else {
+			log.Warn("run failed", append(metrics.fields(), zap.Error(err))...)
+		}
+		if d.MetricsFile != "" {
+			if err := metrics.write(d.MetricsFile, cfg.Name); err != nil {
+				log.Error("failed to write run metrics", zap.Error(err))
+			}
+		}
+		next := started.Add(d.Every)
+		log.Info("waiting for the next run", zap.Time("next_run", next))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Until(next)):
+		}
+	}
+}
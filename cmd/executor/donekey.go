@@ -0,0 +1,98 @@
+package executor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// doneKeyFileMode is the permission of the marker files of completed keys.
+const doneKeyFileMode = 0o644
+
+// DoneKeyConfig holds the idempotency key of each batch and the store of completed keys.
+// A batch whose key is already in the store is skipped without spawning anything, the store is checked
+// right before a batch starts so runs sharing a store (overlapping or re-launched) never repeat a finished batch.
+type DoneKeyConfig struct {
+	// Template renders the key of a batch (e.g. `{{ .offset }}`), empty disables the check.
+	Template string
+	// Store is the directory holding one marker file per completed key.
+	Store string
+}
+
+// Validate creates the store directory.
+func (d DoneKeyConfig) Validate() error {
+	if d.Template == "" {
+		return nil
+	}
+	if d.Store == "" {
+		return errors.New("done key store is required when a done key is set")
+	}
+	if err := os.MkdirAll(d.Store, 0o755); err != nil {
+		return fmt.Errorf("failed to create done key store: %w", err)
+	}
+	return nil
+}
+
+// key renders the idempotency key of the batch, an empty key disables the check for the batch.
+// The keys of sibling batches are prefixed by their task, so the first task to finish does not skip the others.
+func (d DoneKeyConfig) key(r *ExecRequest) (string, error) {
+	if d.Template == "" {
+		return "", nil
+	}
+	key, err := r.evaluateTemplate(d.Template)
+	if err != nil {
+		return "", fmt.Errorf("failed to evaluate done key template: %w", err)
+	}
+	key = strings.TrimSpace(key)
+	if key == "" || r.Task == "" {
+		return key, nil
+	}
+	return r.Task + "/" + key, nil
+}
+
+// path of the marker file of key, keys are hashed since they may contain any character.
+func (d DoneKeyConfig) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.Store, hex.EncodeToString(sum[:]))
+}
+
+// isDone tells whether key is in the store.
+func (d DoneKeyConfig) isDone(key string) (bool, error) {
+	if key == "" {
+		return false, nil
+	}
+	_, err := os.Stat(d.path(key))
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, os.ErrNotExist):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// markDone adds key to the store, the marker is written to a temporary file and renamed
+// so a concurrent reader never sees a partial marker.
+func (d DoneKeyConfig) markDone(key string) error {
+	if key == "" {
+		return nil
+	}
+	f, err := os.CreateTemp(d.Store, ".done-*")
+	if err != nil {
+		return err
+	}
+	_, wErr := f.WriteString(key + "\n")
+	sErr := f.Sync()
+	if err := errors.Join(wErr, sErr, f.Close()); err != nil {
+		return errors.Join(err, os.Remove(f.Name()))
+	}
+	if err := os.Chmod(f.Name(), doneKeyFileMode); err != nil {
+		return errors.Join(err, os.Remove(f.Name()))
+	}
+	return os.Rename(f.Name(), d.path(key))
+}
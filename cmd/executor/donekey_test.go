@@ -0,0 +1,35 @@
+package executor
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestDoneKeyPerTask(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig(dir)
+	cfg.Tasks = []string{"import=./import {{ .offset }}", "index=./index {{ .offset }}"}
+	cfg.DoneKey = DoneKeyConfig{Template: "{{ .offset }}", Store: filepath.Join(dir, "done")}
+
+	fake := &FakeProcessRunner{Result: output}
+	report, err := New(WithConfig(cfg), WithProcessRunner(fake)).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Succeeded != 6 || report.Skipped != 0 {
+		t.Fatalf("got %d succeeded and %d skipped batches, want every task of the 3 batches to run",
+			report.Succeeded, report.Skipped)
+	}
+
+	// a second run finds the key of every task done
+	fake = &FakeProcessRunner{Result: output}
+	report, err = New(WithConfig(cfg), WithProcessRunner(fake)).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Skipped != 6 || len(fake.Processes()) != 0 {
+		t.Fatalf("got %d skipped batches and %d processes, want every batch skipped",
+			report.Skipped, len(fake.Processes()))
+	}
+}
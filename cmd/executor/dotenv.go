@@ -0,0 +1,94 @@
+package executor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envVar is a single variable read from an env file, its value is a template rendered per batch.
+type envVar struct {
+	Name  string
+	Value string
+}
+
+// loadEnvFiles parses the dotenv files in order, variables of later files override earlier ones.
+func loadEnvFiles(paths []string) ([]envVar, error) {
+	index := make(map[string]int)
+	var vars []envVar
+	for _, path := range paths {
+		parsed, err := parseEnvFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range parsed {
+			if i, ok := index[v.Name]; ok {
+				vars[i] = v
+				continue
+			}
+			index[v.Name] = len(vars)
+			vars = append(vars, v)
+		}
+	}
+	return vars, nil
+}
+
+// parseEnvFile reads `KEY=VALUE` lines, supporting comments, `export` prefixes
+// and single (literal) or double (escaped) quoted values.
+func parseEnvFile(path string) ([]envVar, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open env file: %w", err)
+	}
+	defer f.Close()
+
+	var vars []envVar
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		name, value, found := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNo)
+		}
+		value, err := parseEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		vars = append(vars, envVar{Name: name, Value: value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read env file: %w", err)
+	}
+	return vars, nil
+}
+
+func parseEnvValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	switch quote := raw[0]; quote {
+	case '\'', '"':
+		end := strings.LastIndexByte(raw, quote)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated quoted value: %s", raw)
+		}
+		value := raw[1:end]
+		if quote == '"' {
+			value = strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`).Replace(value)
+		}
+		return value, nil
+	default:
+		if i := strings.Index(raw, " #"); i >= 0 {
+			raw = strings.TrimSpace(raw[:i])
+		}
+		return raw, nil
+	}
+}
@@ -0,0 +1,181 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmailConfig sends the summary of every run by mail once it finished or was aborted.
+type EmailConfig struct {
+	// SMTP is the address (host:port) of the mail server, STARTTLS is used when the server offers it.
+	SMTP     string
+	User     string
+	Password string
+	From     string
+	To       []string
+	// AttachFailed attaches the list of failed batches as CSV.
+	AttachFailed bool
+}
+
+// Enabled tells whether summaries are mailed.
+func (c EmailConfig) Enabled() bool {
+	return c.SMTP != ""
+}
+
+// Validate checks the server address and the addresses of the sender and recipients.
+func (c EmailConfig) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(c.SMTP); err != nil {
+		return fmt.Errorf("invalid smtp address: %w", err)
+	}
+	if len(c.To) == 0 {
+		return errors.New("the summary email needs at least one recipient")
+	}
+	if _, err := mail.ParseAddress(c.From); err != nil {
+		return fmt.Errorf("invalid sender address: %w", err)
+	}
+	for _, to := range c.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return fmt.Errorf("invalid recipient address %q: %w", to, err)
+		}
+	}
+	return nil
+}
+
+// emailChannel mails the summary of the run.
+type emailChannel struct {
+	cfg EmailConfig
+}
+
+func (c *emailChannel) name() string {
+	return "email " + c.cfg.SMTP
+}
+
+func (c *emailChannel) send(_ context.Context, e Event) error {
+	if e.Event != EventRunFinished || e.Summary == nil {
+		return nil
+	}
+	msg, err := c.message(e)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if c.cfg.User != "" {
+		host, _, _ := net.SplitHostPort(c.cfg.SMTP)
+		auth = smtp.PlainAuth("", c.cfg.User, c.cfg.Password, host)
+	}
+	from, _ := mail.ParseAddress(c.cfg.From)
+	to := make([]string, 0, len(c.cfg.To))
+	for _, raw := range c.cfg.To {
+		addr, _ := mail.ParseAddress(raw)
+		to = append(to, addr.Address)
+	}
+	return smtp.SendMail(c.cfg.SMTP, auth, from.Address, to, msg)
+}
+
+// message builds the mail of the summary, with the failed batches attached as CSV if requested.
+func (c *emailChannel) message(e Event) ([]byte, error) {
+	s := e.Summary
+	vars := messageVars(e)
+	status := "finished"
+	if s.Aborted {
+		status = "aborted"
+	}
+	subject := fmt.Sprintf("executor run %s %s: %d succeeded, %d failed", vars["run"], status, s.Succeeded, s.Failed)
+
+	body := new(strings.Builder)
+	fmt.Fprintf(body, "Run:       %s\n", e.RunID)
+	if e.Name != "" {
+		fmt.Fprintf(body, "Name:      %s\n", e.Name)
+	}
+	fmt.Fprintf(body, "Host:      %s\n", e.Hostname)
+	fmt.Fprintf(body, "Status:    %s\n", status)
+	fmt.Fprintf(body, "Duration:  %s\n", vars["duration"])
+	fmt.Fprintf(body, "Succeeded: %d\n", s.Succeeded)
+	fmt.Fprintf(body, "Failed:    %d\n", s.Failed)
+	if s.Skipped != 0 {
+		fmt.Fprintf(body, "Skipped:   %d\n", s.Skipped)
+	}
+	fmt.Fprintf(body, "Attempts:  %d\n", s.Attempts)
+	codes := make([]string, 0, len(s.ExitCodes))
+	for code, count := range s.ExitCodes {
+		codes = append(codes, code+"="+strconv.Itoa(count))
+	}
+	sort.Strings(codes)
+	fmt.Fprintf(body, "Exit codes: %s\n", strings.Join(codes, " "))
+	if s.ReportPath != "" {
+		fmt.Fprintf(body, "Report:    %s\n", s.ReportPath)
+	}
+
+	msg := new(bytes.Buffer)
+	fmt.Fprintf(msg, "From: %s\r\n", c.cfg.From)
+	fmt.Fprintf(msg, "To: %s\r\n", strings.Join(c.cfg.To, ", "))
+	fmt.Fprintf(msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(msg, "Date: %s\r\n", e.Time.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	if !c.cfg.AttachFailed || len(s.failed) == 0 {
+		msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		msg.WriteString(strings.ReplaceAll(body.String(), "\n", "\r\n"))
+		return msg.Bytes(), nil
+	}
+	parts := multipart.NewWriter(msg)
+	fmt.Fprintf(msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", parts.Boundary())
+	text, err := parts.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := text.Write([]byte(strings.ReplaceAll(body.String(), "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	attachment, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":        {"text/csv; charset=utf-8"},
+		"Content-Disposition": {`attachment; filename="failed-batches.csv"`},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFailedBatches(attachment, s.failed); err != nil {
+		return nil, err
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+// writeFailedBatches writes the failed batches as CSV.
+func writeFailedBatches(w io.Writer, batches []BatchRecord) error {
+	out := csv.NewWriter(w)
+	out.UseCRLF = true
+	_ = out.Write([]string{"batch_id", "offset", "batch_size", "task", "label", "attempts", "exit_code", "error", "log_path"})
+	for _, b := range batches {
+		_ = out.Write([]string{
+			b.BatchID,
+			strconv.FormatInt(b.Offset, 10),
+			strconv.FormatInt(b.BatchSize, 10),
+			b.Task,
+			b.Label,
+			strconv.FormatUint(uint64(b.Attempts), 10),
+			strconv.Itoa(b.ExitCode),
+			b.Error,
+			b.LogPath,
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
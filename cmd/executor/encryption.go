@@ -0,0 +1,91 @@
+package executor
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+	"github.com/FMotalleb/executor/logger"
+)
+
+// LogEncryptionConfig holds the age recipients per batch log files are encrypted to.
+type LogEncryptionConfig struct {
+	// Recipients are age X25519 public keys (age1...).
+	Recipients []string
+	// RecipientsFile is a file of recipients, one per line, `#` starts a comment.
+	RecipientsFile string
+
+	recipients []age.Recipient
+}
+
+// Enabled tells whether the log files are encrypted.
+func (e *LogEncryptionConfig) Enabled() bool {
+	return len(e.Recipients) != 0 || e.RecipientsFile != ""
+}
+
+// Validate parses the recipients.
+func (e *LogEncryptionConfig) Validate() error {
+	e.recipients = nil
+	for _, raw := range e.Recipients {
+		r, err := age.ParseX25519Recipient(raw)
+		if err != nil {
+			return fmt.Errorf("invalid log encryption recipient %q: %w", raw, err)
+		}
+		e.recipients = append(e.recipients, r)
+	}
+	if e.RecipientsFile != "" {
+		f, err := os.Open(e.RecipientsFile)
+		if err != nil {
+			return fmt.Errorf("failed to open log encryption recipients: %w", err)
+		}
+		defer f.Close()
+		recipients, err := age.ParseRecipients(f)
+		if err != nil {
+			return fmt.Errorf("invalid log encryption recipients file %q: %w", e.RecipientsFile, err)
+		}
+		e.recipients = append(e.recipients, recipients...)
+	}
+	return nil
+}
+
+// openLog opens the encrypted log of the batch on first use, it is shared by all attempts
+// since an age stream cannot be appended to.
+func (e *ExecRequest) openLog() (*logger.EncryptedFile, error) {
+	if e.encryptedLog != nil {
+		return e.encryptedLog, nil
+	}
+	f, err := logger.NewEncryptedFile(e.name(), e.logRoot, e.logFileMode, e.logRecipients)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create encrypted log: %w", err)
+	}
+	e.encryptedLog = f
+	return f, nil
+}
+
+// closeLog finalizes the encrypted log of the batch, if it was opened.
+func (e *ExecRequest) closeLog() error {
+	if e.encryptedLog == nil {
+		return nil
+	}
+	err := e.encryptedLog.Close()
+	e.encryptedLog = nil
+	return err
+}
+
+// logWriter returns the per attempt writer into the batch log.
+func (e *ExecRequest) logWriter() (io.Writer, error) {
+	name := e.name()
+	switch {
+	case e.logToErr:
+		return logger.NewStdErrWriter(name), nil
+	case len(e.logRecipients) != 0:
+		f, err := e.openLog()
+		if err != nil {
+			return nil, err
+		}
+		return logger.NewWriter(name, f), nil
+	default:
+		return logger.NewFileWriter(name, e.logRoot, e.logFileMode, e.logFlush), nil
+	}
+}
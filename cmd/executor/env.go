@@ -0,0 +1,98 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// EnvConfig controls the environment of spawned processes.
+// By default processes inherit the environment of executor, with Clear (or a non-empty Keep list)
+// they only receive the variables listed in Keep.
+// Variables of the dotenv Files are added on top, their values are rendered as templates per batch.
+type EnvConfig struct {
+	Clear bool
+	Keep  []string
+	Files []string
+
+	fileVars []envVar
+}
+
+// Load reads the env files.
+func (c *EnvConfig) Load() error {
+	vars, err := loadEnvFiles(c.Files)
+	if err != nil {
+		return err
+	}
+	c.fileVars = vars
+	return nil
+}
+
+// environ builds the base environment of a spawned process.
+func (c EnvConfig) environ() []string {
+	if !c.Clear && len(c.Keep) == 0 {
+		return os.Environ()
+	}
+	env := make([]string, 0, len(c.Keep))
+	for _, name := range c.Keep {
+		name = strings.TrimSpace(name)
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// environ returns the environment of the batch process: the base environment,
+// the rendered variables of env files, the secrets, TMPDIR (with a temp directory), EXECUTOR_CONTEXT (with a context file),
+// the variables set by middlewares and the EXECUTOR_* variables describing the batch.
+func (e *ExecRequest) environ() ([]string, error) {
+	env := e.Env.environ()
+	for _, v := range e.Env.fileVars {
+		value, err := e.render(v.Value, e.getVarMap())
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate env file variable %s: %w", v.Name, err)
+		}
+		env = append(env, v.Name+"="+value)
+	}
+	for name, value := range e.secrets {
+		env = append(env, name+"="+value)
+	}
+	if e.tempDir != "" {
+		env = append(env, "TMPDIR="+e.tempDir)
+	}
+	if e.contextPath != "" {
+		env = append(env, "EXECUTOR_CONTEXT="+e.contextPath)
+	}
+	if len(e.items) != 0 {
+		env = append(env, "EXECUTOR_ITEM="+itemString(e.items[0].Value))
+	}
+	env = append(env, e.extraEnviron()...)
+	return append(
+		env,
+		"EXECUTOR_OFFSET="+strconv.FormatInt(e.Offset, 10),
+		"EXECUTOR_BATCH_SIZE="+strconv.FormatInt(e.BatchSize, 10),
+		"EXECUTOR_LIMIT="+strconv.FormatInt(e.Offset+e.BatchSize, 10),
+		"EXECUTOR_TRY="+strconv.FormatUint(uint64(e.TryCount), 10),
+		"EXECUTOR_RUN_ID="+e.RunID,
+		"EXECUTOR_RUN_NAME="+e.RunName,
+		"EXECUTOR_BATCH_ID="+e.BatchID,
+		"EXECUTOR_TASK="+e.Task,
+		"EXECUTOR_WORKER="+strconv.Itoa(e.Worker),
+		"EXECUTOR_DEADLINE="+e.formatDeadline(),
+	), nil
+}
+
+// itemString formats an input item for the environment, strings are passed verbatim and other values as JSON.
+func itemString(value any) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
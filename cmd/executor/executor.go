@@ -3,87 +3,463 @@ package executor
 import (
 	"context"
 	"errors"
+	"fmt"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/FMotalleb/executor/logger"
+	"github.com/FMotalleb/executor/state"
 	"go.uber.org/zap"
 )
 
-// StartExecution handles the initialization and management of task execution based on the provided configuration.
+// abortGracePeriod is how long an aborted run waits for its running batches to be killed and recorded.
+const abortGracePeriod = 10 * time.Second
+
+// ErrInvalidConfig is returned (wrapped) by Run when the configuration is not valid.
+var ErrInvalidConfig = errors.New("configuration is not valid")
+
+// Runner runs an execution plan, once or several times. A Runner holds everything its runs need
+// (configuration, logger, listener), so runners with different settings may run concurrently in one process.
+// Only the umask (Config.Umask) is shared by the whole process.
+type Runner struct {
+	cfg Config
+	log *zap.Logger
+	// lock guards results, the streams requested for the next run (see Results).
+	lock    sync.Mutex
+	results []chan BatchResult
+}
+
+// Option configures a Runner.
+type Option func(*Runner)
+
+// New builds a Runner, without options it runs the zero Config (which does not validate) and logs nothing.
+func New(opts ...Option) *Runner {
+	r := &Runner{log: zap.NewNop()}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// WithConfig sets the configuration of the runs, options applied afterwards may override parts of it.
+func WithConfig(cfg Config) Option {
+	return func(r *Runner) {
+		r.cfg = cfg
+	}
+}
+
+// WithLogger sets the logger of the runs, nil logs nothing.
+func WithLogger(log *zap.Logger) Option {
+	return func(r *Runner) {
+		if log == nil {
+			log = zap.NewNop()
+		}
+		r.log = log
+	}
+}
+
+// WithListener sets Config.Listener.
+func WithListener(l EventListener) Option {
+	return func(r *Runner) {
+		r.cfg.Listener = l
+	}
+}
+
+// WithRetryPolicy sets Config.RetryPolicy.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(r *Runner) {
+		r.cfg.RetryPolicy = p
+	}
+}
+
+// WithMiddleware appends middlewares to Config.Middlewares.
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(r *Runner) {
+		r.cfg.Middlewares = append(r.cfg.Middlewares, middlewares...)
+	}
+}
+
+// WithProcessRunner sets Config.ProcessRunner.
+func WithProcessRunner(p ProcessRunner) Option {
+	return func(r *Runner) {
+		r.cfg.ProcessRunner = p
+	}
+}
+
+// StartExecution runs cfg, logging through the global logger.
+//
+// Deprecated: use New(WithConfig(cfg), WithLogger(log)).Run(ctx), it does not depend on the global logger
+// and returns the report of the run.
+func StartExecution(ctx context.Context, cfg Config) error {
+	_, err := New(WithConfig(cfg), WithLogger(logger.Get(""))).Run(ctx)
+	return err
+}
+
+// Run handles the initialization and management of task execution based on the configuration of the runner.
 // It performs validation, creates worker goroutines, and processes tasks in batches until completion or cancellation.
 //
 // Parameters:
 // - ctx: A context to control the lifecycle of the execution, including cancellation or timeout.
-// - cfg: A Config object specifying execution parameters such as parallelism, batch size, retry limits, and more.
 //
 // Returns:
-// - error: If there is a configuration validation failure or premature termination due to context cancellation.
+// - *Report: The report of the run once it finished or was aborted, nil when the run did not start.
+// - error: If there is a configuration validation failure (ErrInvalidConfig) or premature termination due to context cancellation.
 //
 // Behavior:
-// - Validates the provided Config object to ensure correctness before execution starts.
+// - Validates the Config of the runner to ensure correctness before execution starts.
+// - Refuses to start when the run history holds an identical run started recently, unless forced.
+// - Compiles the configured wasm modules, transforming the variables of every attempt and deciding retries.
 // - Sets up a channel for execution requests and spawns a number of worker goroutines based on the configured parallelism.
-// - Divides tasks into batches, creating and sending ExecRequest objects through the channel.
+// - Workers may run periodic health checks, unhealthy workers are drained and optionally replaced.
+// - Divides tasks into batches (one sibling batch per configured task), drops the batches of other shards and those not matching the filter expression and orders them using the configured distribution strategy.
+// - When a state journal is configured, skips batches completed by a previous run and applies the in-flight policy.
+// - When a queue is configured, durably enqueues the planned batches (or, when resuming, takes the unacked ones) and acks each finished batch.
+// - With a shared (redis) queue, the first process plans the run and every process pulls batches from the queue.
+// - In consumer mode, each message of the broker is run as a batch and settled once its result is known.
+// - In follow mode, the items of the input source are batched and dispatched as they arrive until the input is closed.
+// - When taking a run over from another instance, waits for its running batches and dispatches the batches it handed over.
+// - With a control socket, a newer instance may take the run over, dispatching stops and the remaining batches are handed over.
+// - Sends the resulting ExecRequest objects through the channel, holding back batches until their not-before time.
 // - Continuously monitors the provided context for cancellation and performs cleanup if triggered.
 // - Waits for all worker goroutines to finish execution before returning.
+// - Logs a final summary of the run, including a histogram of exit codes across all attempts.
+// - Writes the run report (JSON and optionally Markdown) when a report path is configured, also when the run is aborted.
 // - Ensures graceful shutdown by properly closing the request channel and synchronizing goroutines.
 //
 // Notes:
 // - If the context is canceled before completion, the function terminates and returns an appropriate error.
+// - If every worker is drained by the health checks, the function returns an error instead of blocking forever.
 // - Logging is used to record the process lifecycle, including errors and successful completion.
-func StartExecution(ctx context.Context, cfg Config) error {
-	log := logger.Get("ExecutionController")
+func (r *Runner) Run(ctx context.Context) (*Report, error) {
+	cfg := r.cfg
+	log := r.log.Named("ExecutionController")
+	// the result streams end on every way out, after the workers stopped
+	results := r.takeResults()
+	defer results.Close()
 	if err := cfg.Validate(); err != nil {
-		log.Fatal(
-			"configuration is not valid",
-			zap.Any("cfg", cfg),
-			zap.Error(err),
-		)
+		log.Error("configuration is not valid", zap.Error(err))
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	if cfg.Runner != "" {
+		log.Info("using runner", zap.String("runner", cfg.Runner), zap.String("version", cfg.runnerVersion))
+	}
+	if err := applyUmask(cfg.Umask); err != nil {
+		log.Error("configuration is not valid", zap.Error(err))
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	strategy, err := GetStrategy(cfg.Strategy)
+	if err != nil {
+		log.Error("configuration is not valid", zap.Error(err))
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	runID := newRunID()
+	log = log.With(zap.String("run_id", runID))
+	if cfg.Name != "" {
+		log = log.With(zap.String("name", cfg.Name))
+	}
+	if cfg.Takeover != nil {
+		// the run is already recorded in the history, and the journal and queue are held by the old instance until it is done
+		if err := cfg.Takeover.wait(ctx, log); err != nil {
+			log.Error("failed to take the run over", zap.Error(err))
+			return nil, err
+		}
+	} else if err := cfg.History.record(log, runID, cfg); err != nil {
+		return nil, err
+	}
+	// the control socket is closed last, it tells an instance taking the run over that the journal and queue are released
+	control, err := listenControl(log, cfg.ControlSocket)
+	if err != nil {
+		log.Error("failed to open control socket", zap.Error(err))
+		return nil, err
+	}
+	defer control.Close()
+	if cfg.Name != "" && !cfg.LogToStdErr {
+		if cfg.LogDir, err = createLogDir(cfg.LogDir, cfg.Name); err != nil {
+			log.Error("failed to prepare log directory", zap.Error(err))
+			return nil, err
+		}
+	}
+	logRoot := cfg.LogDir
+	if cfg.PerRunLogDir && !cfg.LogToStdErr {
+		if cfg.LogDir, err = createLogDir(logRoot, runID); err != nil {
+			log.Error("failed to prepare log directory", zap.Error(err))
+			return nil, err
+		}
+		unlock, err := lockRunDir(cfg.LogDir)
+		if err != nil {
+			log.Error("failed to prepare log directory", zap.Error(err))
+			return nil, err
+		}
+		defer unlock()
+	}
+	secretValues, err := cfg.Secrets.Fetch(ctx)
+	if err != nil {
+		log.Error("failed to fetch secrets", zap.Error(err))
+		return nil, err
 	}
+	scripts, err := cfg.Wasm.open(ctx, log)
+	if err != nil {
+		log.Error("failed to load wasm modules", zap.Error(err))
+		return nil, err
+	}
+	defer func() {
+		if err := scripts.Close(); err != nil {
+			log.Error("failed to close wasm runtime", zap.Error(err))
+		}
+	}()
+	scripts.apply(ctx, &cfg)
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Warn("failed to resolve hostname", zap.Error(err))
+	}
+	journal, previous, err := cfg.State.open(runID)
+	if err != nil {
+		log.Error("failed to open state journal", zap.Error(err))
+		return nil, err
+	}
+	defer func() {
+		if err := journal.Close(); err != nil {
+			log.Error("failed to close state journal", zap.Error(err))
+		}
+	}()
+	run := runInfo{
+		id:             runID,
+		name:           cfg.Name,
+		hostname:       hostname,
+		secrets:        secretValues,
+		secretResolver: cfg.Secrets.NewResolver(secretValues),
+		funcs:          stateFuncs(previous),
+		processRunner:  cfg.ProcessRunner,
+	}
+	if run.processRunner == nil {
+		run.processRunner = localProcessRunner{log: r.log}
+	}
+	events := newNotifier(log, cfg, run)
+	defer events.Close()
+	plan := func() ([]*ExecRequest, error) {
+		batches, err := planRun(ctx, log, cfg, run, previous)
+		if err != nil {
+			return nil, err
+		}
+		return strategy.Arrange(batches), nil
+	}
+	var source batchSource
+	var acks batchAcker
+	total := 0
+	switch {
+	case cfg.Consume.Enabled():
+		consumer, err := openConsumer(ctx, log, cfg, run)
+		if err != nil {
+			log.Error("failed to connect to the broker", zap.Error(err))
+			return nil, err
+		}
+		defer func() {
+			if err := consumer.Close(); err != nil {
+				log.Error("failed to close the broker connection", zap.Error(err))
+			}
+		}()
+		source, acks = holdNotBefore(consumer), consumer
+	case cfg.Follow:
+		follow, err := openFollow(ctx, log, cfg, run)
+		if err != nil {
+			log.Error("failed to open input", zap.Error(err))
+			return nil, err
+		}
+		defer func() {
+			if err := follow.Close(); err != nil {
+				log.Error("failed to close input", zap.Error(err))
+			}
+		}()
+		source, acks = holdNotBefore(follow), fileQueue{}
+	case cfg.Queue.shared():
+		shared, err := openSharedQueue(ctx, log, cfg, run, plan)
+		if err != nil {
+			log.Error("failed to open shared queue", zap.Error(err))
+			return nil, err
+		}
+		defer func() {
+			if err := shared.Close(); err != nil {
+				log.Error("failed to close shared queue", zap.Error(err))
+			}
+		}()
+		source, acks = holdNotBefore(shared), shared
+	default:
+		queue, err := cfg.Queue.open()
+		if err != nil {
+			log.Error("failed to open queue", zap.Error(err))
+			return nil, err
+		}
+		defer func() {
+			if err := queue.Close(); err != nil {
+				log.Error("failed to close queue", zap.Error(err))
+			}
+		}()
+		var batches []*ExecRequest
+		if cfg.Takeover != nil {
+			batches, err = takenOver(ctx, log, cfg, run, previous)
+			batches = strategy.Arrange(batches)
+		} else if cfg.Queue.Resume {
+			batches, err = requeue(ctx, log, cfg, run, queue, previous)
+			batches = strategy.Arrange(batches)
+		} else {
+			batches, err = plan()
+			if err == nil {
+				err = cfg.Queue.enqueue(queue, batches)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		source, acks = newScheduler(batches), fileQueue{queue}
+		total = len(batches)
+	}
+
 	reqChannel := make(chan *ExecRequest)
 	wg := new(sync.WaitGroup)
 	defer close(reqChannel)
+	pool := newWorkerPool(r.log, wg, reqChannel, newHealthChecker(cfg), journal, acks, newReservations(cfg), events, cfg.Listener, results, cfg.RetryParallel)
 	for i := 0; i < cfg.Parallel; i++ {
-		go processor(wg, reqChannel)
+		pool.spawn(ctx)
 	}
-
-	begin := cfg.Offset
-	stepSize := cfg.BatchSize
-	end := cfg.Limit
-	for i := begin; i < end; i += stepSize {
-		wg.Add(1)
-		offset := i
-		limit := stepSize
-		if offset+limit > end {
-			limit = end - offset
+	pool.stats.setTotal(total)
+	if cfg.Consume.Enabled() || cfg.Follow {
+		pool.stats.limitRecords(keepBatchRecords)
+	}
+	events.notify(Event{Event: EventRunStarted, Total: total})
+	progressCtx, stopProgress := context.WithCancel(ctx)
+	defer stopProgress()
+	watchProgress(progressCtx, pool.stats)
+	// the summary and report are written on every way out, including a panic of the dispatcher
+	defer func() {
+		if p := recover(); p != nil {
+			finalize(log, cfg, runID, pool.stats, events, true)
+			panic(p)
+		}
+	}()
+	abort := func(reason string) (*Report, error) {
+		if !waitTimeout(wg, abortGracePeriod) {
+			log.Warn("some batches did not stop in time, they are missing from the report")
 		}
-		reqChannel <- &ExecRequest{
-			Command:   cfg.Command,
-			StdIn:     cfg.StdIn,
-			Offset:    offset,
-			BatchSize: limit,
+		report := finalize(log, cfg, runID, pool.stats, events, true)
+		log.Error(reason)
+		return report, errors.New(reason)
+	}
 
-			Retry: cfg.Retry,
+	for {
+		req, readyAt := source.next(time.Now())
+		if req == nil && readyAt.IsZero() {
+			break
+		}
+		// exactly one of send (a batch is ready) and wait (the next batch is held back) is set
+		var send chan<- *ExecRequest
+		var wait <-chan time.Time
+		if req != nil {
+			cfg.Listener.OnBatchQueued(*newBatchEvent(req, nil))
+			wg.Add(1)
+			send = reqChannel
+		} else {
+			log.Debug("waiting for the next scheduled batch", zap.Time("not_before", readyAt))
+			wait = time.After(time.Until(readyAt))
+		}
+		select {
+		case send <- req:
+			pool.stats.recordDispatch()
+		case <-wait:
+		case conn := <-control.requests():
+			if req != nil {
+				wg.Done()
+			}
+			remaining := source.(*scheduler).drain()
+			if req != nil {
+				remaining = append([]*ExecRequest{req}, remaining...)
+			}
+			if err := control.handOff(conn, cfg.Queue.Args, remaining); err != nil {
+				log.Error("takeover failed, dispatching goes on", zap.Error(err))
+				source = newScheduler(remaining)
+				continue
+			}
+			log.Info("run handed over, waiting for the running batches", zap.Int("handed_over", len(remaining)))
+			select {
+			case <-ctx.Done():
+				control.abandon("the old instance was stopped before its running batches finished")
+				return abort("premature execution killed by a dead context")
+			case <-asChan(wg.Wait):
+				report := finalize(log, cfg, runID, pool.stats, events, false)
+				log.Info("process finished, the run goes on in the new instance")
+				return report, nil
+			}
+		case <-pool.exhausted:
+			if req != nil {
+				wg.Done()
+			}
+			return abort("no healthy worker left to process the remaining batches")
+		case <-ctx.Done():
+			if req != nil {
+				wg.Done()
+			}
+			return abort("premature execution killed by a dead context")
+		}
+	}
 
-			Shell:     cfg.Shell,
-			ShellArgs: cfg.ShellArgs,
+	select {
+	case <-ctx.Done():
+		return abort("premature execution killed by a dead context")
+	case <-asChan(wg.Wait):
+		report := finalize(log, cfg, runID, pool.stats, events, false)
+		if cfg.PerRunLogDir {
+			collectGarbage(log, logRoot, cfg.Retention)
+		}
+		log.Info("process finished")
+		return report, nil
+	}
+}
 
-			WorkingDirectory: cfg.WorkingDirectory,
-			logRoot:          cfg.LogDir,
+// planRun plans the batches of the run and drops those of other shards, those not matching the filter
+// and those completed by a previous run, with tasks every batch is fanned out into its sibling batches first.
+func planRun(ctx context.Context, log *zap.Logger, cfg Config, run runInfo, previous *state.State) ([]*ExecRequest, error) {
+	batches, err := planBatches(ctx, cfg, run)
+	if err != nil {
+		log.Error("failed to plan batches", zap.Error(err))
+		return nil, err
+	}
+	batches = cfg.Shard.apply(log, batches)
+	if batches, err = cfg.filter.apply(log, batches); err != nil {
+		log.Error("failed to filter batches", zap.Error(err))
+		return nil, err
+	}
+	batches = cfg.fanOut(batches)
+	return cfg.State.resume(log, batches, previous)
+}
 
-			rootCtx: ctx,
-			Timeout: cfg.Timeout,
+// finalize logs the summary of the run, writes the report if requested and notifies the end of the run.
+func finalize(log *zap.Logger, cfg Config, runID string, stats *runStats, events *notifier, aborted bool) *Report {
+	stats.log(log)
+	report := stats.report(aborted)
+	report.RunID = runID
+	report.Name = cfg.Name
+	if err := cfg.Report.Write(report); err != nil {
+		log.Error("failed to write report", zap.Error(err))
+	}
+	events.runFinished(report)
+	cfg.Listener.OnRunFinished(report)
+	return report
+}
 
-			logToErr: cfg.LogToStdErr,
-		}
+// collectGarbage applies the retention policy to the per-run log directories.
+func collectGarbage(log *zap.Logger, root string, policy RetentionPolicy) {
+	if _, err := CollectGarbage(root, policy); err != nil {
+		log.Error("failed to remove old run artifacts", zap.Error(err))
 	}
+}
 
+// waitTimeout waits for the WaitGroup up to the given duration, it tells whether the group finished in time.
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
 	select {
-	case <-ctx.Done():
-		log.Error("premature execution killed by a dead context")
-		return errors.New("premature execution killed by a dead context")
 	case <-asChan(wg.Wait):
-		log.Info("process finished")
-		return nil
+		return true
+	case <-time.After(timeout):
+		return false
 	}
 }
 
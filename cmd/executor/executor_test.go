@@ -0,0 +1,207 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/FMotalleb/executor/logger"
+)
+
+// testConfig runs three batches of one item writing their logs (buffered until closed) in dir.
+func testConfig(dir string) Config {
+	return Config{
+		Shell:     "sh",
+		Command:   "echo {{ .offset }}",
+		Limit:     3,
+		BatchSize: 1,
+		Parallel:  1,
+		Timeout:   time.Minute,
+		LogDir:    dir,
+		LogFlush:  LogFlush{logger.FlushPolicy{Mode: logger.FlushSize, Size: 1 << 20}},
+		Report:    ReportConfig{Path: filepath.Join(dir, "report.json")},
+	}
+}
+
+// output writes the name of the batch to its log.
+func output(p Process) (string, int) {
+	return fmt.Sprintf("output of %s\n", p.Name), 0
+}
+
+// readReport reads the report written by a run.
+func readReport(t *testing.T, path string) *Report {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("report was not written: %v", err)
+	}
+	report := new(Report)
+	if err := json.Unmarshal(data, report); err != nil {
+		t.Fatalf("report is not valid: %v", err)
+	}
+	return report
+}
+
+// checkLogs makes sure the buffered output of every finished batch reached its log file, which only happens once
+// the log is closed.
+func checkLogs(t *testing.T, report *Report) {
+	t.Helper()
+	for _, batch := range report.Batches {
+		if !batch.Success {
+			continue
+		}
+		data, err := os.ReadFile(batch.LogPath)
+		if err != nil {
+			t.Fatalf("log of batch %s is missing: %v", batch.BatchID, err)
+		}
+		if len(data) == 0 {
+			t.Fatalf("log of batch %s was not closed, its output is missing", batch.BatchID)
+		}
+	}
+}
+
+func TestRunFinalizesWhenCancelled(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fake := &FakeProcessRunner{Result: func(p Process) (string, int) {
+		cancel()
+		return output(p)
+	}}
+	report, err := New(WithConfig(testConfig(dir)), WithProcessRunner(fake)).Run(ctx)
+	if err == nil {
+		t.Fatal("a cancelled run did not fail")
+	}
+	if report == nil || !report.Aborted {
+		t.Fatalf("a cancelled run returned %+v, want an aborted report", report)
+	}
+	written := readReport(t, filepath.Join(dir, "report.json"))
+	if !written.Aborted {
+		t.Fatal("the written report is not marked as aborted")
+	}
+	if written.Succeeded == 0 {
+		t.Fatal("the batch finished before the cancellation is missing from the report")
+	}
+	checkLogs(t, written)
+}
+
+// panicListener panics once a batch is queued after the first one, it records the report of the run.
+type panicListener struct {
+	NopListener
+	lock     sync.Mutex
+	queued   int
+	finished *Report
+}
+
+func (l *panicListener) OnBatchQueued(BatchEvent) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.queued++; l.queued > 1 {
+		panic("listener failure")
+	}
+}
+
+func (l *panicListener) OnRunFinished(r *Report) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.finished = r
+}
+
+func TestRunFinalizesOnPanic(t *testing.T) {
+	dir := t.TempDir()
+	listener := new(panicListener)
+	runner := New(WithConfig(testConfig(dir)), WithProcessRunner(&FakeProcessRunner{Result: output}), WithListener(listener))
+	func() {
+		defer func() {
+			if p := recover(); p == nil {
+				t.Fatal("the panic of the dispatcher was swallowed")
+			}
+		}()
+		_, _ = runner.Run(context.Background())
+	}()
+	listener.lock.Lock()
+	finished := listener.finished
+	listener.lock.Unlock()
+	if finished == nil || !finished.Aborted {
+		t.Fatalf("the listener was notified of %+v, want an aborted report", finished)
+	}
+	if !readReport(t, filepath.Join(dir, "report.json")).Aborted {
+		t.Fatal("the written report is not marked as aborted")
+	}
+}
+
+func TestRunSurvivesPanickingBatch(t *testing.T) {
+	dir := t.TempDir()
+	// the attempt of the first batch panics once its process exited
+	panicking := func(next ProcessFunc) ProcessFunc {
+		return func(ctx context.Context, r *ExecRequest) error {
+			err := next(ctx, r)
+			if r.Offset == 0 {
+				panic("middleware failure")
+			}
+			return err
+		}
+	}
+	report, err := New(
+		WithConfig(testConfig(dir)),
+		WithProcessRunner(&FakeProcessRunner{Result: output}),
+		WithMiddleware(panicking),
+	).Run(context.Background())
+	if err != nil {
+		t.Fatalf("a panicking batch failed the run: %v", err)
+	}
+	if report.Aborted || report.Succeeded != 2 || report.Failed != 1 {
+		t.Fatalf("got aborted %v, succeeded %d, failed %d, want 2 succeeded and 1 failed batch",
+			report.Aborted, report.Succeeded, report.Failed)
+	}
+	for _, batch := range report.Batches {
+		if batch.Offset != 0 {
+			continue
+		}
+		data, err := os.ReadFile(batch.LogPath)
+		if err != nil || len(data) == 0 {
+			t.Fatalf("log of the panicking batch was not closed: %v", err)
+		}
+	}
+	checkLogs(t, report)
+}
+
+// retryListener counts the retries of the run.
+type retryListener struct {
+	NopListener
+	lock    sync.Mutex
+	retried int
+}
+
+func (l *retryListener) OnBatchRetried(BatchEvent) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.retried++
+}
+
+func TestRunStopsRetryingWhenCancelled(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig(dir)
+	cfg.Limit = 1
+	cfg.Retry = 5
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fake := &FakeProcessRunner{Result: func(Process) (string, int) {
+		cancel()
+		return "failed\n", 1
+	}}
+	listener := new(retryListener)
+	if _, err := New(WithConfig(cfg), WithProcessRunner(fake), WithListener(listener)).Run(ctx); err == nil {
+		t.Fatal("a cancelled run did not fail")
+	}
+	listener.lock.Lock()
+	defer listener.lock.Unlock()
+	if listener.retried > 1 {
+		t.Fatalf("the batch was retried %d times after the run was cancelled", listener.retried)
+	}
+}
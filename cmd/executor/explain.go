@@ -0,0 +1,23 @@
+package executor
+
+import (
+	"context"
+	"os"
+
+	"github.com/FMotalleb/executor/input"
+	"github.com/FMotalleb/executor/template"
+)
+
+// SampleVars returns the template variables of a sample batch, used by `executor explain`.
+// An empty item leaves the input variables (item, items) out, as in runs without an input source.
+func SampleVars(offset int64, batchSize int64, item string) map[string]any {
+	hostname, _ := os.Hostname()
+	// the command is rendered by the caller, so the functions of the run are registered globally
+	template.RegisterFuncs(stateFuncs(nil))
+	run := runInfo{id: newRunID(), hostname: hostname}
+	req := newRequest(context.Background(), Config{}, run, offset, batchSize)
+	if item != "" {
+		req.items = []input.Item{{Value: item}}
+	}
+	return req.getVarMap()
+}
@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package executor
+
+import "os"
+
+// tryLockFile is a no-op, files cannot be locked on this platform.
+func tryLockFile(_ *os.File) error {
+	return nil
+}
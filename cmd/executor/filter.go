@@ -0,0 +1,64 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"go.uber.org/zap"
+)
+
+// batchFilter is a compiled filter expression (e.g. `offset % 10000 == 0 || offset > 500000`),
+// evaluated against the template variables of each planned batch.
+type batchFilter struct {
+	source  string
+	program *vm.Program
+}
+
+// compileFilter compiles a filter expression, an empty expression returns a nil filter keeping every batch.
+func compileFilter(source string) (*batchFilter, error) {
+	if source == "" {
+		return nil, nil
+	}
+	program, err := expr.Compile(source, expr.AsBool())
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter expression: %w", err)
+	}
+	return &batchFilter{source: source, program: program}, nil
+}
+
+// keep tells whether the batch matches the filter.
+func (f *batchFilter) keep(r *ExecRequest) (bool, error) {
+	if f == nil {
+		return true, nil
+	}
+	out, err := expr.Run(f.program, r.getVarMap())
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate filter for batch %s: %w", r.name(), err)
+	}
+	return out.(bool), nil
+}
+
+// apply drops the batches not matching the filter.
+func (f *batchFilter) apply(log *zap.Logger, batches []*ExecRequest) ([]*ExecRequest, error) {
+	if f == nil {
+		return batches, nil
+	}
+	kept := batches[:0]
+	for _, r := range batches {
+		ok, err := f.keep(r)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			kept = append(kept, r)
+		}
+	}
+	log.Info(
+		"filtered batches",
+		zap.String("filter", f.source),
+		zap.Int("kept", len(kept)),
+		zap.Int("dropped", len(batches)-len(kept)),
+	)
+	return kept, nil
+}
@@ -0,0 +1,137 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/FMotalleb/executor/input"
+	"go.uber.org/zap"
+)
+
+const (
+	// followWait is how long the dispatcher waits for the first item of a batch before it checks the run again.
+	followWait = time.Second
+	// followLinger is how long a partial batch waits for more items before it is dispatched anyway.
+	followLinger = 200 * time.Millisecond
+)
+
+// followSource streams the items of the input source into batches as they arrive, instead of reading
+// the whole input before planning. A batch is dispatched once it is full or no further item arrived
+// within followLinger, the run ends when the input is closed.
+type followSource struct {
+	ctx   context.Context
+	log   *zap.Logger
+	cfg   Config
+	run   runInfo
+	src   input.Source
+	items chan input.Item
+	// offset is the index of the next item read from the input.
+	offset int64
+}
+
+// openFollow opens the input source and starts reading it in the background.
+func openFollow(ctx context.Context, log *zap.Logger, cfg Config, run runInfo) (*followSource, error) {
+	src, err := cfg.Input.Open()
+	if err != nil {
+		return nil, err
+	}
+	f := &followSource{
+		ctx:   ctx,
+		log:   log,
+		cfg:   cfg,
+		run:   run,
+		src:   src,
+		items: make(chan input.Item, cfg.BatchSize),
+	}
+	go f.read()
+	log.Info("following the input, batches are dispatched as items arrive")
+	return f, nil
+}
+
+// read feeds the items of the source to the dispatcher until the source is exhausted.
+func (f *followSource) read() {
+	defer close(f.items)
+	for {
+		item, err := f.src.Next(f.ctx)
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			if f.ctx.Err() == nil {
+				f.log.Error("failed to read input, no further item is dispatched", zap.Error(err))
+			}
+			return
+		}
+		select {
+		case f.items <- item:
+		case <-f.ctx.Done():
+			return
+		}
+	}
+}
+
+// next collects the next batch, once the input is closed and every item was handed out it returns nil and the zero time.
+func (f *followSource) next(now time.Time) (*ExecRequest, time.Time) {
+	var chunk []input.Item
+	timer := time.NewTimer(followWait)
+	defer timer.Stop()
+	for int64(len(chunk)) < f.cfg.BatchSize {
+		select {
+		case item, ok := <-f.items:
+			if !ok {
+				if len(chunk) == 0 {
+					return nil, time.Time{}
+				}
+				return f.emit(chunk)
+			}
+			chunk = append(chunk, item)
+			timer.Reset(followLinger)
+		case <-timer.C:
+			if len(chunk) == 0 {
+				return nil, time.Now()
+			}
+			return f.emit(chunk)
+		case <-f.ctx.Done():
+			return nil, now.Add(followWait)
+		}
+	}
+	return f.emit(chunk)
+}
+
+// emit hands out the batch of the items, a dropped batch lets the dispatcher ask again right away.
+func (f *followSource) emit(chunk []input.Item) (*ExecRequest, time.Time) {
+	if req := f.batch(chunk); req != nil {
+		return req, time.Time{}
+	}
+	return nil, time.Now()
+}
+
+// batch builds the request of the items, batches of other shards or not matching the filter are dropped (nil).
+func (f *followSource) batch(chunk []input.Item) *ExecRequest {
+	req := newRequest(f.ctx, f.cfg, f.run, f.offset, int64(len(chunk)))
+	f.offset += int64(len(chunk))
+	req.items = chunk
+	if err := req.evaluate(f.cfg); err != nil {
+		f.log.Error("batch is not processed", zap.Int64("offset", req.Offset), zap.Error(err))
+		return nil
+	}
+	if !f.cfg.Shard.owns(req) {
+		return nil
+	}
+	keep, err := f.cfg.filter.keep(req)
+	if err != nil {
+		f.log.Error("failed to filter batch, batch is not processed", zap.Int64("offset", req.Offset), zap.Error(err))
+		return nil
+	}
+	if !keep {
+		return nil
+	}
+	return req
+}
+
+// Close releases the input source.
+func (f *followSource) Close() error {
+	return f.src.Close()
+}
@@ -0,0 +1,84 @@
+package executor
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/FMotalleb/executor/state"
+)
+
+// FindGaps returns the parts of the given ranges that no recorded run of the state journal completed successfully.
+// Gaps are computed per task, an offset is only complete once every task completed it. The tasks are the ones
+// recorded in the journal and the given ones (which may never have run at all).
+func FindGaps(statePath string, ranges RangeList, tasks []string) (RangeList, error) {
+	st, err := state.Load(statePath)
+	if err != nil {
+		return nil, err
+	}
+	completed := make(map[string]RangeList)
+	for _, task := range tasks {
+		completed[task] = nil
+	}
+	for _, group := range []map[state.BatchID]state.Record{st.Completed, st.Failed, st.InFlight} {
+		for id := range group {
+			if _, ok := completed[id.Task]; !ok {
+				completed[id.Task] = nil
+			}
+		}
+	}
+	if len(completed) == 0 {
+		// nothing was recorded, the ranges are gaps as a whole
+		completed[""] = nil
+	}
+	for id := range st.Completed {
+		completed[id.Task] = append(completed[id.Task], Range{Begin: id.Offset, End: id.Offset + id.BatchSize})
+	}
+
+	var gaps RangeList
+	for _, r := range ranges {
+		var missing RangeList
+		for _, done := range completed {
+			missing = append(missing, subtractRanges(r, mergeRanges(done))...)
+		}
+		gaps = append(gaps, mergeRanges(missing)...)
+	}
+	return gaps, nil
+}
+
+// mergeRanges sorts the ranges and merges the overlapping or adjacent ones.
+func mergeRanges(ranges RangeList) RangeList {
+	slices.SortFunc(ranges, func(a, b Range) int {
+		return cmp.Compare(a.Begin, b.Begin)
+	})
+	var merged RangeList
+	for _, r := range ranges {
+		if n := len(merged); n != 0 && r.Begin <= merged[n-1].End {
+			merged[n-1].End = max(merged[n-1].End, r.End)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// subtractRanges returns the parts of r not covered by the sorted, merged ranges in covered.
+func subtractRanges(r Range, covered RangeList) RangeList {
+	var result RangeList
+	cursor := r.Begin
+	for _, c := range covered {
+		if c.End <= cursor {
+			continue
+		}
+		if c.Begin >= r.End {
+			break
+		}
+		if c.Begin > cursor {
+			result = append(result, Range{Begin: cursor, End: c.Begin})
+		}
+		cursor = c.End
+	}
+	if cursor < r.End {
+		result = append(result, Range{Begin: cursor, End: r.End})
+	}
+	return result
+}
@@ -0,0 +1,46 @@
+package executor
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/FMotalleb/executor/state"
+)
+
+func TestFindGapsPerTask(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.state")
+	journal, err := state.Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []state.Record{
+		{Event: state.EventDone, Offset: 0, BatchSize: 10, Task: "import"},
+		{Event: state.EventDone, Offset: 0, BatchSize: 5, Task: "index"},
+		{Event: state.EventDone, Offset: 10, BatchSize: 10, Task: "index"},
+	} {
+		if err := journal.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := journal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	gaps, err := FindGaps(path, RangeList{{Begin: 0, End: 20}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (RangeList{{Begin: 5, End: 20}}); !slices.Equal(gaps, want) {
+		t.Fatalf("got gaps %v, want %v", gaps, want)
+	}
+
+	// a task that never ran misses the whole range
+	gaps, err = FindGaps(path, RangeList{{Begin: 0, End: 20}}, []string{"notify"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (RangeList{{Begin: 0, End: 20}}); !slices.Equal(gaps, want) {
+		t.Fatalf("got gaps %v, want %v", gaps, want)
+	}
+}
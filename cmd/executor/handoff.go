@@ -0,0 +1,285 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/FMotalleb/executor/input"
+	"github.com/FMotalleb/executor/queue"
+	"github.com/FMotalleb/executor/state"
+	"go.uber.org/zap"
+)
+
+// takeoverRequestTimeout bounds how long a connection to the control socket may take to send its request.
+const takeoverRequestTimeout = 10 * time.Second
+
+// Handoff protocol, JSON messages over the unix control socket of the running instance:
+// the new instance sends a takeoverRequest, the running one stops dispatching and answers with the batches
+// it did not hand out yet (handoffMessage), then finishes its running batches, closes the state journal and
+// queue and sends a final message with Done set. Only then the new instance opens them and starts dispatching.
+
+// takeoverRequest is sent by the instance taking the run over.
+type takeoverRequest struct {
+	Version string `json:"version,omitempty"`
+	// AllowVersionChange takes over a run of another major version of executor.
+	AllowVersionChange bool `json:"allow_version_change,omitempty"`
+}
+
+// handoffMessage is sent by the instance handing the run over.
+type handoffMessage struct {
+	// Version is the executor version of the running instance.
+	Version string `json:"version,omitempty"`
+	// Args are the command line arguments of the run.
+	Args    []string       `json:"args,omitempty"`
+	Batches []handoffBatch `json:"batches,omitempty"`
+	// Done is sent once the running batches finished and the state journal and queue were closed.
+	Done  bool   `json:"done,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// handoffBatch is a batch that was planned but not dispatched by the instance handing the run over.
+type handoffBatch struct {
+	Offset    int64        `json:"offset"`
+	BatchSize int64        `json:"batch_size"`
+	Task      string       `json:"task,omitempty"`
+	Items     []input.Item `json:"items,omitempty"`
+}
+
+// controlSocket accepts a single takeover on a unix socket, a nil control socket never receives one.
+type controlSocket struct {
+	log       *zap.Logger
+	listener  net.Listener
+	takeovers chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+	// conn is the connection of the instance the run was handed over to, it is told once this instance is done.
+	conn net.Conn
+}
+
+// listenControl listens on the control socket at path, an empty path returns nil.
+// A stale socket left by a crashed instance is replaced, one another instance still listens on is refused.
+func listenControl(log *zap.Logger, path string) (*controlSocket, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("another executor instance listens on control socket %s", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove stale control socket: %w", err)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket: %w", err)
+	}
+	c := &controlSocket{
+		log:       log.With(zap.String("control_socket", path)),
+		listener:  listener,
+		takeovers: make(chan net.Conn),
+		done:      make(chan struct{}),
+	}
+	go c.accept()
+	return c, nil
+}
+
+// accept hands the connections sending a takeover request to the dispatcher.
+func (c *controlSocket) accept() {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			return
+		}
+		var req takeoverRequest
+		_ = conn.SetReadDeadline(time.Now().Add(takeoverRequestTimeout))
+		if err := json.NewDecoder(conn).Decode(&req); err != nil {
+			c.log.Warn("invalid takeover request", zap.Error(err))
+			_ = conn.Close()
+			continue
+		}
+		_ = conn.SetReadDeadline(time.Time{})
+		c.log.Info("takeover requested", zap.String("version", req.Version))
+		if err := req.check(); err != nil {
+			c.log.Warn("takeover refused", zap.Error(err))
+			_ = json.NewEncoder(conn).Encode(handoffMessage{Error: err.Error()})
+			_ = conn.Close()
+			continue
+		}
+		select {
+		case c.takeovers <- conn:
+		case <-c.done:
+			_ = json.NewEncoder(conn).Encode(handoffMessage{Error: "the run is finishing, there is nothing left to hand over"})
+			_ = conn.Close()
+		}
+	}
+}
+
+// check refuses a takeover by another major version of executor, whose scheduling may differ, unless allowed.
+func (r takeoverRequest) check() error {
+	current := binaryVersion()
+	if r.AllowVersionChange || r.Version == "" || current == "" || majorVersion(r.Version) == majorVersion(current) {
+		return nil
+	}
+	return fmt.Errorf(
+		"executor %s cannot take over a run of executor %s (another major version) unless --allow-version-change is given",
+		r.Version,
+		current,
+	)
+}
+
+// requests returns the channel of takeover connections, nil (never ready) without a control socket.
+func (c *controlSocket) requests() <-chan net.Conn {
+	if c == nil {
+		return nil
+	}
+	return c.takeovers
+}
+
+// handOff sends the run to the instance taking it over and stops listening, so the new instance can listen
+// on the control socket once it starts. On failure the connection is dropped and this instance goes on dispatching.
+func (c *controlSocket) handOff(conn net.Conn, args []string, batches []*ExecRequest) error {
+	msg := handoffMessage{Version: binaryVersion(), Args: args, Batches: make([]handoffBatch, 0, len(batches))}
+	for _, r := range batches {
+		msg.Batches = append(msg.Batches, handoffBatch{Offset: r.Offset, BatchSize: r.BatchSize, Task: r.Task, Items: r.items})
+	}
+	if err := json.NewEncoder(conn).Encode(msg); err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("failed to hand the run over: %w", err)
+	}
+	c.conn = conn
+	close(c.done)
+	if err := c.listener.Close(); err != nil {
+		c.log.Warn("failed to close control socket", zap.Error(err))
+	}
+	return nil
+}
+
+// abandon tells the instance the run was handed over to that this one stopped before its running batches finished.
+func (c *controlSocket) abandon(reason string) {
+	if c.conn == nil {
+		return
+	}
+	_ = json.NewEncoder(c.conn).Encode(handoffMessage{Error: reason})
+	_ = c.conn.Close()
+	c.conn = nil
+}
+
+// Close stops listening, once the run was handed over it tells the new instance that this one is done.
+// It must be called after the state journal and the queue were closed.
+func (c *controlSocket) Close() {
+	if c == nil {
+		return
+	}
+	c.closeOnce.Do(func() {
+		_ = c.listener.Close()
+		if c.conn == nil {
+			close(c.done)
+			return
+		}
+		if err := json.NewEncoder(c.conn).Encode(handoffMessage{Done: true}); err != nil {
+			c.log.Error("failed to tell the new instance the run was handed over", zap.Error(err))
+		}
+		_ = c.conn.Close()
+	})
+}
+
+// Handoff is a run taken over from a running executor instance, see Takeover.
+type Handoff struct {
+	// Args are the command line arguments of the run, to be parsed into the configuration of this instance.
+	Args    []string
+	socket  string
+	version string
+	batches []handoffBatch
+	conn    net.Conn
+	decoder *json.Decoder
+}
+
+// Takeover asks the instance listening on the control socket to stop dispatching and hand its run over.
+// The returned handoff holds the arguments of the run, it is started by a Runner (Config.Takeover),
+// which waits for the running batches of the old instance before dispatching the remaining ones.
+// Unless allowVersionChange is set, the running instance refuses a takeover by another major version.
+func Takeover(ctx context.Context, socket string, allowVersionChange bool) (*Handoff, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to control socket: %w", err)
+	}
+	if err := json.NewEncoder(conn).Encode(takeoverRequest{Version: binaryVersion(), AllowVersionChange: allowVersionChange}); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to request takeover: %w", err)
+	}
+	h := &Handoff{socket: socket, conn: conn, decoder: json.NewDecoder(conn)}
+	msg, err := h.receive(ctx)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	h.Args, h.version, h.batches = msg.Args, msg.Version, msg.Batches
+	return h, nil
+}
+
+// receive reads the next message of the instance handing the run over.
+func (h *Handoff) receive(ctx context.Context) (handoffMessage, error) {
+	stop := context.AfterFunc(ctx, func() {
+		_ = h.conn.Close()
+	})
+	defer stop()
+	var msg handoffMessage
+	if err := h.decoder.Decode(&msg); err != nil {
+		if ctx.Err() != nil {
+			return msg, ctx.Err()
+		}
+		return msg, fmt.Errorf("instance on control socket %s went away during the takeover: %w", h.socket, err)
+	}
+	if msg.Error != "" {
+		return msg, fmt.Errorf("instance on control socket %s: %s", h.socket, msg.Error)
+	}
+	return msg, nil
+}
+
+// wait blocks until the old instance finished its running batches and released the state journal and queue.
+func (h *Handoff) wait(ctx context.Context, log *zap.Logger) error {
+	defer h.conn.Close()
+	log.Info(
+		"waiting for the running batches of the old instance",
+		zap.String("control_socket", h.socket),
+		zap.String("version", h.version),
+	)
+	for {
+		msg, err := h.receive(ctx)
+		if err != nil {
+			return err
+		}
+		if msg.Done {
+			return nil
+		}
+	}
+}
+
+// takenOver rebuilds the batches handed over by the old instance,
+// those the state journal knows to be completed are dropped.
+func takenOver(ctx context.Context, log *zap.Logger, cfg Config, run runInfo, previous *state.State) ([]*ExecRequest, error) {
+	h := cfg.Takeover
+	log.Info("taking over the batches of the old instance", zap.String("control_socket", h.socket), zap.Int("count", len(h.batches)))
+	batches := make([]*ExecRequest, 0, len(h.batches))
+	for _, b := range h.batches {
+		req, err := dequeued(ctx, cfg, run, queue.Entry{Offset: b.Offset, BatchSize: b.BatchSize, Items: b.Items})
+		if err != nil {
+			log.Error("failed to plan batches", zap.Error(err))
+			return nil, err
+		}
+		if b.Task != "" {
+			if err := req.assignTask(cfg, b.Task); err != nil {
+				return nil, err
+			}
+		}
+		batches = append(batches, req)
+	}
+	return cfg.State.resume(log, batches, previous)
+}
@@ -0,0 +1,130 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	healthCheckTimeout = 10 * time.Second
+	// replacementsPerWorker caps the replacements of unhealthy workers to this many per worker of the pool.
+	replacementsPerWorker = 3
+	// replacementBackoff is the delay before the first replacement starts, doubled on every replacement.
+	replacementBackoff = time.Second
+	// maxReplacementBackoff caps the delay before a replacement starts.
+	maxReplacementBackoff = time.Minute
+)
+
+// healthChecker runs the periodic worker self-checks.
+// A worker that fails any of these checks is considered unhealthy, stops taking new batches
+// and (if configured) gets replaced by a fresh worker. Replacements start after a growing backoff and are
+// capped per run, so a host that keeps failing the checks does not spawn workers forever.
+type healthChecker struct {
+	interval   time.Duration
+	replace    bool
+	shell      string
+	shellArgs  []string
+	scratchDir string
+	// maxReplacements caps the replacements of the run.
+	maxReplacements int
+
+	lock     sync.Mutex
+	replaced int
+}
+
+func newHealthChecker(cfg Config) *healthChecker {
+	if cfg.HealthCheckInterval <= 0 {
+		return nil
+	}
+	scratch := cfg.LogDir
+	if cfg.LogToStdErr || scratch == "" {
+		scratch = os.TempDir()
+	}
+	if cfg.TempDir != "" {
+		scratch = cfg.TempDir
+	}
+	return &healthChecker{
+		interval:        cfg.HealthCheckInterval,
+		replace:         cfg.ReplaceUnhealthy,
+		shell:           cfg.Shell,
+		shellArgs:       cfg.ShellArgs,
+		scratchDir:      scratch,
+		maxReplacements: max(cfg.Parallel, 1) * replacementsPerWorker,
+	}
+}
+
+// ticker returns a channel that fires on each check interval, or nil (blocks forever) if checks are disabled.
+func (h *healthChecker) ticker() (<-chan time.Time, func()) {
+	if h == nil {
+		return nil, func() {}
+	}
+	t := time.NewTicker(h.interval)
+	return t.C, t.Stop
+}
+
+// check runs every self-check and returns the first failure.
+func (h *healthChecker) check(ctx context.Context) error {
+	if h == nil {
+		return nil
+	}
+	if err := h.checkSpawn(ctx); err != nil {
+		return fmt.Errorf("cannot spawn a trivial process: %w", err)
+	}
+	if err := h.checkScratchDir(); err != nil {
+		return fmt.Errorf("scratch directory is not writable: %w", err)
+	}
+	return nil
+}
+
+func (h *healthChecker) checkSpawn(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	// an empty script is a no-op for shells and language runners alike
+	args := append(append([]string{}, h.shellArgs...), "")
+	proc := exec.CommandContext(ctx, h.shell, args...)
+	setShellCommandLine(proc)
+	return proc.Run()
+}
+
+func (h *healthChecker) checkScratchDir() error {
+	f, err := os.CreateTemp(h.scratchDir, ".executor-health-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	_, wErr := f.WriteString("ok")
+	cErr := f.Close()
+	rErr := os.Remove(name)
+	return errors.Join(wErr, cErr, rErr)
+}
+
+// report logs the result of a failed check and tells whether the worker should be replaced,
+// and after which delay.
+func (h *healthChecker) report(log *zap.Logger, worker int, err error) (time.Duration, bool) {
+	h.lock.Lock()
+	replace := h.replace && h.replaced < h.maxReplacements
+	var delay time.Duration
+	if replace {
+		delay = min(replacementBackoff<<min(h.replaced, 16), maxReplacementBackoff)
+		h.replaced++
+	}
+	h.lock.Unlock()
+	log.Error(
+		"worker marked unhealthy, draining",
+		zap.Int("worker", worker),
+		zap.Bool("replace", replace),
+		zap.Duration("replace_in", delay),
+		zap.Error(err),
+	)
+	if h.replace && !replace {
+		log.Warn("too many unhealthy workers were replaced, the pool shrinks", zap.Int("replaced", h.maxReplacements))
+	}
+	return delay, replace
+}
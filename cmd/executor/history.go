@@ -0,0 +1,142 @@
+package executor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/FMotalleb/executor/history"
+	"github.com/FMotalleb/executor/input"
+	"go.uber.org/zap"
+)
+
+// Duplicate run policies, decide what happens when an identical run started within the duplicate window.
+const (
+	// OnDuplicateWarn logs a warning and starts the run.
+	OnDuplicateWarn = "warn"
+	// OnDuplicateFail refuses to start the run unless forced.
+	OnDuplicateFail = "fail"
+)
+
+// DefaultHistoryRetention is how long runs are kept in the history when duplicate detection is disabled,
+// otherwise they are kept for the duplicate window.
+const DefaultHistoryRetention = 24 * time.Hour
+
+// HistoryConfig controls the run history used to detect accidental duplicate runs.
+type HistoryConfig struct {
+	// Path of the history file, empty disables the history.
+	Path string
+	// DuplicateWindow is how far back an identical run counts as a duplicate, zero disables the check.
+	DuplicateWindow time.Duration
+	// OnDuplicate is the policy applied to a duplicate run.
+	OnDuplicate string
+	// Force starts the run even if the policy refuses duplicates.
+	Force bool
+	// Trigger is what launched the run (e.g. its cron schedule), recorded in the history.
+	Trigger string
+}
+
+// Validate checks the duplicate policy.
+func (h HistoryConfig) Validate() error {
+	if h.DuplicateWindow < 0 {
+		return errors.New("duplicate window cannot be negative")
+	}
+	switch h.OnDuplicate {
+	case "", OnDuplicateWarn, OnDuplicateFail:
+		return nil
+	default:
+		return fmt.Errorf("unknown duplicate policy %q (expected %s or %s)", h.OnDuplicate, OnDuplicateWarn, OnDuplicateFail)
+	}
+}
+
+// record checks the history for a recent run with the same configuration and adds this run to it.
+// Resuming with a state journal or from a queue is never a duplicate since completed batches are skipped,
+// neither is a restarted consumer.
+// Failing to read or write the history only logs a warning.
+func (h HistoryConfig) record(log *zap.Logger, runID string, cfg Config) error {
+	if h.Path == "" {
+		return nil
+	}
+	now := time.Now().UTC()
+	entry := history.Entry{
+		RunID:      runID,
+		Name:       cfg.Name,
+		ConfigHash: cfg.hash(),
+		Range:      cfg.rangeSummary(),
+		StartedAt:  now,
+		Trigger:    h.Trigger,
+	}
+	if h.DuplicateWindow > 0 && cfg.State.Path == "" && !cfg.Queue.Resume && !cfg.Consume.Enabled() && !cfg.Follow {
+		entries, err := history.Read(h.Path)
+		if err != nil {
+			log.Warn("failed to read run history, duplicate runs are not detected", zap.Error(err))
+		}
+		if previous, ok := history.Recent(entries, entry.ConfigHash, h.DuplicateWindow, now); ok {
+			fields := []zap.Field{
+				zap.String("previous_run_id", previous.RunID),
+				zap.Time("previous_started_at", previous.StartedAt),
+				zap.String("range", previous.Range),
+			}
+			if h.OnDuplicate == OnDuplicateFail && !h.Force {
+				log.Error("an identical run started recently, use --force to run it again", fields...)
+				return fmt.Errorf("identical run %s started at %s", previous.RunID, previous.StartedAt.Format(time.RFC3339))
+			}
+			log.Warn("an identical run started recently", fields...)
+		}
+	}
+	retention := h.DuplicateWindow
+	if retention == 0 {
+		retention = DefaultHistoryRetention
+	}
+	if err := history.Append(h.Path, entry, retention); err != nil {
+		log.Warn("failed to record the run in the history", zap.Error(err))
+	}
+	return nil
+}
+
+// hash identifies the resolved configuration, runs with the same hash do the same work.
+func (c *Config) hash() string {
+	resolved := struct {
+		Shell            string
+		ShellArgs        []string
+		Command          string
+		Tasks            []string
+		StdIn            string
+		WorkingDirectory string
+		Env              EnvConfig
+		Input            input.Config
+		Consume          string
+		Ranges           RangeList
+		Offset, Limit    int64
+		BatchSize, Step  int64
+		Align            int64
+		Shard            Shard
+		Filter           string
+	}{
+		c.Shell, c.ShellArgs, c.Command, c.Tasks, c.StdIn, c.WorkingDirectory, c.Env, c.Input, c.Consume.URL,
+		c.Ranges, c.Offset, c.Limit, c.BatchSize, c.Step, c.Align, c.Shard, c.Filter,
+	}
+	data, _ := json.Marshal(resolved)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// rangeSummary describes the processed offsets (or input) of the run.
+func (c *Config) rangeSummary() string {
+	switch {
+	case c.Consume.Enabled():
+		return "consume"
+	case c.Follow:
+		return "follow"
+	case c.Input.Enabled():
+		return "input"
+	case len(c.Ranges) != 0:
+		return c.Ranges.String()
+	default:
+		return strconv.FormatInt(c.Offset, 10) + ":" + strconv.FormatInt(c.Limit, 10)
+	}
+}
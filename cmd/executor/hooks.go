@@ -0,0 +1,76 @@
+package executor
+
+import (
+	"context"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// hookOutputLimit is the number of trailing bytes of the hook output kept in the executor log.
+const hookOutputLimit = 4096
+
+// BatchHooks are commands (templates over the batch variables) run once the result of a batch is known.
+// They run with the shell, working directory and environment of the batch, their failure is logged
+// and does not change the result of the batch.
+type BatchHooks struct {
+	// OnFailure runs after a batch exhausted its retries, with `.exitCode`, `.error` and `.logPath` added to the variables.
+	OnFailure string
+	// OnSuccess runs after each successful batch, with `.duration`, `.attempts` and `.logPath` added to the variables.
+	OnSuccess string
+}
+
+// runHook evaluates the hook template with the batch variables (plus extra) and runs it, an empty template is a no-op.
+func (e *ExecRequest) runHook(ctx context.Context, log *zap.Logger, event, tmpl string, extra map[string]any) {
+	if tmpl == "" {
+		return
+	}
+	log = log.With(zap.String("batch", e.name()), zap.String("hook", event))
+	vars := e.getVarMap()
+	vars["logPath"] = e.logPath()
+	for name, value := range extra {
+		vars[name] = value
+	}
+	command, err := e.render(tmpl, vars)
+	if err != nil {
+		log.Error("failed to evaluate hook template", zap.Error(err))
+		return
+	}
+	env, err := e.environ()
+	if err != nil {
+		log.Error("failed to build hook environment", zap.Error(err))
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, e.Timeout)
+	defer cancel()
+	proc := exec.CommandContext(ctx, e.Shell, append(slices.Clone(e.ShellArgs), command)...)
+	proc.Dir = e.WorkingDirectory
+	proc.Env = append(env, "EXECUTOR_HOOK="+event)
+	setShellCommandLine(proc)
+	out, err := proc.CombinedOutput()
+	output := strings.TrimSpace(string(out[max(len(out)-hookOutputLimit, 0):]))
+	if err != nil {
+		log.Error("batch hook failed", zap.Error(err), zap.String("output", output))
+		return
+	}
+	log.Debug("batch hook finished", zap.String("output", output))
+}
+
+// runFailureHook runs the failure hook of a batch that exhausted its retries.
+func (e *ExecRequest) runFailureHook(ctx context.Context, log *zap.Logger, err error) {
+	e.runHook(ctx, log, "failure", e.hooks.OnFailure, map[string]any{
+		"exitCode": exitCodeOf(err),
+		"error":    err.Error(),
+	})
+}
+
+// runSuccessHook runs the success hook of a batch that finished successfully after the given time.
+func (e *ExecRequest) runSuccessHook(ctx context.Context, log *zap.Logger, duration time.Duration) {
+	e.runHook(ctx, log, "success", e.hooks.OnSuccess, map[string]any{
+		"duration": duration,
+		"attempts": e.TryCount + 1,
+	})
+}
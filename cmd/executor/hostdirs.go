@@ -0,0 +1,57 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/FMotalleb/executor/template"
+)
+
+// hostDirVars are the variables of the log and temp directory templates, they identify the node
+// so nodes of a sharded run sharing a file system (e.g. NFS) do not write into each other's directories.
+func (c *Config) hostDirVars() map[string]any {
+	hostname, _ := os.Hostname()
+	return map[string]any{
+		"hostname":   hostname,
+		"pid":        os.Getpid(),
+		"name":       c.Name,
+		"shard":      c.Shard.String(),
+		"shardIndex": c.Shard.Index,
+		"shardCount": c.Shard.Count,
+	}
+}
+
+// renderHostDirs evaluates the log and temp directory templates, directories whose path is a template
+// are created since they usually differ on every node. Paths are cleaned to the separators of the platform,
+// so log paths written with slashes (e.g. in a template) are consistent on windows.
+func (c *Config) renderHostDirs() error {
+	vars := c.hostDirVars()
+	for _, dir := range []*string{&c.LogDir, &c.TempDir} {
+		if !strings.Contains(*dir, "{{") {
+			if *dir != "" {
+				*dir = filepath.Clean(*dir)
+			}
+			continue
+		}
+		rendered, err := template.EvaluateTemplate(*dir, vars)
+		if err != nil {
+			return fmt.Errorf("failed to evaluate directory template %q: %w", *dir, err)
+		}
+		*dir = filepath.Clean(strings.TrimSpace(rendered))
+		if err := os.MkdirAll(*dir, runDirMode); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+	}
+	if c.TempDir != "" {
+		info, err := os.Stat(c.TempDir)
+		if err != nil {
+			return fmt.Errorf("temp directory does not exist: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("temp directory %s is not a directory", c.TempDir)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package executor
+
+import "os/exec"
+
+// processJob is a no-op, Job Objects are a windows feature.
+type processJob struct{}
+
+func newProcessJob(_ *exec.Cmd, _ bool) (*processJob, error) {
+	return &processJob{}, nil
+}
+
+func (j *processJob) assign(_ int) error {
+	return nil
+}
+
+func (j *processJob) close() {}
@@ -0,0 +1,99 @@
+//go:build windows
+
+package executor
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// processJob is a Job Object holding the process tree of a batch: windows has no process groups, so
+// without it a timeout (or cancellation) would only kill the shell and leave its children running.
+type processJob struct {
+	handle windows.Handle
+}
+
+// newProcessJob creates the job of the process and makes cancelling the process terminate the whole job.
+// With killOnClose, the processes of the job are killed once executor dies (or the batch ended).
+// The process is started suspended, so it cannot spawn a child outside the job before assign resumes it.
+func newProcessJob(proc *exec.Cmd, killOnClose bool) (*processJob, error) {
+	handle, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job object: %w", err)
+	}
+	if killOnClose {
+		info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{}
+		info.BasicLimitInformation.LimitFlags = windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE
+		if _, err := windows.SetInformationJobObject(
+			handle,
+			windows.JobObjectExtendedLimitInformation,
+			uintptr(unsafe.Pointer(&info)),
+			uint32(unsafe.Sizeof(info)),
+		); err != nil {
+			_ = windows.CloseHandle(handle)
+			return nil, fmt.Errorf("failed to configure job object: %w", err)
+		}
+	}
+	j := &processJob{handle: handle}
+	if proc.SysProcAttr == nil {
+		proc.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	proc.SysProcAttr.CreationFlags |= windows.CREATE_SUSPENDED
+	proc.Cancel = j.terminate
+	return j, nil
+}
+
+// assign moves the started (suspended) process into the job and resumes it, every process it spawns
+// belongs to the job too.
+func (j *processJob) assign(pid int) error {
+	process, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(pid))
+	if err != nil {
+		return fmt.Errorf("failed to open process: %w", err)
+	}
+	defer windows.CloseHandle(process)
+	if err := windows.AssignProcessToJobObject(j.handle, process); err != nil {
+		return fmt.Errorf("failed to assign the process to its job object: %w", err)
+	}
+	return resumeProcess(pid)
+}
+
+// resumeProcess resumes the main thread of a process started suspended, os/exec does not expose its handle
+// so it is looked up in a snapshot of the threads of the system.
+func resumeProcess(pid int) error {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPTHREAD, 0)
+	if err != nil {
+		return fmt.Errorf("failed to list threads: %w", err)
+	}
+	defer windows.CloseHandle(snapshot)
+	entry := windows.ThreadEntry32{Size: uint32(unsafe.Sizeof(windows.ThreadEntry32{}))}
+	for err = windows.Thread32First(snapshot, &entry); err == nil; err = windows.Thread32Next(snapshot, &entry) {
+		if entry.OwnerProcessID != uint32(pid) {
+			continue
+		}
+		thread, err := windows.OpenThread(windows.THREAD_SUSPEND_RESUME, false, entry.ThreadID)
+		if err != nil {
+			return fmt.Errorf("failed to open the main thread: %w", err)
+		}
+		_, err = windows.ResumeThread(thread)
+		_ = windows.CloseHandle(thread)
+		if err != nil {
+			return fmt.Errorf("failed to resume the process: %w", err)
+		}
+		// a process started suspended has a single thread
+		return nil
+	}
+	return fmt.Errorf("main thread of process %d not found", pid)
+}
+
+// terminate kills every process of the job.
+func (j *processJob) terminate() error {
+	return windows.TerminateJobObject(j.handle, 1)
+}
+
+func (j *processJob) close() {
+	_ = windows.CloseHandle(j.handle)
+}
@@ -0,0 +1,151 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/FMotalleb/executor/state"
+	"go.uber.org/zap"
+)
+
+// In-flight policies, decide what happens to batches that were started by a previous run but never finished.
+const (
+	// InFlightFail refuses to resume while in-flight batches exist.
+	InFlightFail = "fail"
+	// InFlightSkip treats in-flight batches as completed.
+	InFlightSkip = "skip"
+	// InFlightRerun processes in-flight batches again (only safe for idempotent commands).
+	InFlightRerun = "rerun"
+)
+
+// StateConfig controls the crash-safe state journal used to resume interrupted runs.
+type StateConfig struct {
+	// Path of the journal, empty disables it.
+	Path string
+	// InFlight is the policy applied to batches that were in flight when a previous run crashed.
+	InFlight string
+	// SyncInterval is the minimum time between syncs of batch results, zero syncs every result.
+	// Batch starts are always synced before the batch is spawned.
+	SyncInterval time.Duration
+	// AllowVersionChange resumes a journal written by another major version of executor.
+	AllowVersionChange bool
+}
+
+// Validate checks the in-flight policy.
+func (c StateConfig) Validate() error {
+	if c.Path == "" {
+		return nil
+	}
+	if c.SyncInterval < 0 {
+		return errors.New("sync interval cannot be negative")
+	}
+	switch c.InFlight {
+	case InFlightFail, InFlightSkip, InFlightRerun:
+		return nil
+	default:
+		return fmt.Errorf("unknown in-flight policy %q (expected %s, %s or %s)", c.InFlight, InFlightFail, InFlightSkip, InFlightRerun)
+	}
+}
+
+// open loads the previous state and opens the journal for this run, a disabled journal returns nils.
+func (c StateConfig) open(runID string) (*state.Journal, *state.State, error) {
+	if c.Path == "" {
+		return nil, nil, nil
+	}
+	previous, err := state.Load(c.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkVersion("state journal "+c.Path, previous.Version(), c.AllowVersionChange); err != nil {
+		return nil, nil, err
+	}
+	journal, err := state.Open(c.Path, c.SyncInterval)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := journal.Append(state.Record{Event: state.EventRun, RunID: runID, Version: binaryVersion()}); err != nil {
+		return nil, nil, errors.Join(err, journal.Close())
+	}
+	return journal, previous, nil
+}
+
+// resume drops the batches that a previous run completed and applies the in-flight policy.
+// Batches that failed in a previous run are always processed again.
+func (c StateConfig) resume(log *zap.Logger, batches []*ExecRequest, previous *state.State) ([]*ExecRequest, error) {
+	if previous == nil {
+		return batches, nil
+	}
+	var inFlight []string
+	skipped := 0
+	batches = slices.DeleteFunc(batches, func(r *ExecRequest) bool {
+		id := state.BatchID{Offset: r.Offset, BatchSize: r.BatchSize, Task: r.Task}
+		if _, ok := previous.Completed[id]; ok {
+			skipped++
+			return true
+		}
+		if _, ok := previous.InFlight[id]; ok {
+			inFlight = append(inFlight, r.name())
+			return c.InFlight == InFlightSkip
+		}
+		return false
+	})
+	if skipped != 0 {
+		log.Info("skipping batches completed by a previous run", zap.Int("count", skipped))
+	}
+	if len(inFlight) == 0 {
+		return batches, nil
+	}
+	switch c.InFlight {
+	case InFlightSkip:
+		log.Warn("skipping batches that were in flight when a previous run stopped", zap.Strings("batches", inFlight))
+	case InFlightRerun:
+		log.Warn("rerunning batches that were in flight when a previous run stopped", zap.Strings("batches", inFlight))
+	default:
+		log.Error("batches were in flight when a previous run stopped", zap.Strings("batches", inFlight))
+		return nil, fmt.Errorf(
+			"%d batches may have been partially processed by a previous run, use --in-flight=%s or --in-flight=%s to resume",
+			len(inFlight),
+			InFlightSkip,
+			InFlightRerun,
+		)
+	}
+	return batches, nil
+}
+
+// batchRecord builds the journal record of a batch.
+func batchRecord(event string, r *ExecRequest, err error) state.Record {
+	return state.Record{
+		Event:     event,
+		RunID:     r.RunID,
+		Offset:    r.Offset,
+		BatchSize: r.BatchSize,
+		Task:      r.Task,
+		ExitCode:  exitCodeOf(err),
+		Output:    r.capture.String(),
+	}
+}
+
+// stateFuncs expose the state left by previous runs to the templates of a run (read-only),
+// without a state journal the functions behave as if nothing was processed before.
+func stateFuncs(previous *state.State) map[string]any {
+	if previous == nil {
+		previous = state.Replay(nil)
+	}
+	return map[string]any{
+		// lastSuccessfulOffset returns the offset of the most recently completed batch, -1 if none.
+		"lastSuccessfulOffset": func() int64 {
+			if r, ok := previous.LastSuccessful(); ok {
+				return r.Offset
+			}
+			return -1
+		},
+		// runCountFor returns how many runs finished the batch starting at offset (successfully or not).
+		"runCountFor": previous.ResultCount,
+		// runCount returns the number of runs recorded in the journal, excluding the current one.
+		"runCount": func() int {
+			return len(previous.Runs)
+		},
+	}
+}
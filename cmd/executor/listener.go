@@ -0,0 +1,27 @@
+package executor
+
+// EventListener observes a run from Go code embedding executor (e.g. a progress UI or a custom persistence),
+// it is set with Config.Listener. The methods are called synchronously by the dispatcher and the workers,
+// concurrently for different batches, so they must be safe for concurrent use and return quickly.
+// Embed NopListener to implement only some of them.
+type EventListener interface {
+	// OnBatchQueued is called when a batch is ready to be dispatched and waits for a free worker.
+	OnBatchQueued(b BatchEvent)
+	// OnBatchStarted is called before the first attempt of a batch.
+	OnBatchStarted(b BatchEvent)
+	// OnBatchRetried is called when an attempt failed and the batch is retried after b.RetryIn.
+	OnBatchRetried(b BatchEvent)
+	// OnBatchFinished is called with the final outcome of a batch, including batches skipped by their done key.
+	OnBatchFinished(b BatchRecord)
+	// OnRunFinished is called with the report of the run once it finished or was aborted.
+	OnRunFinished(r *Report)
+}
+
+// NopListener ignores every event.
+type NopListener struct{}
+
+func (NopListener) OnBatchQueued(BatchEvent)    {}
+func (NopListener) OnBatchStarted(BatchEvent)   {}
+func (NopListener) OnBatchRetried(BatchEvent)   {}
+func (NopListener) OnBatchFinished(BatchRecord) {}
+func (NopListener) OnRunFinished(*Report)       {}
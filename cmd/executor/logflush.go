@@ -0,0 +1,44 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/FMotalleb/executor/logger"
+)
+
+// LogFlush is the flush policy of the per batch log files parsed from close, line, never or a buffer size (e.g. 64K).
+// It implements pflag.Value so it can be used directly as a flag.
+type LogFlush struct {
+	logger.FlushPolicy
+}
+
+func (f *LogFlush) String() string {
+	switch f.Mode {
+	case "":
+		return logger.FlushClose
+	case logger.FlushSize:
+		size := ByteSize(f.Size)
+		return size.String()
+	default:
+		return f.Mode
+	}
+}
+
+func (f *LogFlush) Set(s string) error {
+	switch mode := strings.ToLower(strings.TrimSpace(s)); mode {
+	case logger.FlushClose, logger.FlushLine, logger.FlushNever:
+		f.FlushPolicy = logger.FlushPolicy{Mode: mode}
+	default:
+		var size ByteSize
+		if err := size.Set(s); err != nil {
+			return fmt.Errorf("invalid log flush policy %q, expected close, line, never or a size", s)
+		}
+		f.FlushPolicy = logger.FlushPolicy{Mode: logger.FlushSize, Size: int(size)}
+	}
+	return f.Validate()
+}
+
+func (f *LogFlush) Type() string {
+	return "policy"
+}
@@ -0,0 +1,83 @@
+package executor
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const memoryCheckInterval = 500 * time.Millisecond
+
+// ErrMaxRSSExceeded is the failure of a batch killed because its processes used more memory than allowed.
+var ErrMaxRSSExceeded = errors.New("process tree exceeded the max rss and was killed (OOM)")
+
+// memoryGuard polls the resident memory of a process tree and kills it once it exceeds the limit.
+type memoryGuard struct {
+	limit    int64
+	log      *zap.Logger
+	exceeded atomic.Bool
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// newMemoryGuard returns nil if limit is zero, a nil guard is a valid no-op guard.
+func newMemoryGuard(limit ByteSize, log *zap.Logger) *memoryGuard {
+	if limit <= 0 {
+		return nil
+	}
+	return &memoryGuard{
+		limit: int64(limit),
+		log:   log,
+		done:  make(chan struct{}),
+	}
+}
+
+// watch starts polling the process tree rooted at pid.
+func (g *memoryGuard) watch(pid int) {
+	if g == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(memoryCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-g.done:
+				return
+			case <-ticker.C:
+			}
+			rss, pids, err := treeRSS(pid)
+			if err != nil {
+				g.log.Debug("failed to read process memory usage", zap.Error(err))
+				continue
+			}
+			if rss <= g.limit {
+				continue
+			}
+			g.exceeded.Store(true)
+			g.log.Error(
+				"process tree exceeded the max rss, killing it",
+				zap.Int64("rss", rss),
+				zap.Int64("max_rss", g.limit),
+			)
+			killTree(pids)
+			return
+		}
+	}()
+}
+
+// stop ends the polling, it is safe to call multiple times.
+func (g *memoryGuard) stop() {
+	if g == nil {
+		return
+	}
+	g.stopOnce.Do(func() { close(g.done) })
+}
+
+// tripped tells whether the guard killed the process.
+func (g *memoryGuard) tripped() bool {
+	return g != nil && g.exceeded.Load()
+}
@@ -0,0 +1,91 @@
+//go:build linux
+
+package executor
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const kiloByte = 1024
+
+func validateMaxRSSSupport() error {
+	return nil
+}
+
+// treeRSS sums the resident memory of the process and all of its descendants.
+func treeRSS(root int) (int64, []int, error) {
+	pids := []int{root}
+	var total int64
+	for i := 0; i < len(pids); i++ {
+		rss, err := processRSS(pids[i])
+		if err != nil {
+			if i == 0 {
+				return 0, nil, err
+			}
+			// descendants may exit while the tree is walked
+			continue
+		}
+		total += rss
+		pids = append(pids, childrenOf(pids[i])...)
+	}
+	return total, pids, nil
+}
+
+func processRSS(pid int) (int64, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		value, found := strings.CutPrefix(scanner.Text(), "VmRSS:")
+		if !found {
+			continue
+		}
+		kb, err := strconv.ParseInt(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "kB")), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return kb * kiloByte, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	// kernel threads and zombies have no VmRSS
+	return 0, nil
+}
+
+func childrenOf(pid int) []int {
+	tasks, err := filepath.Glob(fmt.Sprintf("/proc/%d/task/*/children", pid))
+	if err != nil {
+		return nil
+	}
+	var children []int
+	for _, task := range tasks {
+		data, err := os.ReadFile(task)
+		if err != nil {
+			continue
+		}
+		for _, field := range bytes.Fields(data) {
+			if child, err := strconv.Atoi(string(field)); err == nil {
+				children = append(children, child)
+			}
+		}
+	}
+	return children
+}
+
+func killTree(pids []int) {
+	for _, pid := range pids {
+		// processes that already exited are not an error here
+		_ = syscall.Kill(pid, syscall.SIGKILL)
+	}
+}
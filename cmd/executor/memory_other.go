@@ -0,0 +1,15 @@
+//go:build !linux
+
+package executor
+
+import "errors"
+
+func validateMaxRSSSupport() error {
+	return errors.New("max rss is only available on linux")
+}
+
+func treeRSS(_ int) (int64, []int, error) {
+	return 0, nil, errors.New("not supported")
+}
+
+func killTree(_ []int) {}
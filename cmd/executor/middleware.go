@@ -0,0 +1,49 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// ErrVetoed is returned (or wrapped) by a middleware refusing to run a batch, the batch fails without being retried.
+var ErrVetoed = errors.New("batch vetoed")
+
+// ErrSkipBatch is returned (or wrapped) by a middleware to skip a batch, it is recorded as skipped (like a batch
+// whose done key is stored) instead of failed.
+var ErrSkipBatch = errors.New("batch skipped")
+
+// ProcessFunc runs an attempt of a batch, ctx ends at the deadline of the attempt.
+type ProcessFunc func(ctx context.Context, r *ExecRequest) error
+
+// Middleware wraps the processing of every attempt (e.g. to trace attempts, add environment variables,
+// veto batches or record custom metrics), like HTTP middlewares. It calls next to run the attempt,
+// or returns an error instead to fail it (wrap ErrVetoed to prevent retries).
+type Middleware func(next ProcessFunc) ProcessFunc
+
+// chain wraps fn with the middlewares, the first middleware is the outermost.
+func chain(middlewares []Middleware, fn ProcessFunc) ProcessFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		fn = middlewares[i](fn)
+	}
+	return fn
+}
+
+// Setenv adds a variable to the environment of the process of the batch, it overrides the inherited
+// variables, those of the env files and the secrets. Middlewares use it before calling next.
+func (e *ExecRequest) Setenv(name, value string) {
+	if e.extraEnv == nil {
+		e.extraEnv = make(map[string]string)
+	}
+	e.extraEnv[name] = value
+}
+
+// extraEnviron returns the variables set with Setenv, sorted by name.
+func (e *ExecRequest) extraEnviron() []string {
+	env := make([]string, 0, len(e.extraEnv))
+	for name, value := range e.extraEnv {
+		env = append(env, name+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
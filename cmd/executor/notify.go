@@ -0,0 +1,326 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// notificationBuffer is the number of batch events waiting for delivery to a channel, further ones are dropped.
+	notificationBuffer = 1024
+	// notificationReserve is the room kept in the queue of a channel for the run events, which are never dropped.
+	notificationReserve = 8
+	// notificationFlushTimeout bounds how long the end of a run waits for the pending batch events to be delivered,
+	// the run events are delivered regardless.
+	notificationFlushTimeout = 30 * time.Second
+)
+
+// Notification events.
+const (
+	EventRunStarted   = "run.started"
+	EventBatchRetried = "batch.retried"
+	EventBatchFailed  = "batch.failed"
+	EventRunFinished  = "run.finished"
+	// EventFailureThreshold is sent once, when the number of failed batches reaches the failure threshold.
+	EventFailureThreshold = "run.failure_threshold"
+)
+
+// NotifyConfig holds the channels run and batch events are delivered to.
+type NotifyConfig struct {
+	// Webhooks receive every event as a JSON POST.
+	Webhooks []string
+	// WebhookSecret signs the webhook bodies (HMAC-SHA256), empty sends them unsigned.
+	WebhookSecret string
+	// WebhookRetries is the number of times a failed delivery is retried.
+	WebhookRetries int
+	// SlackWebhook and TeamsWebhook are incoming webhooks of chat channels the end of the run
+	// and the failure threshold are posted to, rendered with ChatTemplate (DefaultChatTemplate when empty).
+	SlackWebhook string
+	TeamsWebhook string
+	ChatTemplate string
+	// Email mails the summary of the run.
+	Email EmailConfig
+	// Telegram sends the start and end of the run and the failure threshold to a Telegram chat.
+	Telegram TelegramConfig
+	// FailureThreshold is the number of failed batches that triggers a run.failure_threshold event, zero disables it.
+	FailureThreshold int
+	// Notifiers receive every event from Go code, on top of those registered by plugins.
+	Notifiers []Notifier
+}
+
+// Validate checks the webhook urls, the email and telegram settings and the failure threshold.
+func (c NotifyConfig) Validate() error {
+	if c.WebhookRetries < 0 {
+		return errors.New("webhook retries cannot be negative")
+	}
+	if c.FailureThreshold < 0 {
+		return errors.New("failure threshold cannot be negative")
+	}
+	for _, u := range c.Webhooks {
+		if err := validateHTTPURL("webhook", u); err != nil {
+			return err
+		}
+	}
+	if c.SlackWebhook != "" {
+		if err := validateHTTPURL("slack webhook", c.SlackWebhook); err != nil {
+			return err
+		}
+	}
+	if c.TeamsWebhook != "" {
+		if err := validateHTTPURL("teams webhook", c.TeamsWebhook); err != nil {
+			return err
+		}
+	}
+	if err := c.Email.Validate(); err != nil {
+		return err
+	}
+	return c.Telegram.Validate()
+}
+
+// Event describes something that happened during a run, it is delivered to the notification channels.
+type Event struct {
+	Event    string    `json:"event"`
+	Time     time.Time `json:"time"`
+	RunID    string    `json:"run_id"`
+	Name     string    `json:"name,omitempty"`
+	Hostname string    `json:"hostname,omitempty"`
+	// Total is the number of planned batches, only set on run.started (zero when the batches are not planned upfront).
+	Total int `json:"total,omitempty"`
+	// Batch is set on batch events.
+	Batch *BatchEvent `json:"batch,omitempty"`
+	// Summary is set on run.finished, on run.failure_threshold it only holds the number of failed batches.
+	Summary *RunSummary `json:"summary,omitempty"`
+}
+
+// BatchEvent describes the batch of a batch event, Attempt is its current attempt (the failed one on
+// batch.retried and batch.failed).
+type BatchEvent struct {
+	BatchID   string `json:"batch_id"`
+	Offset    int64  `json:"offset"`
+	BatchSize int64  `json:"batch_size"`
+	Label     string `json:"label,omitempty"`
+	Task      string `json:"task,omitempty"`
+	Attempt   uint   `json:"attempt"`
+	ExitCode  int    `json:"exit_code"`
+	Error     string `json:"error,omitempty"`
+	// RetryIn is the delay before the next attempt, only set on batch.retried.
+	RetryIn time.Duration `json:"retry_in,omitempty"`
+	LogPath string        `json:"log_path,omitempty"`
+}
+
+// RunSummary holds the counters of a finished run.
+type RunSummary struct {
+	Aborted   bool           `json:"aborted"`
+	Succeeded int            `json:"succeeded"`
+	Failed    int            `json:"failed"`
+	Skipped   int            `json:"skipped,omitempty"`
+	Attempts  int            `json:"attempts"`
+	Duration  time.Duration  `json:"duration"`
+	ExitCodes map[string]int `json:"exit_codes"`
+	// ReportPath is the path of the JSON report, empty when no report is written.
+	ReportPath string `json:"report_path,omitempty"`
+	// failed are the failed batches (for attachments), not part of the event.
+	failed []BatchRecord
+}
+
+// notificationChannel delivers events to an external system.
+type notificationChannel interface {
+	// name identifies the channel in logs.
+	name() string
+	send(ctx context.Context, e Event) error
+}
+
+// notifier delivers the events of a run to the configured channels in the background, in order. Every channel
+// has its own queue and worker, so a slow channel (retrying a webhook) neither holds a batch back nor delays
+// the other channels. A nil notifier drops every event.
+type notifier struct {
+	log    *zap.Logger
+	queues []*channelQueue
+	run    runInfo
+	// reportPath is sent along the summary of the run, so people know where to look.
+	reportPath       string
+	failureThreshold int
+	failed           atomic.Int64
+	// expired is set once the flush timeout elapsed, the pending batch events are dropped from then on.
+	expired atomic.Bool
+	// lock guards closed, batches of an aborted run may still finish while the notifier is closed.
+	lock   sync.Mutex
+	closed bool
+}
+
+// channelQueue holds the events waiting for delivery to a channel.
+type channelQueue struct {
+	channel notificationChannel
+	events  chan Event
+	done    chan struct{}
+}
+
+// isRunEvent tells whether the event is about the whole run (start, failure threshold, end), these are never dropped.
+func isRunEvent(e Event) bool {
+	return e.Event == EventRunStarted || e.Event == EventFailureThreshold || e.Event == EventRunFinished
+}
+
+// newNotifier starts delivering events to the configured channels, nil when none is configured.
+func newNotifier(log *zap.Logger, cfg Config, run runInfo) *notifier {
+	var channels []notificationChannel
+	for _, u := range cfg.Notify.Webhooks {
+		channels = append(channels, newWebhook(u, cfg.Notify.WebhookSecret, cfg.Notify.WebhookRetries))
+	}
+	if cfg.Notify.SlackWebhook != "" {
+		channels = append(channels, newChatChannel(chatSlack, cfg.Notify.SlackWebhook, cfg.Notify.ChatTemplate, cfg.Notify.WebhookRetries))
+	}
+	if cfg.Notify.TeamsWebhook != "" {
+		channels = append(channels, newChatChannel(chatTeams, cfg.Notify.TeamsWebhook, cfg.Notify.ChatTemplate, cfg.Notify.WebhookRetries))
+	}
+	if cfg.Notify.Email.Enabled() {
+		channels = append(channels, &emailChannel{cfg: cfg.Notify.Email})
+	}
+	if cfg.Notify.Telegram.Enabled() {
+		channels = append(channels, newTelegramChannel(cfg.Notify.Telegram, cfg.Notify.WebhookRetries))
+	}
+	for _, n := range append(registeredNotifiers(), cfg.Notify.Notifiers...) {
+		channels = append(channels, notifierChannel{notifier: n})
+	}
+	if len(channels) == 0 {
+		return nil
+	}
+	n := &notifier{
+		log:              log,
+		run:              run,
+		reportPath:       cfg.Report.Path,
+		failureThreshold: cfg.Notify.FailureThreshold,
+	}
+	for _, c := range channels {
+		q := &channelQueue{
+			channel: c,
+			events:  make(chan Event, notificationBuffer+notificationReserve),
+			done:    make(chan struct{}),
+		}
+		n.queues = append(n.queues, q)
+		go n.deliver(q)
+	}
+	return n
+}
+
+// deliver sends the queued events to the channel of q until the notifier is closed.
+func (n *notifier) deliver(q *channelQueue) {
+	defer close(q.done)
+	dropped := 0
+	for e := range q.events {
+		if n.expired.Load() && !isRunEvent(e) {
+			dropped++
+			continue
+		}
+		if err := q.channel.send(context.Background(), e); err != nil {
+			n.log.Error("failed to deliver notification", zap.String("channel", q.channel.name()), zap.String("event", e.Event), zap.Error(err))
+		}
+	}
+	if dropped != 0 {
+		n.log.Warn("batch notifications were not delivered in time, they are dropped",
+			zap.String("channel", q.channel.name()), zap.Int("dropped", dropped))
+	}
+}
+
+// notify queues the event for every channel. A batch event is dropped when the queue of a channel is full,
+// a run event uses the room reserved for it (and waits for the channel if even that is used up).
+func (n *notifier) notify(e Event) {
+	if n == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	e.RunID, e.Name, e.Hostname = n.run.id, n.run.name, n.run.hostname
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.closed {
+		return
+	}
+	for _, q := range n.queues {
+		if !isRunEvent(e) && len(q.events) >= notificationBuffer {
+			n.log.Warn("notification queue is full, event dropped", zap.String("channel", q.channel.name()), zap.String("event", e.Event))
+			continue
+		}
+		q.events <- e
+	}
+}
+
+// batchRetried notifies that an attempt of the batch failed and the batch is retried after e.RetryIn.
+func (n *notifier) batchRetried(e *BatchEvent) {
+	n.notify(Event{Event: EventBatchRetried, Batch: e})
+}
+
+// batchFailed notifies that the batch exhausted its retries, and that the run reached the failure threshold.
+func (n *notifier) batchFailed(r *ExecRequest, err error) {
+	if n == nil {
+		return
+	}
+	n.notify(Event{Event: EventBatchFailed, Batch: newBatchEvent(r, err)})
+	if failed := n.failed.Add(1); n.failureThreshold > 0 && failed == int64(n.failureThreshold) {
+		n.notify(Event{Event: EventFailureThreshold, Summary: &RunSummary{Failed: int(failed)}})
+	}
+}
+
+// runFinished notifies the end of the run with its summary.
+func (n *notifier) runFinished(report *Report) {
+	if n == nil {
+		return
+	}
+	var failed []BatchRecord
+	for _, b := range report.Batches {
+		if !b.Success && !b.Skipped {
+			failed = append(failed, b)
+		}
+	}
+	n.notify(Event{Event: EventRunFinished, Summary: &RunSummary{
+		Aborted:    report.Aborted,
+		Succeeded:  report.Succeeded,
+		Failed:     report.Failed,
+		Skipped:    report.Skipped,
+		Attempts:   report.Attempts,
+		Duration:   report.Duration,
+		ExitCodes:  report.ExitCodes,
+		ReportPath: n.reportPath,
+		failed:     failed,
+	}})
+}
+
+// Close delivers the queued events. Batch events still pending after notificationFlushTimeout are dropped,
+// the run events (e.g. run.finished) are always delivered.
+func (n *notifier) Close() {
+	if n == nil {
+		return
+	}
+	n.lock.Lock()
+	n.closed = true
+	for _, q := range n.queues {
+		close(q.events)
+	}
+	n.lock.Unlock()
+	expire := time.AfterFunc(notificationFlushTimeout, func() { n.expired.Store(true) })
+	defer expire.Stop()
+	for _, q := range n.queues {
+		<-q.done
+	}
+}
+
+// newBatchEvent describes the batch and the result of its current attempt.
+func newBatchEvent(r *ExecRequest, err error) *BatchEvent {
+	e := &BatchEvent{
+		BatchID:   r.BatchID,
+		Offset:    r.Offset,
+		BatchSize: r.BatchSize,
+		Label:     r.Label,
+		Task:      r.Task,
+		Attempt:   r.TryCount + 1,
+		ExitCode:  exitCodeOf(err),
+		LogPath:   r.logPath(),
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
@@ -0,0 +1,70 @@
+package executor
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// recordingChannel records the events it receives, after waiting for release when it is set.
+type recordingChannel struct {
+	release chan struct{}
+	lock    sync.Mutex
+	events  []string
+}
+
+func (c *recordingChannel) name() string { return "recording" }
+
+func (c *recordingChannel) send(_ context.Context, e Event) error {
+	if c.release != nil {
+		<-c.release
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.events = append(c.events, e.Event)
+	return nil
+}
+
+func (c *recordingChannel) received() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]string(nil), c.events...)
+}
+
+func TestNotifierKeepsRunEvents(t *testing.T) {
+	slow := &recordingChannel{release: make(chan struct{})}
+	fast := new(recordingChannel)
+	n := &notifier{log: zap.NewNop()}
+	for _, c := range []notificationChannel{slow, fast} {
+		q := &channelQueue{channel: c, events: make(chan Event, notificationBuffer+notificationReserve), done: make(chan struct{})}
+		n.queues = append(n.queues, q)
+		go n.deliver(q)
+	}
+
+	// the slow channel holds its first event, its queue overflows
+	for range notificationBuffer + 10 {
+		n.notify(Event{Event: EventBatchFailed})
+	}
+	n.notify(Event{Event: EventRunFinished})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for events := fast.received(); len(events) == 0 || events[len(events)-1] != EventRunFinished; events = fast.received() {
+		if time.Now().After(deadline) {
+			t.Fatalf("the fast channel did not receive %s while the slow one was stuck", EventRunFinished)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(slow.release)
+	n.Close()
+
+	events := slow.received()
+	if last := events[len(events)-1]; last != EventRunFinished {
+		t.Fatalf("the slow channel received %s last, want %s", last, EventRunFinished)
+	}
+	if len(events) > notificationBuffer+2 {
+		t.Fatalf("the slow channel received %d events, want the batch events beyond its queue to be dropped", len(events))
+	}
+}
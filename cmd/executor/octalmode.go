@@ -0,0 +1,40 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const maxFileMode = 0o7777
+
+// OctalMode is a file mode (or umask) parsed from its octal notation, e.g. 0640.
+// It implements pflag.Value, IsSet tells whether a value was given at all.
+type OctalMode struct {
+	Value os.FileMode
+	IsSet bool
+}
+
+func (m *OctalMode) String() string {
+	if !m.IsSet {
+		return ""
+	}
+	return fmt.Sprintf("%04o", uint32(m.Value))
+}
+
+func (m *OctalMode) Set(s string) error {
+	v, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return fmt.Errorf("invalid octal mode %q: %w", s, err)
+	}
+	if v > maxFileMode {
+		return fmt.Errorf("octal mode out of range: %q", s)
+	}
+	m.Value = os.FileMode(v)
+	m.IsSet = true
+	return nil
+}
+
+func (m *OctalMode) Type() string {
+	return "octal"
+}
@@ -0,0 +1,16 @@
+//go:build linux
+
+package executor
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setParentDeathSignal makes the kernel kill the process once executor dies, even if it is SIGKILLed.
+func setParentDeathSignal(proc *exec.Cmd) {
+	if proc.SysProcAttr == nil {
+		proc.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	proc.SysProcAttr.Pdeathsig = syscall.SIGKILL
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package executor
+
+import "os/exec"
+
+// setParentDeathSignal is a no-op, parent death signals are a linux feature.
+func setParentDeathSignal(_ *exec.Cmd) {}
@@ -0,0 +1,226 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/FMotalleb/executor/input"
+	"github.com/FMotalleb/executor/secrets"
+	"github.com/FMotalleb/executor/template"
+	"github.com/google/uuid"
+)
+
+// runInfo holds the values shared by every batch of a run.
+type runInfo struct {
+	id       string
+	name     string
+	hostname string
+	secrets  map[string]string
+	// secretResolver resolves `secret "name"` when a process is spawned.
+	secretResolver *secrets.Resolver
+	// funcs are the template functions of the run (see stateFuncs).
+	funcs map[string]any
+	// processRunner runs the processes of the batches.
+	processRunner ProcessRunner
+}
+
+// planBatches splits the configured ranges into batches, each batch is represented by an ExecRequest.
+// Batches are returned in their natural order (ranges in the given order, ascending offsets within each range
+// or descending offsets when Offset is greater than Limit), the distribution strategy may reorder them later.
+func planBatches(ctx context.Context, cfg Config, run runInfo) ([]*ExecRequest, error) {
+	if cfg.Input.Enabled() {
+		return planItems(ctx, cfg, run)
+	}
+	ranges := cfg.Ranges
+	switch {
+	case len(ranges) != 0:
+	case cfg.descending():
+		ranges = RangeList{{Begin: cfg.Limit, End: cfg.Offset}}
+	default:
+		ranges = RangeList{{Begin: cfg.Offset, End: cfg.Limit}}
+	}
+	var batches []*ExecRequest
+	for _, r := range ranges {
+		planned, err := planRange(ctx, cfg, run, r)
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, planned...)
+	}
+	return batches, nil
+}
+
+// planRange splits a single range into batches of BatchSize offsets whose starts are Step apart.
+// With a negative step the range is walked from its end, each batch ending where the previous one started (plus step).
+func planRange(ctx context.Context, cfg Config, run runInfo, r Range) ([]*ExecRequest, error) {
+	step := cfg.step()
+	var batches []*ExecRequest
+	add := func(begin int64, end int64) error {
+		req := newRequest(ctx, cfg, run, begin, end-begin)
+		if err := req.evaluate(cfg); err != nil {
+			return err
+		}
+		batches = append(batches, req)
+		return nil
+	}
+	if step < 0 {
+		for top := r.End; top > r.Begin; top += step {
+			if err := add(max(top-cfg.BatchSize, r.Begin), top); err != nil {
+				return nil, err
+			}
+		}
+		return batches, nil
+	}
+	for begin := r.Begin; begin < r.End; {
+		end := min(begin+cfg.BatchSize, r.End)
+		next := begin + step
+		if cfg.Align > 0 {
+			end = min(nextBoundary(begin, cfg.BatchSize, cfg.Align), r.End)
+			next = end
+		}
+		if err := add(begin, end); err != nil {
+			return nil, err
+		}
+		begin = next
+	}
+	return batches, nil
+}
+
+// planItems reads every item of the input source and groups them into batches of BatchSize items.
+// The offset of a batch is the index of its first item.
+func planItems(ctx context.Context, cfg Config, run runInfo) ([]*ExecRequest, error) {
+	src, err := cfg.Input.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input: %w", err)
+	}
+	defer src.Close()
+	items, err := input.ReadAll(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	size := int(cfg.BatchSize)
+	batches := make([]*ExecRequest, 0, (len(items)+size-1)/size)
+	for offset := 0; offset < len(items); offset += size {
+		chunk := items[offset:min(offset+size, len(items))]
+		req := newRequest(ctx, cfg, run, int64(offset), int64(len(chunk)))
+		req.items = chunk
+		if err := req.evaluate(cfg); err != nil {
+			return nil, err
+		}
+		batches = append(batches, req)
+	}
+	return batches, nil
+}
+
+// evaluate renders the per batch templates used for planning (priority, label and not-before).
+func (e *ExecRequest) evaluate(cfg Config) error {
+	if err := e.evaluatePriority(cfg.Priority); err != nil {
+		return err
+	}
+	if err := e.evaluateLabel(cfg.Label); err != nil {
+		return err
+	}
+	return e.evaluateNotBefore(cfg.NotBefore)
+}
+
+// nextBoundary returns the end of the batch starting at offset.
+// Without alignment it is offset+step, with alignment the boundaries are the multiples of step snapped down to
+// a multiple of align (align at least), they do not depend on where the range starts.
+func nextBoundary(offset int64, step int64, align int64) int64 {
+	if align <= 0 {
+		return offset + step
+	}
+	unit := max(step/align*align, align)
+	boundary := offset / unit
+	if offset < 0 && offset%unit != 0 {
+		// the division truncates towards zero, the boundary below a negative offset is one unit lower
+		boundary--
+	}
+	return (boundary + 1) * unit
+}
+
+// newRequest builds the ExecRequest of a single batch.
+func newRequest(ctx context.Context, cfg Config, run runInfo, offset int64, size int64) *ExecRequest {
+	return &ExecRequest{
+		RunID:    run.id,
+		RunName:  run.name,
+		BatchID:  uuid.NewString(),
+		hostname: run.hostname,
+		secrets:  run.secrets,
+
+		secretResolver: run.secretResolver,
+		funcs:          run.funcs,
+		processRunner:  run.processRunner,
+
+		Command:   cfg.Command,
+		StdIn:     cfg.StdIn,
+		Offset:    offset,
+		BatchSize: size,
+
+		Retry:       cfg.Retry,
+		retryPolicy: cfg.RetryPolicy,
+		hooks:       cfg.Hooks,
+		middlewares: cfg.Middlewares,
+		done:        cfg.DoneKey,
+
+		Shell:     cfg.Shell,
+		ShellArgs: cfg.ShellArgs,
+
+		WorkingDirectory: cfg.WorkingDirectory,
+		Env:              cfg.Env,
+		Process:          cfg.Process,
+		Systemd:          cfg.Systemd,
+		tempDir:          cfg.TempDir,
+		contextFile:      cfg.ContextFile,
+		logRoot:          cfg.LogDir,
+
+		rootCtx: ctx,
+		Timeout: cfg.Timeout,
+
+		logToErr:      cfg.LogToStdErr,
+		logFileMode:   cfg.LogFileMode.Value,
+		logRecipients: cfg.LogEncryption.recipients,
+		logRateLimit:  int(cfg.LogRateLimit),
+		logFlush:      cfg.LogFlush.FlushPolicy,
+		annotations:   new(annotationSet),
+		tail:          cfg.Sample.newTail(),
+		capture:       newOutputCapture(int(cfg.CaptureOutput)),
+	}
+}
+
+// evaluateTemplate renders a template of the batch with its variables and the template functions of the run.
+func (e *ExecRequest) evaluateTemplate(tmpl string) (string, error) {
+	return template.EvaluateTemplateWith(tmpl, e.getVarMap(), e.funcs)
+}
+
+// evaluatePriority renders the priority template of the batch, an empty template leaves the priority at zero.
+func (e *ExecRequest) evaluatePriority(tmpl string) error {
+	if tmpl == "" {
+		return nil
+	}
+	raw, err := e.evaluateTemplate(tmpl)
+	if err != nil {
+		return fmt.Errorf("failed to evaluate priority template: %w", err)
+	}
+	priority, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil {
+		return fmt.Errorf("priority template must render an integer: %w", err)
+	}
+	e.Priority = priority
+	return nil
+}
+
+// evaluateLabel renders the label template of the batch, used to group batches in the report.
+func (e *ExecRequest) evaluateLabel(tmpl string) error {
+	if tmpl == "" {
+		return nil
+	}
+	label, err := e.evaluateTemplate(tmpl)
+	if err != nil {
+		return fmt.Errorf("failed to evaluate label template: %w", err)
+	}
+	e.Label = strings.TrimSpace(label)
+	return nil
+}
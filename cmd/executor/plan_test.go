@@ -0,0 +1,17 @@
+package executor
+
+import "testing"
+
+func TestNextBoundaryIgnoresStart(t *testing.T) {
+	for _, start := range []int64{0, 50, 150, 200, -150} {
+		for offset := start; offset < 1000; offset = nextBoundary(offset, 250, 100) {
+			if next := nextBoundary(offset, 250, 100); next%200 != 0 || next <= offset || next-offset > 250 {
+				t.Fatalf("batch starting at %d (range from %d) ends at %d, want the next multiple of 200",
+					offset, start, next)
+			}
+		}
+	}
+	if next := nextBoundary(30, 50, 100); next != 100 {
+		t.Fatalf("batch smaller than align ends at %d, want 100", next)
+	}
+}
@@ -0,0 +1,113 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/FMotalleb/executor/input"
+	"github.com/FMotalleb/executor/template"
+)
+
+// pluginSymbol is the function every plugin exports, a func(*executor.PluginRegistry) error registering its extensions.
+const pluginSymbol = "Register"
+
+// Notifier receives the run and batch events, like the webhooks. It is registered by a plugin or set in
+// NotifyConfig.Notifiers, events are delivered in order from a single goroutine.
+type Notifier interface {
+	// Name identifies the notifier in logs.
+	Name() string
+	Notify(ctx context.Context, e Event) error
+}
+
+// PluginRegistry is handed to the Register function of a plugin. The extensions of plugins are available to
+// every run of the process.
+type PluginRegistry struct {
+	path string
+}
+
+// InputSource registers an input source, selected with `--input-plugin name[:argument]`.
+func (r *PluginRegistry) InputSource(name string, open input.Opener) error {
+	if err := input.Register(name, open); err != nil {
+		return fmt.Errorf("plugin %s: %w", r.path, err)
+	}
+	return nil
+}
+
+// TemplateFuncs makes functions available to every template, they take precedence over the built-in ones.
+func (r *PluginRegistry) TemplateFuncs(funcs map[string]any) {
+	template.RegisterFuncs(funcs)
+}
+
+// Notifier registers a notifier receiving the events of every run.
+func (r *PluginRegistry) Notifier(n Notifier) {
+	pluginsLock.Lock()
+	defer pluginsLock.Unlock()
+	pluginNotifiers = append(pluginNotifiers, n)
+}
+
+var (
+	pluginsLock     sync.Mutex
+	loadedPlugins   = map[string]bool{}
+	pluginNotifiers []Notifier
+)
+
+// LoadPlugins opens the Go plugins (built with `go build -buildmode=plugin` against the same version of executor)
+// and calls their Register function. A plugin already loaded is skipped.
+// Plugins are only supported by binaries built with cgo on linux, macos and freebsd.
+func LoadPlugins(paths []string) error {
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("invalid plugin path %s: %w", path, err)
+		}
+		pluginsLock.Lock()
+		loaded := loadedPlugins[abs]
+		loadedPlugins[abs] = true
+		pluginsLock.Unlock()
+		if loaded {
+			continue
+		}
+		if err := loadPlugin(abs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadPlugin opens a plugin and lets it register its extensions.
+func loadPlugin(path string) error {
+	symbol, err := lookupPluginSymbol(path)
+	if err != nil {
+		return err
+	}
+	register, ok := symbol.(func(*PluginRegistry) error)
+	if !ok {
+		return fmt.Errorf("plugin %s: %s must be a func(*executor.PluginRegistry) error, got %T", path, pluginSymbol, symbol)
+	}
+	if err := register(&PluginRegistry{path: path}); err != nil {
+		return fmt.Errorf("plugin %s failed to register: %w", path, err)
+	}
+	return nil
+}
+
+// registeredNotifiers returns the notifiers registered by plugins.
+func registeredNotifiers() []Notifier {
+	pluginsLock.Lock()
+	defer pluginsLock.Unlock()
+	return append([]Notifier(nil), pluginNotifiers...)
+}
+
+// notifierChannel delivers the events to a Notifier.
+type notifierChannel struct {
+	notifier Notifier
+}
+
+func (c notifierChannel) name() string {
+	return c.notifier.Name()
+}
+
+func (c notifierChannel) send(ctx context.Context, e Event) error {
+	return c.notifier.Notify(ctx, e)
+}
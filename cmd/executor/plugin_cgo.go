@@ -0,0 +1,21 @@
+//go:build cgo && (linux || darwin || freebsd)
+
+package executor
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// lookupPluginSymbol opens the plugin and returns its Register symbol.
+func lookupPluginSymbol(path string) (plugin.Symbol, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load plugin: %w", err)
+	}
+	symbol, err := p.Lookup(pluginSymbol)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s does not export %s: %w", path, pluginSymbol, err)
+	}
+	return symbol, nil
+}
@@ -0,0 +1,13 @@
+//go:build !cgo || !(linux || darwin || freebsd)
+
+package executor
+
+import "fmt"
+
+// lookupPluginSymbol fails, go plugins require cgo (and are not supported on this platform or by this build).
+func lookupPluginSymbol(path string) (any, error) {
+	return nil, fmt.Errorf(
+		"cannot load plugin %s: this executor binary was built without plugin support, build it with CGO_ENABLED=1 on linux, macos or freebsd",
+		path,
+	)
+}
@@ -0,0 +1,128 @@
+package executor
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/FMotalleb/executor/state"
+	"go.uber.org/zap"
+)
+
+// workerPool keeps track of the running processors.
+// Processors that fail their health checks leave the pool and may be replaced,
+// once no processor is left the exhausted channel is closed so the dispatcher stops waiting.
+type workerPool struct {
+	// log is the logger of the run.
+	log      *zap.Logger
+	wg       *sync.WaitGroup
+	requests <-chan *ExecRequest
+	health   *healthChecker
+	stats    *runStats
+	// journal records batch state transitions, nil when the state journal is disabled.
+	journal *state.Journal
+	// queue acknowledges finished batches, a nil file queue when the batches are only queued in memory.
+	queue batchAcker
+	// reservations hands out the capacity of an external service to the batches, nil when disabled.
+	reservations *reservations
+	// events delivers the batch events to the notification channels, nil when none is configured.
+	events *notifier
+	// listener observes the batches from Go code.
+	listener EventListener
+	// results streams the results of the batches to Runner.Results.
+	results *resultStreams
+	// retrySlots limits how many retry attempts run at the same time, nil means no extra limit.
+	retrySlots chan struct{}
+
+	alive     atomic.Int32
+	lastID    atomic.Int32
+	exhausted chan struct{}
+}
+
+func newWorkerPool(
+	log *zap.Logger,
+	wg *sync.WaitGroup,
+	requests <-chan *ExecRequest,
+	health *healthChecker,
+	journal *state.Journal,
+	queue batchAcker,
+	reservations *reservations,
+	events *notifier,
+	listener EventListener,
+	results *resultStreams,
+	retryParallel int,
+) *workerPool {
+	pool := &workerPool{
+		log:          log,
+		wg:           wg,
+		requests:     requests,
+		health:       health,
+		stats:        newRunStats(),
+		journal:      journal,
+		queue:        queue,
+		reservations: reservations,
+		events:       events,
+		listener:     listener,
+		results:      results,
+		exhausted:    make(chan struct{}),
+	}
+	if retryParallel > 0 {
+		pool.retrySlots = make(chan struct{}, retryParallel)
+	}
+	return pool
+}
+
+// acquireAttempt waits for permission to run the given attempt, first attempts are never limited.
+// The returned function releases the slot.
+func (p *workerPool) acquireAttempt(ctx context.Context, tryCount uint) func() {
+	if tryCount == 0 || p.retrySlots == nil {
+		return func() {}
+	}
+	select {
+	case p.retrySlots <- struct{}{}:
+		return func() { <-p.retrySlots }
+	case <-ctx.Done():
+		// the attempt fails on its own with the dead context
+		return func() {}
+	}
+}
+
+// spawn starts a new processor in the pool.
+func (p *workerPool) spawn(ctx context.Context) {
+	p.spawnAfter(ctx, 0)
+}
+
+// spawnAfter adds a processor to the pool which starts taking batches after delay (or once the run ended).
+func (p *workerPool) spawnAfter(ctx context.Context, delay time.Duration) {
+	id := int(p.lastID.Add(1))
+	p.alive.Add(1)
+	if delay <= 0 {
+		go processor(ctx, id, p)
+		return
+	}
+	go func() {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		processor(ctx, id, p)
+	}()
+}
+
+// retire removes an unhealthy processor from the pool, replacing it if the health checker allows it.
+func (p *workerPool) retire(ctx context.Context, id int, err error) {
+	if delay, replace := p.health.report(p.log.Named("HealthCheck"), id, err); replace {
+		p.spawnAfter(ctx, delay)
+	}
+	p.leave()
+}
+
+// leave marks a processor as gone.
+func (p *workerPool) leave() {
+	if p.alive.Add(-1) == 0 {
+		close(p.exhausted)
+	}
+}
@@ -0,0 +1,58 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	minNice        = -20
+	maxNice        = 19
+	maxIOPrioLevel = 7
+
+	DefaultIONiceLevel = 4
+)
+
+// ioniceClasses maps the io scheduling class names to their kernel values.
+var ioniceClasses = map[string]int{
+	"":            0,
+	"none":        0,
+	"realtime":    1,
+	"best-effort": 2,
+	"idle":        3,
+}
+
+// IONiceClassNames returns the names accepted as ionice class.
+func IONiceClassNames() []string {
+	return []string{"none", "realtime", "best-effort", "idle"}
+}
+
+// PriorityConfig holds the cpu (nice) and io (ionice) scheduling priority of spawned processes.
+// Priorities are set on the thread starting the process, which the process inherits them from.
+type PriorityConfig struct {
+	Nice        int
+	IONiceClass string
+	IONiceLevel int
+}
+
+func (p PriorityConfig) enabled() bool {
+	return p.Nice != 0 || p.ioClass() != 0
+}
+
+func (p PriorityConfig) ioClass() int {
+	return ioniceClasses[p.IONiceClass]
+}
+
+// Validate checks the priority values.
+func (p PriorityConfig) Validate() error {
+	if p.Nice < minNice || p.Nice > maxNice {
+		return fmt.Errorf("nice must be between %d and %d", minNice, maxNice)
+	}
+	if _, ok := ioniceClasses[p.IONiceClass]; !ok {
+		return fmt.Errorf("unknown ionice class: %q (none, realtime, best-effort, idle)", p.IONiceClass)
+	}
+	if p.IONiceLevel < 0 || p.IONiceLevel > maxIOPrioLevel {
+		return errors.New("ionice level must be between 0 and 7")
+	}
+	return validatePrioritySupport(p)
+}
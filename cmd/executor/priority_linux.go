@@ -0,0 +1,39 @@
+//go:build linux
+
+package executor
+
+import (
+	"fmt"
+	"syscall"
+)
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+)
+
+func validatePrioritySupport(_ PriorityConfig) error {
+	return nil
+}
+
+// currentThread returns the id of the calling thread, nice values and io priorities are per thread on linux.
+func currentThread() int {
+	return syscall.Gettid()
+}
+
+// apply sets the nice value and io priority of the given process (or thread).
+func (p PriorityConfig) apply(pid int) error {
+	if p.Nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, p.Nice); err != nil {
+			return fmt.Errorf("failed to set nice value: %w", err)
+		}
+	}
+	if class := p.ioClass(); class != 0 {
+		prio := class<<ioprioClassShift | p.IONiceLevel
+		_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(pid), uintptr(prio))
+		if errno != 0 {
+			return fmt.Errorf("failed to set io priority: %w", errno)
+		}
+	}
+	return nil
+}
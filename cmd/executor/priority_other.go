@@ -0,0 +1,20 @@
+//go:build !linux
+
+package executor
+
+import "errors"
+
+func validatePrioritySupport(p PriorityConfig) error {
+	if p.enabled() {
+		return errors.New("nice and ionice are only available on linux")
+	}
+	return nil
+}
+
+func currentThread() int {
+	return 0
+}
+
+func (p PriorityConfig) apply(_ int) error {
+	return nil
+}
@@ -0,0 +1,111 @@
+package executor
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// ProcessConfig groups the settings applied to every spawned process (resource limits, priorities, etc.).
+type ProcessConfig struct {
+	Cgroup   CgroupConfig
+	Priority PriorityConfig
+	Affinity AffinityConfig
+	MaxRSS   ByteSize
+	// Rlimits are resource limits formatted as `name=soft[:hard]` (nofile, nproc, core, fsize), the process then
+	// runs in a process group of its own.
+	Rlimits []string
+
+	// PTY runs the process with its stdout and stderr on a pseudo-terminal, for tools that buffer their output
+	// or drop progress and colors when it is not a terminal (linux only).
+	PTY bool
+
+	// OutputGrace is how long the output of an exited process is still copied into the batch log, background
+	// processes it left running may hold the output open for much longer. Zero uses DefaultOutputGrace.
+	OutputGrace time.Duration
+
+	// KillOnParentDeath terminates the process if executor itself dies (linux and windows, where the
+	// processes the batch left running are killed once it ended too).
+	KillOnParentDeath bool
+}
+
+// Validate checks the process settings.
+func (p ProcessConfig) Validate() error {
+	return errors.Join(
+		p.Cgroup.Validate(),
+		p.Priority.Validate(),
+		p.Affinity.Validate(),
+		p.validateMaxRSS(),
+		validateRlimits(p.Rlimits),
+		p.validatePTY(),
+		p.validateOutputGrace(),
+	)
+}
+
+// DefaultOutputGrace is the output grace of processes that do not set one.
+const DefaultOutputGrace = 10 * time.Second
+
+func (p ProcessConfig) validateOutputGrace() error {
+	if p.OutputGrace < 0 {
+		return errors.New("output grace cannot be negative")
+	}
+	return nil
+}
+
+// outputGrace returns the output grace of the process.
+func (p ProcessConfig) outputGrace() time.Duration {
+	if p.OutputGrace == 0 {
+		return DefaultOutputGrace
+	}
+	return p.OutputGrace
+}
+
+func (p ProcessConfig) validatePTY() error {
+	if !p.PTY {
+		return nil
+	}
+	return validatePTYSupport()
+}
+
+func (p ProcessConfig) validateMaxRSS() error {
+	if p.MaxRSS <= 0 {
+		return nil
+	}
+	return validateMaxRSSSupport()
+}
+
+// beforeStart prepares the process before it is started.
+// The returned cleanup function must be called once the process has exited.
+func (p ProcessConfig) beforeStart(proc *exec.Cmd, name string) (func(), error) {
+	if p.KillOnParentDeath {
+		setParentDeathSignal(proc)
+	}
+	// rlimits are set once the process runs, if that fails the processes it spawned meanwhile are killed with it.
+	// A process given a terminal already leads a session (and a process group) of its own.
+	if len(p.Rlimits) != 0 && !p.PTY {
+		startProcessGroup(proc)
+	}
+	return p.Cgroup.attach(proc, name)
+}
+
+// applyInherited applies the settings a process inherits from the thread starting it to the calling thread, so the
+// process runs with them from its first instruction. The thread is locked to the calling goroutine and never
+// unlocked, it is discarded once the goroutine exits instead of running other goroutines with these settings.
+func (p ProcessConfig) applyInherited(worker int) error {
+	if !p.Priority.enabled() && !p.Affinity.enabled() {
+		return nil
+	}
+	runtime.LockOSThread()
+	thread := currentThread()
+	return errors.Join(
+		p.Priority.apply(thread),
+		p.Affinity.apply(thread, worker),
+	)
+}
+
+// afterStart applies the settings that can only be set on a running process, the process (and its process group,
+// see beforeStart) is killed when they cannot be applied.
+func (p ProcessConfig) afterStart(pid int) error {
+	return applyRlimits(pid, p.Rlimits)
+}
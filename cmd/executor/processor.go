@@ -2,14 +2,21 @@ package executor
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 
+	"filippo.io/age"
+	"github.com/FMotalleb/executor/input"
 	"github.com/FMotalleb/executor/logger"
-	"github.com/FMotalleb/executor/template"
+	"github.com/FMotalleb/executor/secrets"
+	"github.com/FMotalleb/executor/state"
 	"go.uber.org/zap"
 )
 
@@ -18,44 +25,192 @@ import (
 // run, and logging configuration preferences.
 //
 // Fields:
-// - rootCtx: A base context used for managing cancellation and timeouts.
-// - Command: The command string that will be executed.
-// - StdIn: Input data to pass to the command via stdin.
-// - Offset: Initial offset for processing (e.g., for batch operations).
-// - BatchSize: Number of items to process in a batch (if applicable).
-// - Shell: The shell program to use for command execution.
-// - ShellArgs: Additional arguments to provide to the shell.
-// - WorkingDirectory: The directory where the command will be executed.
-// - Timeout: The maximum duration allowed for command execution before timing out.
-// - Retry: The number of times to retry execution in case of failure.
-// - TryCount: Tracks the number of retry attempts made so far.
-// - logRoot: Path to the root directory where logs should be saved.
-// - logToErr: Indicator of whether logs should also be directed to stderr.
+//   - rootCtx: A base context used for managing cancellation and timeouts.
+//   - Command: The command string that will be executed.
+//   - StdIn: Input data to pass to the command via stdin.
+//   - Offset: Initial offset for processing (e.g., for batch operations).
+//   - BatchSize: Number of items to process in a batch (if applicable).
+//   - Shell: The shell program to use for command execution.
+//   - ShellArgs: Additional arguments to provide to the shell.
+//   - WorkingDirectory: The directory where the command will be executed.
+//   - Env: Controls the environment variables passed to the process.
+//   - Process: Settings applied to the spawned process (e.g. cgroup limits).
+//   - Systemd: Settings of the systemd-run backend, when enabled the shell is launched in a transient scope.
+//   - Timeout: The maximum duration allowed for command execution before timing out.
+//   - Retry: The number of times to retry execution in case of failure (--retry, used by the default retry policy).
+//   - TryCount: Tracks the number of retry attempts made so far.
+//   - Priority: Priority (or weight) of the batch, used by the distribution strategies.
+//   - RunID: Identifier of the run this batch belongs to.
+//   - RunName: Name of the executor instance (--name), empty if unnamed.
+//   - BatchID: Unique identifier (UUID) of the batch, stable across retries.
+//   - Label: Label of the batch, used to group batches in the report.
+//   - Task: Name of the task the batch runs (--task), empty when the batches run the single command.
+//   - Stream: Partition of the consumed message the batch runs (e.g. p3 for kafka), part of the batch name since
+//     offsets are only unique within a partition. Empty outside of consumer mode.
+//   - NotBefore: Earliest time the batch may start, zero means no constraint.
+//   - Worker: Index of the worker processing the batch.
+//   - processRunner: Runs the process of each attempt (see ProcessRunner).
+//   - done: Idempotency key template and store of completed keys.
+//   - skipped: Whether the batch was skipped because its done key was already stored.
+//   - retryPolicy: Decides whether a failed attempt is retried.
+//   - hooks: Commands run once the result of the batch is known (after it succeeded or exhausted its retries).
+//   - hostname: Name of the host executor runs on.
+//   - items: Work items of the batch when an input source is used (`.item`/`.items` in templates).
+//   - deadline: Absolute deadline of the current attempt, after which the process is killed.
+//   - tempDir: Scratch directory of the process (TMPDIR), empty keeps the inherited one.
+//   - contextFile: Whether each attempt gets a JSON context file (EXECUTOR_CONTEXT) in a temp dir of its own.
+//   - contextPath: Path of the context file of the current attempt, empty outside of an attempt.
+//   - logRoot: Path to the root directory where logs should be saved.
+//   - logToErr: Indicator of whether logs should also be directed to stderr.
+//   - middlewares: Wrap the processing of every attempt (see Middleware).
+//   - extraEnv: Environment variables set by middlewares (see Setenv).
+//   - scriptVars: Template variables set by the wasm transform module for the current attempt.
+//   - secrets: Resolved secrets, exposed as environment variables and `.secrets` in templates, never logged.
+//   - secretResolver: Resolves `secret "name"` in the templates rendered when the process is spawned.
+//   - funcs: Template functions of the run (state of previous runs), on top of the built-in ones.
+//   - resolvedSecrets: Values of the secrets and those resolved by `secret` for the current attempt, redacted from the logs.
+//   - previous: Summary of the last completed batch at the time this batch was picked up (`.prev` in templates).
+//   - tail: Output tail kept in memory instead of the log when the batch is not sampled, nil for sampled batches.
+//   - tailFlushed: Whether a failed attempt wrote its output tail into the log of a batch that is not sampled.
+//   - capture: Tail of the output of the latest attempt kept in memory for the report, nil when disabled.
+//   - annotations: Annotations printed by the process (`::executor::note=...`) across all attempts.
+//   - logFileMode: Permissions of the log file, zero keeps the default.
+//   - logRecipients: age recipients the log file is encrypted to, empty for a plain log file.
+//   - encryptedLog: Encrypted log file shared by the attempts of the batch, nil unless encryption is enabled.
+//   - logRateLimit: Maximum bytes per second copied from the process output into its log, zero means unlimited.
+//   - logFlush: How often the output is written into the (plain) log file and synced to disk.
 type ExecRequest struct {
 	rootCtx          context.Context
 	Command          string
 	StdIn            string
-	Offset           int
-	BatchSize        int
+	Offset           int64
+	BatchSize        int64
 	Shell            string
 	ShellArgs        []string
 	WorkingDirectory string
+	Env              EnvConfig
+	Process          ProcessConfig
+	Systemd          SystemdConfig
 	Timeout          time.Duration
 	Retry            uint
 	TryCount         uint
+	Priority         int
+	RunID            string
+	RunName          string
+	BatchID          string
+	Label            string
+	Task             string
+	Stream           string
+	NotBefore        time.Time
+	Worker           int
+	processRunner    ProcessRunner
+	done             DoneKeyConfig
+	skipped          bool
+	retryPolicy      RetryPolicy
+	hooks            BatchHooks
+	hostname         string
+	deadline         time.Time
+	items            []input.Item
+	tempDir          string
+	contextFile      bool
+	contextPath      string
 	logRoot          string
 	logToErr         bool
+	logFileMode      os.FileMode
+	logRecipients    []age.Recipient
+	encryptedLog     *logger.EncryptedFile
+	logRateLimit     int
+	logFlush         logger.FlushPolicy
+	annotations      *annotationSet
+	tail             *outputCapture
+	tailFlushed      bool
+	capture          *outputCapture
+	previous         map[string]any
+	middlewares      []Middleware
+	extraEnv         map[string]string
+	scriptVars       map[string]any
+	secrets          map[string]string
+	secretResolver   *secrets.Resolver
+	funcs            map[string]any
+	resolvedSecrets  []string
+}
+
+// ExitError is returned when the spawned process exits with a non-zero status.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("process exited with non-zero status: %d", e.Code)
+}
+
+// name of the batch, used as process name and log file name.
+func (e *ExecRequest) name() string {
+	prefix := "exec"
+	if e.Stream != "" {
+		prefix += "-" + e.Stream
+	}
+	if e.Task != "" {
+		return fmt.Sprintf("%s-%d-%d-%s", prefix, e.Offset, e.BatchSize, e.Task)
+	}
+	return fmt.Sprintf("%s-%d-%d", prefix, e.Offset, e.BatchSize)
+}
+
+// logPath returns the path of the batch log file, or an empty string when logging to stderr.
+func (e *ExecRequest) logPath() string {
+	if e.logToErr {
+		return ""
+	}
+	if len(e.logRecipients) != 0 {
+		return filepath.Join(e.logRoot, e.name()+logger.EncryptedExt)
+	}
+	return filepath.Join(e.logRoot, e.name()+".log")
 }
 
 // getVarMap to be used in template engine.
 func (e *ExecRequest) getVarMap() map[string]any {
-	return map[string]any{
+	vars := map[string]any{
 		"offset":      e.Offset,
 		"batchSize":   e.BatchSize,
 		"limit":       e.Offset + e.BatchSize,
 		"tryCount":    e.TryCount,
 		"maxTryCount": e.Retry,
+		"prev":        e.previous,
+		"secrets":     e.secrets,
+		"runID":       e.RunID,
+		"name":        e.RunName,
+		"batchID":     e.BatchID,
+		"task":        e.Task,
+		"worker":      e.Worker,
+		"hostname":    e.hostname,
+		"tempDir":     e.tempDir,
+		"now":         time.Now(),
+		"deadline":    e.formatDeadline(),
+	}
+	if len(e.items) != 0 {
+		// variables of the first item are exposed as is, handy with a batch size of one
+		for name, value := range e.items[0].Vars {
+			vars[name] = value
+		}
+		values := make([]any, len(e.items))
+		for i, item := range e.items {
+			values[i] = item.Value
+		}
+		vars["item"] = values[0]
+		vars["items"] = values
+	}
+	for name, value := range e.scriptVars {
+		vars[name] = value
 	}
+	return vars
+}
+
+// formatDeadline returns the deadline of the current attempt in RFC 3339, empty outside of an attempt.
+func (e *ExecRequest) formatDeadline() string {
+	if e.deadline.IsZero() {
+		return ""
+	}
+	return e.deadline.Format(time.RFC3339)
 }
 
 // processor is a function that processes execution requests.
@@ -64,9 +219,10 @@ func (e *ExecRequest) getVarMap() map[string]any {
 // and results of each request, including errors and successful completions.
 //
 // Parameters:
-//   - wg: A WaitGroup used to synchronize the completion of all processing tasks.
-//   - requests: A receive-only channel of pointers to ExecRequest objects, which
-//     contain the details of the commands to be executed.
+//   - ctx: Context used by the worker health checks.
+//   - id: Index of the worker, used in logs and health reports.
+//   - pool: The worker pool this processor belongs to, it provides the request
+//     channel, the WaitGroup and the health checker.
 //
 // The function performs the following steps for each request:
 //  1. Logs the receipt of the request.
@@ -76,58 +232,248 @@ func (e *ExecRequest) getVarMap() map[string]any {
 //     a file or standard error based on the request's configuration.
 //  5. Logs the outcome of the process execution (success or failure).
 //
+// Between requests the processor runs periodic health checks (if enabled),
+// an unhealthy processor stops receiving requests and leaves the pool.
+//
 // The function ensures that the WaitGroup counter is decremented for each
 // processed request, signaling its completion.
-func processor(wg *sync.WaitGroup, requests <-chan *ExecRequest) {
-	log := logger.Get("Processor")
-	for r := range requests {
-		for r.TryCount <= r.Retry {
-			if err := process(log, r); err != nil {
-				r.TryCount++
-			} else {
-				break
+func processor(ctx context.Context, id int, pool *workerPool) {
+	log := pool.log.Named("Processor").With(zap.Int("worker", id))
+	tick, stop := pool.health.ticker()
+	defer stop()
+	for {
+		select {
+		case r, ok := <-pool.requests:
+			if !ok {
+				pool.leave()
+				return
+			}
+			r.Worker = id
+			r.previous = pool.stats.previous()
+			started := time.Now()
+			err := runAttempts(ctx, log, pool, r)
+			record := pool.stats.recordBatch(r, err, time.Since(started))
+			pool.listener.OnBatchFinished(record)
+			pool.results.publish(record, err)
+			pool.wg.Done()
+		case <-tick:
+			if err := pool.health.check(ctx); err != nil {
+				pool.retire(ctx, id, err)
+				return
+			}
+		}
+	}
+}
+
+// runAttempts processes the request until it succeeds or the retry policy gives up.
+// The batch is recorded as started in the state journal before the first attempt, a batch whose start
+// could not be recorded is never spawned, so a crash can not leave an unrecorded batch behind.
+func runAttempts(ctx context.Context, log *zap.Logger, pool *workerPool, r *ExecRequest) (err error) {
+	// a panicking batch must not take the whole run (and its final report) down,
+	// it stays in flight in the state journal since its outcome is unknown
+	defer func() {
+		if p := recover(); p != nil {
+			log.Error("panic while processing batch", zap.String("batch", r.name()), zap.Any("panic", p), zap.Stack("stack"))
+			err = fmt.Errorf("panic while processing batch: %v", p)
+		}
+	}()
+	doneKey, err := r.done.key(r)
+	if err != nil {
+		log.Error("batch is not processed", zap.String("batch", r.name()), zap.Error(err))
+		return err
+	}
+	if r.skipped, err = r.done.isDone(doneKey); err != nil {
+		log.Error("failed to check the done key, batch is not processed", zap.String("batch", r.name()), zap.Error(err))
+		return err
+	}
+	if r.skipped {
+		log.Info("batch already done, skipped", zap.String("batch", r.name()), zap.String("done_key", doneKey))
+		if err := pool.journal.Append(batchRecord(state.EventDone, r, nil)); err != nil {
+			log.Error("failed to record batch result", zap.String("batch", r.name()), zap.Error(err))
+		}
+		if err := pool.queue.ack(r, nil); err != nil {
+			log.Error("failed to ack batch", zap.String("batch", r.name()), zap.Error(err))
+		}
+		return nil
+	}
+	// the capacity is held by each attempt, a batch waiting for its retry holds none
+	releaseCapacity, err := pool.reservations.acquire(ctx, log, r)
+	if err != nil {
+		log.Error("batch is not processed", zap.String("batch", r.name()), zap.Error(err))
+		return err
+	}
+	defer func() { releaseCapacity() }()
+	if err := pool.journal.Append(batchRecord(state.EventStart, r, nil)); err != nil {
+		log.Error("failed to record batch start, batch is not processed", zap.String("batch", r.name()), zap.Error(err))
+		return err
+	}
+	pool.listener.OnBatchStarted(*newBatchEvent(r, nil))
+	defer func() {
+		if err := r.closeLog(); err != nil {
+			log.Error("failed to close batch log", zap.String("batch", r.name()), zap.Error(err))
+		}
+	}()
+	batchStarted := time.Now()
+attempts:
+	for {
+		if cErr := ctx.Err(); cErr != nil {
+			// the run ended, the batch is not attempted (again), a failed attempt keeps its error
+			if err == nil {
+				err = cErr
+			}
+			break
+		}
+		release := pool.acquireAttempt(ctx, r.TryCount)
+		started := time.Now()
+		err = process(log, r)
+		release()
+		releaseCapacity()
+		if errors.Is(err, ErrSkipBatch) {
+			log.Info("batch skipped by a middleware", zap.String("batch", r.name()), zap.Error(err))
+			r.skipped, err = true, nil
+			break
+		}
+		pool.stats.recordAttempt(err)
+		if err == nil {
+			break
+		}
+		if errors.Is(err, ErrVetoed) {
+			log.Info("batch vetoed by a middleware", zap.String("batch", r.name()), zap.Error(err))
+			break
+		}
+		decision := r.retryPolicy.Decide(r.attempt(err, time.Since(started)))
+		if !decision.Retry {
+			break
+		}
+		retried := newBatchEvent(r, err)
+		retried.RetryIn = decision.Delay
+		pool.events.batchRetried(retried)
+		pool.listener.OnBatchRetried(*retried)
+		r.TryCount++
+		if decision.Delay > 0 {
+			log.Debug("delaying retry", zap.String("batch", r.name()), zap.Duration("delay", decision.Delay))
+			select {
+			case <-time.After(decision.Delay):
+			case <-ctx.Done():
+				break attempts
+			}
+		}
+		next, rErr := pool.reservations.acquire(ctx, log, r)
+		if rErr != nil {
+			// an ended run keeps the error of the failed attempt
+			if ctx.Err() == nil {
+				log.Error("batch is not retried", zap.String("batch", r.name()), zap.Error(rErr))
+				err = rErr
 			}
+			break
+		}
+		releaseCapacity = next
+	}
+	event := state.EventDone
+	if err != nil {
+		event = state.EventFail
+	} else if !r.skipped {
+		if mErr := r.done.markDone(doneKey); mErr != nil {
+			log.Error("failed to store the done key", zap.String("batch", r.name()), zap.String("done_key", doneKey), zap.Error(mErr))
+		}
+	}
+	if jErr := pool.journal.Append(batchRecord(event, r, err)); jErr != nil {
+		log.Error("failed to record batch result", zap.String("batch", r.name()), zap.Error(jErr))
+	}
+	// a batch interrupted by the end of the run stays in the queue, it is processed again on resume
+	if err == nil || ctx.Err() == nil {
+		if qErr := pool.queue.ack(r, err); qErr != nil {
+			log.Error("failed to ack batch", zap.String("batch", r.name()), zap.Error(qErr))
+		}
+	}
+	if err != nil && ctx.Err() == nil {
+		pool.events.batchFailed(r, err)
+	}
+	if err != nil && ctx.Err() == nil && r.hooks.OnFailure != "" {
+		// the hook may read the log, it must be complete
+		if cErr := r.closeLog(); cErr != nil {
+			log.Error("failed to close batch log", zap.String("batch", r.name()), zap.Error(cErr))
+		}
+		r.runFailureHook(ctx, log, err)
+	}
+	if err == nil && !r.skipped && r.hooks.OnSuccess != "" {
+		if cErr := r.closeLog(); cErr != nil {
+			log.Error("failed to close batch log", zap.String("batch", r.name()), zap.Error(cErr))
 		}
-		wg.Done()
+		r.runSuccessHook(ctx, log, time.Since(batchStarted))
 	}
+	return err
 }
 
+// process runs an attempt of the request through its middlewares.
 func process(log *zap.Logger, r *ExecRequest) error {
+	ctx, cancel := context.WithTimeout(r.rootCtx, r.Timeout)
+	defer cancel()
+	r.deadline, _ = ctx.Deadline()
+	return chain(r.middlewares, func(ctx context.Context, r *ExecRequest) error {
+		return runProcess(ctx, log, r)
+	})(ctx, r)
+}
+
+// runProcess renders the command of the request and spawns its process.
+func runProcess(ctx context.Context, log *zap.Logger, r *ExecRequest) error {
 	rLog := log.With(
 		zap.Any("request", r),
 	)
 
 	rLog.Debug("received request for processing")
 
+	removeContext, err := r.writeContextFile()
+	if err != nil {
+		rLog.Error("failed to write batch context file", zap.Error(err))
+		return err
+	}
+	defer removeContext()
 	name, args, stdin, out, err := prepareArgs(rLog, r)
 	if err != nil {
 		return err
 	}
-	ctx, cancel := context.WithTimeout(r.rootCtx, r.Timeout)
-	defer cancel()
+	defer func() {
+		if err := logger.CloseWriter(out); err != nil {
+			rLog.Error("failed to close batch log", zap.Error(err))
+		}
+	}()
+	env, err := r.environ()
+	if err != nil {
+		rLog.Error("failed to build process environment", zap.Error(err))
+		return err
+	}
+	program, args := r.Systemd.wrap(name, r.Shell, args)
 	rLog.Debug(
 		"spawning process",
 		zap.String("process_name", name),
 		zap.String("shell", r.Shell),
-		zap.Strings("args", args),
+		zap.String("program", program),
+		zap.Strings("args", r.redactAll(args)),
 		zap.String("working_directory", r.WorkingDirectory),
 	)
 
-	err = spawnProcess(
-		ctx,
-		name,
-		r.Shell,
-		args,
-		r.WorkingDirectory,
-		stdin,
-		out,
-	)
+	err = r.processRunner.Run(ctx, Process{
+		Name:         name,
+		Program:      program,
+		Args:         args,
+		RedactedArgs: r.redactAll(args),
+		Dir:          r.WorkingDirectory,
+		Env:          env,
+		Stdin:        stdin,
+		Output:       out,
+		Settings:     r.Process,
+		Worker:       r.Worker,
+	})
 	if err != nil {
 		rLog.Error(
 			"process execution failed",
 			zap.Error(err),
 			zap.String("process_name", name),
 		)
+		if fErr := r.flushTail(); fErr != nil {
+			rLog.Error("failed to write output tail into batch log", zap.Error(fErr))
+		}
 		return err
 	}
 
@@ -139,7 +485,8 @@ func process(log *zap.Logger, r *ExecRequest) error {
 }
 
 func prepareArgs(rLog *zap.Logger, r *ExecRequest) (string, []string, string, io.Writer, error) {
-	cmd, err := template.EvaluateTemplate(r.Command, r.getVarMap())
+	r.resolvedSecrets = r.fetchedSecrets()
+	cmd, err := r.render(r.Command, r.getVarMap())
 	if err != nil {
 		rLog.Error(
 			"failed to evaluate command template",
@@ -148,7 +495,7 @@ func prepareArgs(rLog *zap.Logger, r *ExecRequest) (string, []string, string, io
 		)
 		return "", nil, "", nil, err
 	}
-	stdinVal, err := template.EvaluateTemplate(r.StdIn, r.getVarMap())
+	stdinVal, err := r.render(r.StdIn, r.getVarMap())
 	if err != nil {
 		rLog.Error(
 			"failed to evaluate command template",
@@ -158,32 +505,43 @@ func prepareArgs(rLog *zap.Logger, r *ExecRequest) (string, []string, string, io
 		return "", nil, "", nil, err
 	}
 
-	rLog.Debug("successfully evaluated command template", zap.String("evaluated_command", cmd))
+	rLog.Debug("successfully evaluated command template", zap.String("evaluated_command", r.redact(cmd)))
 	args := r.ShellArgs
 	args = append(args, cmd)
 
-	name := fmt.Sprintf("exec-%d-%d", r.Offset, r.BatchSize)
-	var out io.Writer
-	if r.logToErr {
-		out = logger.NewStdErrWriter(name)
-	} else {
-		out = logger.NewFileWriter(name, r.logRoot)
+	name := r.name()
+	var out io.Writer = io.Discard
+	if r.sampled() {
+		if out, err = r.logWriter(); err != nil {
+			rLog.Error("failed to open batch log", zap.Error(err))
+			return "", nil, "", nil, err
+		}
 	}
+	out = r.tail.wrap(out)
+	out = logger.NewRateLimitedWriter(out, r.logRateLimit)
+	out = r.capture.wrap(out)
+	// outermost, the annotations are scanned per stream of the process
+	out = r.annotations.wrap(out)
 	return name, args, stdinVal, out, nil
 }
 
 func spawnProcess(
 	ctx context.Context,
+	base *zap.Logger,
 	name string,
 	program string,
 	args []string,
+	shownArgs []string,
 	wd string,
+	env []string,
 	stdin string,
 	out io.Writer,
+	pc ProcessConfig,
+	worker int,
 ) error {
-	log := logger.Get("Spawner."+name).With(
+	log := base.Named("Spawner."+name).With(
 		zap.String("program", program),
-		zap.Strings("args", args),
+		zap.Strings("args", shownArgs),
 		zap.String("working_directory", wd),
 	)
 
@@ -191,26 +549,72 @@ func spawnProcess(
 
 	log.Debug("attempting to start process")
 	proc := exec.CommandContext(ctx, program, args...)
+	proc.Dir = wd
+	proc.Env = env
+	setShellCommandLine(proc)
+
+	cleanup, err := pc.beforeStart(proc, name)
+	if err != nil {
+		log.Error("failed to prepare process", zap.Error(err))
+		return err
+	}
+	defer cleanup()
+
+	job, err := newProcessJob(proc, pc.KillOnParentDeath)
+	if err != nil {
+		log.Error("failed to prepare process", zap.Error(err))
+		return err
+	}
+	defer job.close()
 
-	err := connectPipes(proc, out, stdin)
+	copies, started, err := connectPipes(base.Named("OutputPipes"), proc, out, stdin, pc.PTY)
 	if err != nil {
 		log.Error("failed to build output pipes", zap.Error(err))
 		return err
 	}
 
 	sigChan := make(chan int)
-	go spawnSubprocess(proc, log, sigChan)
+	guard := newMemoryGuard(pc.MaxRSS, log)
+	go spawnSubprocess(proc, pc, job, started, worker, guard, log, sigChan)
 
-	if ec := <-sigChan; ec != 0 {
+	ec := <-sigChan
+	guard.stop()
+	// make sure every byte of output reached the writer before reporting the result
+	grace := pc.outputGrace()
+	if lost := copies.wait(grace); len(lost) != 0 {
+		log.Warn(
+			"output is still held open by processes left running in the background, the rest of it is not captured",
+			zap.Strings("streams", lost),
+			zap.Duration("output_grace", grace),
+		)
+	}
+	if guard.tripped() {
+		return ErrMaxRSSExceeded
+	}
+	if ec != 0 {
 		log.Error("process exited with non-zero status", zap.Int("exit_code", ec))
-		return fmt.Errorf("process exited with non-zero status: %d", ec)
+		return &ExitError{Code: ec}
 	}
 	log.Info("process exited cleanly", zap.Int("exit_code", 0))
 	return nil
 }
 
-func spawnSubprocess(proc *exec.Cmd, log *zap.Logger, sigChan chan int) {
+func spawnSubprocess(
+	proc *exec.Cmd,
+	pc ProcessConfig,
+	job *processJob,
+	started func(),
+	worker int,
+	guard *memoryGuard,
+	log *zap.Logger,
+	sigChan chan int,
+) {
+	if err := pc.applyInherited(worker); err != nil {
+		// the process is never started, Start fails with the error and releases its pipes
+		proc.Err = fmt.Errorf("failed to apply process settings: %w", err)
+	}
 	err := proc.Start()
+	started()
 	if err != nil {
 		log.Error("failed to start process", zap.Error(err))
 		sigChan <- 1
@@ -219,6 +623,14 @@ func spawnSubprocess(proc *exec.Cmd, log *zap.Logger, sigChan chan int) {
 
 	log.Info("process started successfully", zap.Int("pid", proc.Process.Pid))
 
+	if err := errors.Join(job.assign(proc.Process.Pid), pc.afterStart(proc.Process.Pid)); err != nil {
+		log.Error("failed to apply process settings, killing the process", zap.Error(err))
+		if kErr := killProcessGroup(proc); kErr != nil {
+			log.Error("failed to kill process", zap.Error(kErr))
+		}
+	}
+	guard.watch(proc.Process.Pid)
+
 	stat, err := proc.Process.Wait()
 	if err != nil {
 		log.Error("failed to wait for process exit", zap.Error(err))
@@ -230,28 +642,97 @@ func spawnSubprocess(proc *exec.Cmd, log *zap.Logger, sigChan chan int) {
 	sigChan <- exitCode
 }
 
-func connectPipes(proc *exec.Cmd, out io.Writer, stdin string) error {
-	log := logger.Get("OutputPipes")
-	oR, oErr := proc.StdoutPipe()
-	if oErr != nil {
-		return oErr
-	}
-	eR, eErr := proc.StderrPipe()
-	if eErr != nil {
-		return eErr
-	}
+// outputCopies tracks the copies of the output of a process into its batch log.
+type outputCopies struct {
+	wg      sync.WaitGroup
+	readers []io.Closer
+	// lock guards pending, the streams not fully copied yet.
+	lock    sync.Mutex
+	pending []string
+}
+
+// copy copies r into out until r is drained or closed.
+func (c *outputCopies) copy(log *zap.Logger, out io.Writer, r io.ReadCloser, stream string) {
+	c.readers = append(c.readers, r)
+	c.pending = append(c.pending, stream)
+	c.wg.Add(1)
 	go func() {
-		_, err := io.Copy(out, oR)
-		if err != nil {
-			log.Error("failed to write stdout to file", zap.Error(err))
+		defer c.wg.Done()
+		_, err := io.Copy(streamWriter(out, stream), r)
+		c.lock.Lock()
+		c.pending = slices.DeleteFunc(c.pending, func(s string) bool { return s == stream })
+		c.lock.Unlock()
+		if err != nil && !errors.Is(err, os.ErrClosed) && !isTerminalClosed(err) {
+			log.Error("failed to write "+stream+" to file", zap.Error(err))
 		}
 	}()
+}
+
+// wait waits until the output is fully copied, at most grace. It then closes the read ends and
+// returns the streams whose output was cut off, none when the output is complete.
+func (c *outputCopies) wait(grace time.Duration) []string {
+	done := make(chan struct{})
 	go func() {
-		_, err := io.Copy(out, eR)
+		c.wg.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	var lost []string
+	select {
+	case <-done:
+	case <-timer.C:
+		c.lock.Lock()
+		lost = slices.Clone(c.pending)
+		c.lock.Unlock()
+	}
+	for _, r := range c.readers {
+		_ = r.Close()
+	}
+	<-done
+	return lost
+}
+
+// connectPipes wires stdin/stdout/stderr of the process, the returned copies end once both output
+// streams are fully copied into out. With terminal, stdout and stderr are a pseudo-terminal instead
+// of pipes, the returned function must be called once the process started (or failed to start).
+func connectPipes(
+	log *zap.Logger,
+	proc *exec.Cmd,
+	out io.Writer,
+	stdin string,
+	terminal bool,
+) (*outputCopies, func(), error) {
+	if terminal {
+		copies, started, err := attachTerminal(log, proc, out)
 		if err != nil {
-			log.Error("failed to write stderr to file", zap.Error(err))
+			return nil, nil, err
 		}
-	}()
+		if err := writeStdin(log, proc, stdin); err != nil {
+			started()
+			return nil, nil, err
+		}
+		return copies, started, nil
+	}
+	oR, oErr := proc.StdoutPipe()
+	if oErr != nil {
+		return nil, nil, oErr
+	}
+	eR, eErr := proc.StderrPipe()
+	if eErr != nil {
+		return nil, nil, eErr
+	}
+	copies := new(outputCopies)
+	copies.copy(log, out, oR, "stdout")
+	copies.copy(log, out, eR, "stderr")
+	if err := writeStdin(log, proc, stdin); err != nil {
+		return nil, nil, err
+	}
+	return copies, func() {}, nil
+}
+
+// writeStdin feeds stdin to the process through a pipe closed once it is written.
+func writeStdin(log *zap.Logger, proc *exec.Cmd, stdin string) error {
 	iW, iErr := proc.StdinPipe()
 
 	if iErr != nil {
@@ -264,7 +745,9 @@ func connectPipes(proc *exec.Cmd, out io.Writer, stdin string) error {
 		for totalWrites < mustWrite {
 			n, err := iW.Write(data[totalWrites:mustWrite])
 			if err != nil {
+				// the process exited or closed its stdin, the rest can never be written
 				log.Error("failed to write stdin to process", zap.Error(err))
+				break
 			}
 			totalWrites += n
 		}
@@ -0,0 +1,83 @@
+package executor
+
+import (
+	"context"
+	"io"
+	"slices"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Process describes the process of an attempt, as handed to a ProcessRunner.
+type Process struct {
+	// Name identifies the batch (exec-<offset>-<size>[-<task>]).
+	Name    string
+	Program string
+	Args    []string
+	// RedactedArgs are Args with the resolved secrets hidden, for logging.
+	RedactedArgs []string
+	Dir          string
+	Env          []string
+	Stdin        string
+	// Output receives stdout and stderr of the process, it is the batch log.
+	Output io.Writer
+	// Settings are the limits and placement of the process (cgroup, priority, rlimits, ...).
+	Settings ProcessConfig
+	// Worker is the index of the worker running the batch.
+	Worker int
+}
+
+// ProcessRunner runs the process of an attempt until it exits, a non-zero exit status is returned as an *ExitError.
+// The default runner spawns local processes, alternate backends (ssh, containers, ...) and tests implement
+// their own (see FakeProcessRunner).
+type ProcessRunner interface {
+	Run(ctx context.Context, p Process) error
+}
+
+// localProcessRunner spawns processes on this host.
+type localProcessRunner struct {
+	log *zap.Logger
+}
+
+func (l localProcessRunner) Run(ctx context.Context, p Process) error {
+	return spawnProcess(ctx, l.log, p.Name, p.Program, p.Args, p.RedactedArgs, p.Dir, p.Env, p.Stdin, p.Output, p.Settings, p.Worker)
+}
+
+// FakeProcessRunner records the processes of a run instead of spawning them, so configurations and templates
+// can be tested without forking. It is safe for concurrent use.
+type FakeProcessRunner struct {
+	// Result decides the output and exit code of a process, nil succeeds without output.
+	Result func(p Process) (output string, exitCode int)
+
+	lock      sync.Mutex
+	processes []Process
+}
+
+// Run records the process and writes the output decided by Result.
+func (f *FakeProcessRunner) Run(ctx context.Context, p Process) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.lock.Lock()
+	f.processes = append(f.processes, p)
+	f.lock.Unlock()
+	if f.Result == nil {
+		return nil
+	}
+	output, code := f.Result(p)
+	if _, err := io.WriteString(p.Output, output); err != nil {
+		return err
+	}
+	if code != 0 {
+		return &ExitError{Code: code}
+	}
+	return nil
+}
+
+// Processes returns the processes run so far, in the order they were started.
+func (f *FakeProcessRunner) Processes() []Process {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return slices.Clone(f.processes)
+}
@@ -0,0 +1,28 @@
+//go:build linux
+
+package executor
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// startProcessGroup makes the process the leader of a process group of its own, so the processes it spawns are
+// killed with it (see killProcessGroup), cancelling the batch kills the whole group too.
+func startProcessGroup(proc *exec.Cmd) {
+	if proc.SysProcAttr == nil {
+		proc.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	proc.SysProcAttr.Setpgid = true
+	proc.Cancel = func() error {
+		return killProcessGroup(proc)
+	}
+}
+
+// killProcessGroup kills the process and, when it leads a process group (or a session), every process of it.
+func killProcessGroup(proc *exec.Cmd) error {
+	if attr := proc.SysProcAttr; attr != nil && (attr.Setpgid || attr.Setsid) {
+		return syscall.Kill(-proc.Process.Pid, syscall.SIGKILL)
+	}
+	return proc.Process.Kill()
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package executor
+
+import "os/exec"
+
+// startProcessGroup is a no-op, the settings needing a process group are linux only.
+func startProcessGroup(_ *exec.Cmd) {}
+
+func killProcessGroup(proc *exec.Cmd) error {
+	return proc.Process.Kill()
+}
@@ -0,0 +1,68 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// watchProgress prints a one-line progress summary to stderr whenever executor receives the progress signal
+// (SIGINFO, Ctrl-T on BSD and macOS terminals) until ctx is done. It does nothing on other platforms.
+func watchProgress(ctx context.Context, stats *runStats) {
+	signals := make(chan os.Signal, 1)
+	if !notifyProgress(signals) {
+		return
+	}
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				stats.printProgress(os.Stderr)
+			}
+		}
+	}()
+}
+
+// printProgress writes the progress summary, like dd does on SIGINFO.
+func (s *runStats) printProgress(w io.Writer) {
+	s.lock.Lock()
+	// every finished batch is counted by exactly one of succeeded, failed and skipped
+	finished := s.succeeded + s.failed + s.skipped
+	// a dispatch is counted once the worker took the batch, which may finish it first
+	running := max(s.dispatched-finished, 0)
+	line := fmt.Sprintf("executor: %d", finished)
+	if s.total > 0 {
+		line += fmt.Sprintf("/%d", s.total)
+	}
+	line += fmt.Sprintf(
+		" batches finished (%d succeeded, %d failed, %d skipped), %d running, %d attempts in %s",
+		s.succeeded,
+		s.failed,
+		s.skipped,
+		running,
+		s.attempts,
+		time.Since(s.startedAt).Round(time.Second),
+	)
+	s.lock.Unlock()
+	fmt.Fprintln(w, line)
+}
+
+// setTotal records the number of planned batches, zero when it is unknown (shared queues and brokers).
+func (s *runStats) setTotal(total int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.total = total
+}
+
+// recordDispatch counts a batch handed to a worker.
+func (s *runStats) recordDispatch() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.dispatched++
+}
@@ -0,0 +1,76 @@
+//go:build linux
+
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/creack/pty"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+// ptySize is the window size of the pseudo-terminals, some tools misbehave on the 0x0 default.
+var ptySize = pty.Winsize{Rows: 24, Cols: 120}
+
+func validatePTYSupport() error {
+	return nil
+}
+
+// attachTerminal makes a pseudo-terminal the stdout, stderr and controlling terminal of the process and copies
+// its output into out, the returned copies end once the process and its children closed the terminal.
+// The returned function releases the terminal side of executor, it must be called once the process started.
+func attachTerminal(log *zap.Logger, proc *exec.Cmd, out io.Writer) (*outputCopies, func(), error) {
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open a pseudo-terminal: %w", err)
+	}
+	if err := prepareTerminal(ptmx, tty); err != nil {
+		_ = ptmx.Close()
+		_ = tty.Close()
+		return nil, nil, err
+	}
+	proc.Stdout, proc.Stderr = tty, tty
+	if proc.SysProcAttr == nil {
+		proc.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	proc.SysProcAttr.Setsid = true
+	proc.SysProcAttr.Setctty = true
+	// the controlling terminal is a descriptor of the child, stdout
+	proc.SysProcAttr.Ctty = 1
+
+	copies := new(outputCopies)
+	copies.copy(log, out, ptmx, "terminal output")
+	return copies, func() {
+		if err := tty.Close(); err != nil {
+			log.Error("failed to close terminal", zap.Error(err))
+		}
+	}, nil
+}
+
+// isTerminalClosed tells whether a read of a terminal failed because every process closed it.
+func isTerminalClosed(err error) bool {
+	return errors.Is(err, syscall.EIO)
+}
+
+// prepareTerminal sets the window size and leaves line endings untranslated, so the batch log gets the
+// output as the process wrote it instead of CRLF line endings.
+func prepareTerminal(ptmx *os.File, tty *os.File) error {
+	if err := pty.Setsize(ptmx, &ptySize); err != nil {
+		return fmt.Errorf("failed to set the terminal size: %w", err)
+	}
+	termios, err := unix.IoctlGetTermios(int(tty.Fd()), unix.TCGETS)
+	if err != nil {
+		return fmt.Errorf("failed to read the terminal attributes: %w", err)
+	}
+	termios.Oflag &^= unix.OPOST
+	if err := unix.IoctlSetTermios(int(tty.Fd()), unix.TCSETS, termios); err != nil {
+		return fmt.Errorf("failed to set the terminal attributes: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package executor
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+
+	"go.uber.org/zap"
+)
+
+func validatePTYSupport() error {
+	return errors.New("pseudo-terminals are only available on linux")
+}
+
+func attachTerminal(_ *zap.Logger, _ *exec.Cmd, _ io.Writer) (*outputCopies, func(), error) {
+	return nil, nil, validatePTYSupport()
+}
+
+func isTerminalClosed(_ error) bool {
+	return false
+}
@@ -0,0 +1,146 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/FMotalleb/executor/queue"
+	"github.com/FMotalleb/executor/state"
+	"go.uber.org/zap"
+)
+
+// QueueConfig controls the on-disk queue of planned batches used to resume a crashed run,
+// or the redis queue shared by several executor processes.
+type QueueConfig struct {
+	// Path of the queue file or redis url (redis://host:port/db), empty keeps the planned batches in memory only.
+	Path string
+	// Visibility is how long a batch pulled from a shared queue is leased before another process may take it,
+	// leases are renewed while the batch runs.
+	Visibility time.Duration
+	// Args are the command line arguments of the run, recorded so `executor resume` can restore the configuration.
+	Args []string
+	// Resume processes the unacked batches of the queue instead of planning new ones.
+	Resume bool
+	// AllowVersionChange resumes a queue filled by another major version of executor.
+	AllowVersionChange bool
+}
+
+// Validate checks the queue url and visibility timeout.
+func (c QueueConfig) Validate() error {
+	if !c.shared() {
+		return nil
+	}
+	if c.Resume {
+		return errors.New("a shared queue can not be resumed, batches of crashed processes are handed out again on their own")
+	}
+	if c.Visibility <= 0 {
+		return errors.New("queue visibility timeout must be greater than zero")
+	}
+	if _, err := url.Parse(c.Path); err != nil {
+		return fmt.Errorf("invalid queue url: %w", err)
+	}
+	return nil
+}
+
+// shared tells whether the queue is a redis queue shared by several processes.
+func (c QueueConfig) shared() bool {
+	return strings.HasPrefix(c.Path, "redis://") || strings.HasPrefix(c.Path, "rediss://")
+}
+
+// open opens the queue, a disabled queue returns nil.
+// A queue left with unacked batches by an interrupted run is only reused when resuming.
+func (c QueueConfig) open() (*queue.Queue, error) {
+	if c.Path == "" {
+		return nil, nil
+	}
+	q, err := queue.Open(c.Path)
+	if err != nil {
+		return nil, err
+	}
+	if c.Resume {
+		if err := checkVersion("queue "+c.Path, q.Version(), c.AllowVersionChange); err != nil {
+			return nil, errors.Join(err, q.Close())
+		}
+	}
+	if !c.Resume && len(q.Pending()) != 0 {
+		return nil, fmt.Errorf(
+			"queue %s holds %d unacked batches of an interrupted run, use `executor resume --queue %s` to finish them",
+			c.Path,
+			len(q.Pending()),
+			c.Path,
+		)
+	}
+	return q, nil
+}
+
+// enqueue durably stores the planned batches before any of them starts.
+func (c QueueConfig) enqueue(q *queue.Queue, batches []*ExecRequest) error {
+	if q == nil {
+		return nil
+	}
+	entries := make([]queue.Entry, 0, len(batches))
+	for _, r := range batches {
+		entries = append(entries, queue.Entry{Offset: r.Offset, BatchSize: r.BatchSize, Items: r.items})
+	}
+	return q.Push(c.Args, binaryVersion(), entries)
+}
+
+// requeue rebuilds the batches left unacked in the queue by an interrupted run,
+// the ones the state journal knows to be completed are dropped.
+func requeue(
+	ctx context.Context,
+	log *zap.Logger,
+	cfg Config,
+	run runInfo,
+	q *queue.Queue,
+	previous *state.State,
+) ([]*ExecRequest, error) {
+	pending := q.Pending()
+	log.Info("resuming unacked batches of the queue", zap.String("queue", cfg.Queue.Path), zap.Int("count", len(pending)))
+	batches := make([]*ExecRequest, 0, len(pending))
+	for _, e := range pending {
+		req, err := dequeued(ctx, cfg, run, e)
+		if err != nil {
+			log.Error("failed to plan batches", zap.Error(err))
+			return nil, err
+		}
+		batches = append(batches, req)
+	}
+	return cfg.State.resume(log, batches, previous)
+}
+
+// dequeued rebuilds the batch of a queue entry.
+func dequeued(ctx context.Context, cfg Config, run runInfo, e queue.Entry) (*ExecRequest, error) {
+	req := newRequest(ctx, cfg, run, e.Offset, e.BatchSize)
+	req.items = e.Items
+	if err := req.evaluate(cfg); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// batchSource hands out the batches to dispatch: the scheduler of the planned batches or a shared queue.
+type batchSource interface {
+	// next returns the next batch that may start at now, or nil and the time to ask again.
+	// Once every batch was handed out it returns nil and the zero time.
+	next(now time.Time) (*ExecRequest, time.Time)
+}
+
+// batchAcker settles the batches whose result is known, so they are not handed out again.
+type batchAcker interface {
+	// ack is called with the error of the last attempt of the batch, never for a batch interrupted by the end of the run.
+	ack(r *ExecRequest, err error) error
+}
+
+// fileQueue acknowledges batches in the on-disk queue, whatever their result.
+type fileQueue struct {
+	*queue.Queue
+}
+
+func (q fileQueue) ack(r *ExecRequest, _ error) error {
+	return q.Ack(r.Offset, r.BatchSize)
+}
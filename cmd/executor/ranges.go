@@ -0,0 +1,92 @@
+package executor
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Range is a half-open interval [Begin, End) of offsets.
+type Range struct {
+	Begin int64
+	End   int64
+}
+
+func (r Range) String() string {
+	return strconv.FormatInt(r.Begin, 10) + ":" + strconv.FormatInt(r.End, 10)
+}
+
+// ParseRange parses `begin:end`.
+func ParseRange(s string) (Range, error) {
+	begin, end, found := strings.Cut(s, ":")
+	if !found {
+		return Range{}, fmt.Errorf("invalid range %q, expected begin:end", s)
+	}
+	var r Range
+	var err error
+	if r.Begin, err = strconv.ParseInt(strings.TrimSpace(begin), 10, 64); err != nil {
+		return Range{}, fmt.Errorf("invalid range begin %q: %w", s, err)
+	}
+	if r.End, err = strconv.ParseInt(strings.TrimSpace(end), 10, 64); err != nil {
+		return Range{}, fmt.Errorf("invalid range end %q: %w", s, err)
+	}
+	if r.Begin < 0 || r.End <= r.Begin {
+		return Range{}, fmt.Errorf("invalid range %q, begin must be non-negative and lower than end", s)
+	}
+	return r, nil
+}
+
+// RangeList is a repeatable flag value of ranges.
+type RangeList []Range
+
+func (l *RangeList) String() string {
+	parts := make([]string, len(*l))
+	for i, r := range *l {
+		parts[i] = r.String()
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+// Set appends comma separated ranges, `@path` reads them from a file (one or more per line, e.g. the output of `executor gaps`).
+func (l *RangeList) Set(s string) error {
+	if path, ok := strings.CutPrefix(s, "@"); ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		s = strings.Join(strings.Fields(strings.ReplaceAll(string(data), ",", " ")), ",")
+		if s == "" {
+			return fmt.Errorf("range file %q is empty", path)
+		}
+	}
+	for _, part := range strings.Split(s, ",") {
+		r, err := ParseRange(part)
+		if err != nil {
+			return err
+		}
+		*l = append(*l, r)
+	}
+	return nil
+}
+
+// validate checks that the ranges are disjoint, the offsets of overlapping ranges would run twice.
+// Adjacent ranges (0:100,100:200) are disjoint.
+func (l RangeList) validate() error {
+	sorted := slices.Clone(l)
+	slices.SortFunc(sorted, func(a, b Range) int {
+		return cmp.Compare(a.Begin, b.Begin)
+	})
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Begin < sorted[i-1].End {
+			return fmt.Errorf("ranges %s and %s overlap, ranges must be disjoint", sorted[i-1], sorted[i])
+		}
+	}
+	return nil
+}
+
+func (l *RangeList) Type() string {
+	return "begin:end"
+}
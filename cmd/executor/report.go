@@ -0,0 +1,282 @@
+package executor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ReportFormatJSON     = "json"
+	ReportFormatMarkdown = "markdown"
+
+	reportFileMode        = 0o644
+	reportSlowestBatches  = 10
+	markdownTableSplitter = " | "
+)
+
+// BatchRecord is the final outcome of a single batch.
+type BatchRecord struct {
+	BatchID   string `json:"batch_id"`
+	Offset    int64  `json:"offset"`
+	BatchSize int64  `json:"batch_size"`
+	Label     string `json:"label,omitempty"`
+	Task      string `json:"task,omitempty"`
+	// Stream is the partition of the consumed message of the batch (see ExecRequest.Stream).
+	Stream   string        `json:"stream,omitempty"`
+	Attempts uint          `json:"attempts"`
+	ExitCode int           `json:"exit_code"`
+	Success  bool          `json:"success"`
+	Duration time.Duration `json:"duration"`
+	LogPath  string        `json:"log_path,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	// ErrorClass categorizes the failure: exit (non-zero status), oom (max rss exceeded) or error.
+	ErrorClass string `json:"error_class,omitempty"`
+	// Output is the tail of the output of the last attempt (see --capture-output-inline).
+	Output string `json:"output,omitempty"`
+	// Skipped is set when the batch was not run since its done key was already stored (see --done-key).
+	Skipped bool `json:"skipped,omitempty"`
+
+	Annotations []Annotation `json:"annotations,omitempty"`
+}
+
+// Report summarizes a run, it is written at the end of the execution when a report path is configured.
+type Report struct {
+	RunID      string         `json:"run_id"`
+	Name       string         `json:"name,omitempty"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	Duration   time.Duration  `json:"duration"`
+	Aborted    bool           `json:"aborted"`
+	Succeeded  int            `json:"succeeded"`
+	Failed     int            `json:"failed"`
+	Skipped    int            `json:"skipped,omitempty"`
+	Attempts   int            `json:"attempts"`
+	ExitCodes  map[string]int `json:"exit_codes"`
+	// Groups breaks the counters down by batch label, it is only present when batches are labeled.
+	Groups  map[string]*GroupSummary `json:"groups,omitempty"`
+	Batches []BatchRecord            `json:"batches"`
+	// Dropped is the number of batch records missing from Batches (and Groups): runs consuming messages or
+	// following their input only keep the most recent records.
+	Dropped int `json:"dropped_batches,omitempty"`
+}
+
+// GroupSummary holds the counters of the batches sharing a label.
+type GroupSummary struct {
+	Batches       int           `json:"batches"`
+	Succeeded     int           `json:"succeeded"`
+	Failed        int           `json:"failed"`
+	Attempts      int           `json:"attempts"`
+	TotalDuration time.Duration `json:"total_duration"`
+	MaxDuration   time.Duration `json:"max_duration"`
+}
+
+// ReportConfig holds the report destination.
+type ReportConfig struct {
+	Path   string
+	Format string
+}
+
+// Validate checks the report format, the markdown summary is written next to the report so it needs a path.
+func (r ReportConfig) Validate() error {
+	switch r.Format {
+	case "", ReportFormatJSON:
+		return nil
+	case ReportFormatMarkdown:
+		if r.Path == "" {
+			return errors.New("markdown report format requires a report path (--report)")
+		}
+		if r.markdownPath() == r.Path {
+			return errors.New("markdown report would overwrite the json report, use a different report path")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown report format: %q", r.Format)
+	}
+}
+
+// markdownPath returns the path of the markdown summary, the report path with a `.md` extension.
+func (r ReportConfig) markdownPath() string {
+	return strings.TrimSuffix(r.Path, filepath.Ext(r.Path)) + ".md"
+}
+
+// Write stores the report at the configured path as JSON, the Markdown variant (if requested)
+// is written alongside it using the same name with a `.md` extension.
+func (r ReportConfig) Write(report *Report) error {
+	if r.Path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	if err := os.WriteFile(r.Path, data, reportFileMode); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	if r.Format != ReportFormatMarkdown {
+		return nil
+	}
+	mdPath := r.markdownPath()
+	if mdPath == r.Path {
+		return errors.New("markdown report would overwrite the json report, use a different report path")
+	}
+	if err := os.WriteFile(mdPath, []byte(report.Markdown()), reportFileMode); err != nil {
+		return fmt.Errorf("failed to write markdown report: %w", err)
+	}
+	return nil
+}
+
+// Markdown renders a compact summary of the report suitable for issue trackers.
+func (r *Report) Markdown() string {
+	b := new(strings.Builder)
+	status := "finished"
+	if r.Aborted {
+		status = "aborted"
+	}
+	title := "`" + r.RunID + "`"
+	if r.Name != "" {
+		title = r.Name + " " + title
+	}
+	fmt.Fprintf(b, "## Executor run report %s (%s)\n\n", title, status)
+	writeMarkdownTable(b,
+		[]string{"Started", "Finished", "Duration", "Batches", "Succeeded", "Failed", "Attempts"},
+		[][]string{{
+			r.StartedAt.Format(time.RFC3339),
+			r.FinishedAt.Format(time.RFC3339),
+			r.Duration.Round(time.Millisecond).String(),
+			strconv.Itoa(len(r.Batches) + r.Dropped),
+			strconv.Itoa(r.Succeeded),
+			strconv.Itoa(r.Failed),
+			strconv.Itoa(r.Attempts),
+		}},
+	)
+
+	b.WriteString("\n### Exit codes\n\n")
+	codes := make([]string, 0, len(r.ExitCodes))
+	for code := range r.ExitCodes {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		a, _ := strconv.Atoi(codes[i])
+		c, _ := strconv.Atoi(codes[j])
+		return a < c
+	})
+	rows := make([][]string, 0, len(codes))
+	for _, code := range codes {
+		rows = append(rows, []string{code, strconv.Itoa(r.ExitCodes[code])})
+	}
+	writeMarkdownTable(b, []string{"Exit code", "Attempts"}, rows)
+
+	if len(r.Groups) != 0 {
+		labels := make([]string, 0, len(r.Groups))
+		for label := range r.Groups {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		rows = rows[:0]
+		for _, label := range labels {
+			g := r.Groups[label]
+			rows = append(rows, []string{
+				label,
+				strconv.Itoa(g.Batches),
+				strconv.Itoa(g.Succeeded),
+				strconv.Itoa(g.Failed),
+				strconv.Itoa(g.Attempts),
+				g.TotalDuration.Round(time.Millisecond).String(),
+				g.MaxDuration.Round(time.Millisecond).String(),
+			})
+		}
+		b.WriteString("\n### By label\n\n")
+		writeMarkdownTable(
+			b,
+			[]string{"Label", "Batches", "Succeeded", "Failed", "Attempts", "Total duration", "Max duration"},
+			rows,
+		)
+	}
+
+	rows = rows[:0]
+	for _, batch := range r.Batches {
+		if batch.Success {
+			continue
+		}
+		rows = append(rows, []string{
+			strconv.FormatInt(batch.Offset, 10),
+			strconv.FormatInt(batch.BatchSize, 10),
+			strconv.FormatUint(uint64(batch.Attempts), 10),
+			strconv.Itoa(batch.ExitCode),
+			batch.ErrorClass,
+			batch.Duration.Round(time.Millisecond).String(),
+			markdownCode(batch.LogPath),
+			batch.Error,
+		})
+	}
+	if len(rows) != 0 {
+		b.WriteString("\n### Failed batches\n\n")
+		writeMarkdownTable(
+			b,
+			[]string{"Offset", "Size", "Attempts", "Exit code", "Class", "Duration", "Log", "Error"},
+			rows,
+		)
+	}
+
+	rows = rows[:0]
+	for _, batch := range r.Batches {
+		for _, a := range batch.Annotations {
+			rows = append(rows, []string{strconv.FormatInt(batch.Offset, 10), a.Kind, a.Message})
+		}
+	}
+	if len(rows) != 0 {
+		b.WriteString("\n### Annotations\n\n")
+		writeMarkdownTable(b, []string{"Offset", "Kind", "Message"}, rows)
+	}
+
+	slowest := make([]BatchRecord, len(r.Batches))
+	copy(slowest, r.Batches)
+	sort.SliceStable(slowest, func(i, j int) bool {
+		return slowest[i].Duration > slowest[j].Duration
+	})
+	rows = rows[:0]
+	for _, batch := range slowest[:min(len(slowest), reportSlowestBatches)] {
+		rows = append(rows, []string{
+			strconv.FormatInt(batch.Offset, 10),
+			strconv.FormatInt(batch.BatchSize, 10),
+			batch.Duration.Round(time.Millisecond).String(),
+			markdownCode(batch.LogPath),
+		})
+	}
+	if len(rows) != 0 {
+		b.WriteString("\n### Slowest batches\n\n")
+		writeMarkdownTable(b, []string{"Offset", "Size", "Duration", "Log"}, rows)
+	}
+	return b.String()
+}
+
+func writeMarkdownTable(b *strings.Builder, header []string, rows [][]string) {
+	b.WriteString("| " + strings.Join(header, markdownTableSplitter) + " |\n")
+	b.WriteString("|" + strings.Repeat("---|", len(header)) + "\n")
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = markdownEscape(cell)
+		}
+		b.WriteString("| " + strings.Join(cells, markdownTableSplitter) + " |\n")
+	}
+}
+
+func markdownEscape(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+func markdownCode(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "`" + s + "`"
+}
@@ -0,0 +1,224 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	reservationRequestTimeout = 30 * time.Second
+	// reservationMaxFailures is how many consecutive transient failures of the capacity service a batch survives.
+	reservationMaxFailures = 5
+	// reservationMaxBackoff caps the wait after a transient failure of the capacity service.
+	reservationMaxBackoff = time.Minute
+)
+
+// ReservationConfig makes every batch hold a token of an external capacity service while it runs,
+// so executor respects a cluster-wide concurrency budget shared with other tools.
+//
+// Before every attempt of a batch, executor sends `POST <url>` with a JSON description of the batch. A 200 (or 201)
+// response carrying `{"token": "..."}` grants the capacity, a 429 or 503 response means the budget is exhausted
+// and the request is sent again after Retry-After (or the poll interval). Transport errors and other 5xx responses
+// are retried with a backoff a few times. Once the attempt finished the token is returned with `DELETE <url>/<token>`,
+// so a batch waiting for its next retry does not hold any capacity.
+type ReservationConfig struct {
+	// URL of the capacity service, empty disables reservations.
+	URL string
+	// Poll is how long to wait before asking again when the service has no capacity and sent no Retry-After.
+	Poll time.Duration
+}
+
+// Enabled tells whether batches reserve capacity before they start.
+func (c ReservationConfig) Enabled() bool {
+	return c.URL != ""
+}
+
+// Validate checks the service url and the poll interval.
+func (c ReservationConfig) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("invalid reservation url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("reservation url must be http or https, got %q", c.URL)
+	}
+	if c.Poll <= 0 {
+		return errors.New("reservation poll interval must be greater than zero")
+	}
+	return nil
+}
+
+// reservations talks to the capacity service, a nil reservations grants every batch immediately.
+type reservations struct {
+	url    string
+	poll   time.Duration
+	client *http.Client
+}
+
+func newReservations(cfg Config) *reservations {
+	if !cfg.Reservation.Enabled() {
+		return nil
+	}
+	return &reservations{
+		url:    strings.TrimSuffix(cfg.Reservation.URL, "/"),
+		poll:   cfg.Reservation.Poll,
+		client: &http.Client{Timeout: reservationRequestTimeout},
+	}
+}
+
+// reservationRequest describes the batch asking for capacity.
+type reservationRequest struct {
+	RunID     string `json:"run_id"`
+	Name      string `json:"name,omitempty"`
+	BatchID   string `json:"batch_id"`
+	Offset    int64  `json:"offset"`
+	BatchSize int64  `json:"batch_size"`
+	Hostname  string `json:"hostname"`
+	Worker    int    `json:"worker"`
+}
+
+// transientReservationError is a failure of the capacity service worth retrying (transport error or 5xx response).
+type transientReservationError struct {
+	err error
+}
+
+func (e *transientReservationError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transientReservationError) Unwrap() error {
+	return e.err
+}
+
+// acquire waits until the service grants a token to the attempt of the batch, the returned function returns
+// the token (calling it again does nothing).
+func (s *reservations) acquire(ctx context.Context, log *zap.Logger, r *ExecRequest) (func(), error) {
+	if s == nil {
+		return func() {}, nil
+	}
+	body, err := json.Marshal(reservationRequest{
+		RunID:     r.RunID,
+		Name:      r.RunName,
+		BatchID:   r.BatchID,
+		Offset:    r.Offset,
+		BatchSize: r.BatchSize,
+		Hostname:  r.hostname,
+		Worker:    r.Worker,
+	})
+	if err != nil {
+		return nil, err
+	}
+	started := time.Now()
+	failures := 0
+	for {
+		token, wait, err := s.request(ctx, body)
+		var transient *transientReservationError
+		switch {
+		case errors.As(err, &transient) && failures < reservationMaxFailures:
+			failures++
+			wait = min(s.poll<<(failures-1), reservationMaxBackoff)
+			log.Warn("failed to reserve capacity, retrying",
+				zap.String("batch", r.name()), zap.Int("failures", failures), zap.Duration("retry_in", wait), zap.Error(err))
+		case err != nil:
+			return nil, fmt.Errorf("failed to reserve capacity: %w", err)
+		default:
+			failures = 0
+		}
+		if token != "" {
+			log.Debug("capacity reserved", zap.String("batch", r.name()), zap.Duration("waited", time.Since(started)))
+			var once sync.Once
+			return func() { once.Do(func() { s.release(ctx, log, r, token) }) }, nil
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// request asks for a token once, an empty token means no capacity is left and tells how long to wait.
+func (s *reservations) request(ctx context.Context, body []byte) (string, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", 0, ctx.Err()
+		}
+		return "", 0, &transientReservationError{err}
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		var grant struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&grant); err != nil {
+			return "", 0, fmt.Errorf("invalid reservation response: %w", err)
+		}
+		if grant.Token == "" {
+			return "", 0, errors.New("reservation response has no token")
+		}
+		return grant.Token, 0, nil
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		_, _ = io.Copy(io.Discard, resp.Body)
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			return "", time.Duration(seconds) * time.Second, nil
+		}
+		return "", s.poll, nil
+	default:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		err := fmt.Errorf("capacity service returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return "", 0, &transientReservationError{err}
+		}
+		return "", 0, err
+	}
+}
+
+// release returns the token, failures are only logged since the batch result is known anyway.
+func (s *reservations) release(ctx context.Context, log *zap.Logger, r *ExecRequest, token string) {
+	// the run context may already be done, the token must be returned anyway
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), reservationRequestTimeout)
+	defer cancel()
+	if err := s.returnToken(ctx, token); err != nil {
+		log.Error("failed to return reserved capacity", zap.String("batch", r.name()), zap.Error(err))
+	}
+}
+
+// returnToken deletes the token, an unknown token (e.g. already expired by the service) is not an error.
+func (s *reservations) returnToken(ctx context.Context, token string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.url+"/"+url.PathEscape(token), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= http.StatusBadRequest && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("capacity service returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// capacityService grants one token at a time, its first request fails with a 500.
+type capacityService struct {
+	lock     sync.Mutex
+	requests int
+	granted  int
+	held     int
+}
+
+func (s *capacityService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	switch r.Method {
+	case http.MethodPost:
+		if s.requests++; s.requests == 1 {
+			http.Error(w, "restarting", http.StatusInternalServerError)
+			return
+		}
+		if s.held != 0 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		s.held++
+		s.granted++
+		fmt.Fprintf(w, `{"token": "t%d"}`, s.requests)
+	case http.MethodDelete:
+		s.held--
+	}
+}
+
+func (s *capacityService) holding() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.held
+}
+
+func TestReservationPerAttempt(t *testing.T) {
+	service := new(capacityService)
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	dir := t.TempDir()
+	cfg := testConfig(dir)
+	cfg.Limit = 1
+	cfg.Retry = 2
+	cfg.Reservation = ReservationConfig{URL: server.URL, Poll: time.Millisecond}
+	var held []int
+	fake := &FakeProcessRunner{Result: func(p Process) (string, int) {
+		held = append(held, service.holding())
+		if len(held) < 3 {
+			return "failed\n", 1
+		}
+		return output(p)
+	}}
+	report, err := New(WithConfig(cfg), WithProcessRunner(fake)).Run(context.Background())
+	if err != nil {
+		t.Fatalf("a transient failure of the capacity service failed the run: %v", err)
+	}
+	if report.Succeeded != 1 {
+		t.Fatalf("got %d succeeded batches, want the batch to succeed on its third attempt", report.Succeeded)
+	}
+	for i, n := range held {
+		if n != 1 {
+			t.Fatalf("attempt %d ran while %d tokens were held, want each attempt to hold its own token", i+1, n)
+		}
+	}
+	if service.granted != 3 {
+		t.Fatalf("%d tokens were granted, want one per attempt", service.granted)
+	}
+	if n := service.holding(); n != 0 {
+		t.Fatalf("%d tokens are still held after the run", n)
+	}
+}
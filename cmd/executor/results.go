@@ -0,0 +1,100 @@
+package executor
+
+import (
+	"iter"
+	"sync"
+	"time"
+)
+
+// resultsBuffer is the number of results a stream holds before the workers wait for its consumer.
+const resultsBuffer = 64
+
+// BatchResult is the final outcome of a batch, streamed by Runner.Results as soon as the batch completed.
+type BatchResult struct {
+	Offset    int64
+	BatchSize int64
+	// Task is the task of the batch, empty when the batches run the single command.
+	Task string
+	// Attempts is the number of attempts made, zero for a batch skipped by its done key.
+	Attempts uint
+	ExitCode int
+	Duration time.Duration
+	// LogPath is the log of the batch, empty when it was not kept (see BatchRecord.LogPath).
+	LogPath string
+	Skipped bool
+	// Err is the error of the last attempt, nil when the batch succeeded.
+	Err error
+}
+
+// Results streams the result of every batch of the next Run of the runner as the batches complete,
+// the sequence ends once that run finished or was aborted. It must be called before Run and consumed while
+// the run goes on (e.g. from another goroutine): the workers wait for a consumer that falls behind.
+// Breaking out of the loop early lets the run go on without the remaining results.
+func (r *Runner) Results() iter.Seq[BatchResult] {
+	results := make(chan BatchResult, resultsBuffer)
+	r.lock.Lock()
+	r.results = append(r.results, results)
+	r.lock.Unlock()
+	return func(yield func(BatchResult) bool) {
+		for result := range results {
+			if !yield(result) {
+				// the workers must not wait for a consumer that left
+				go func() {
+					for range results {
+					}
+				}()
+				return
+			}
+		}
+	}
+}
+
+// takeResults hands the streams requested so far to a run.
+func (r *Runner) takeResults() *resultStreams {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	streams := &resultStreams{streams: r.results}
+	r.results = nil
+	return streams
+}
+
+// resultStreams publishes the results of a run to the streams of Runner.Results.
+type resultStreams struct {
+	// lock guards closed, batches of an aborted run may still finish once the streams are closed.
+	lock    sync.RWMutex
+	closed  bool
+	streams []chan BatchResult
+}
+
+// publish sends the result of the batch to every stream.
+func (s *resultStreams) publish(record BatchRecord, err error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed || len(s.streams) == 0 {
+		return
+	}
+	result := BatchResult{
+		Offset:    record.Offset,
+		BatchSize: record.BatchSize,
+		Task:      record.Task,
+		Attempts:  record.Attempts,
+		ExitCode:  record.ExitCode,
+		Duration:  record.Duration,
+		LogPath:   record.LogPath,
+		Skipped:   record.Skipped,
+		Err:       err,
+	}
+	for _, stream := range s.streams {
+		stream <- result
+	}
+}
+
+// Close ends the streams.
+func (s *resultStreams) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closed = true
+	for _, stream := range s.streams {
+		close(stream)
+	}
+}
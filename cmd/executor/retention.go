@@ -0,0 +1,136 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/FMotalleb/executor/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	runDirMode = 0o755
+	// runLockName is the file a run keeps locked in its log directory while it runs.
+	runLockName = ".executor.lock"
+)
+
+// errFileLocked is returned by tryLockFile when the file is locked by another open file.
+var errFileLocked = errors.New("file is locked")
+
+// runIDPattern matches the directories created for per-run logs (see newRunID).
+var runIDPattern = regexp.MustCompile(`^\d{8}T\d{6}-[0-9a-f]+$`)
+
+// RetentionPolicy decides which run artifacts are removed by the garbage collector.
+// KeepRuns keeps the newest N runs, KeepDays drops runs older than N days, zero disables a rule.
+type RetentionPolicy struct {
+	KeepRuns int
+	KeepDays int
+}
+
+func (p RetentionPolicy) enabled() bool {
+	return p.KeepRuns > 0 || p.KeepDays > 0
+}
+
+// Validate checks the policy values.
+func (p RetentionPolicy) Validate() error {
+	if p.KeepRuns < 0 || p.KeepDays < 0 {
+		return errors.New("retention values cannot be negative")
+	}
+	return nil
+}
+
+// createLogDir creates the log directory <root>/<name> (of a run or of a named executor).
+func createLogDir(root string, name string) (string, error) {
+	dir := filepath.Join(root, name)
+	if err := os.MkdirAll(dir, runDirMode); err != nil {
+		return "", fmt.Errorf("failed to create log directory: %w", err)
+	}
+	return dir, nil
+}
+
+// lockRunDir locks the log directory of a running run, so the garbage collector keeps it until the returned
+// function is called (or the process exits).
+func lockRunDir(dir string) (func(), error) {
+	f, err := os.OpenFile(filepath.Join(dir, runLockName), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create run lock: %w", err)
+	}
+	if err := tryLockFile(f); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to lock run directory: %w", err)
+	}
+	return func() { _ = f.Close() }, nil
+}
+
+// runDirLocked tells whether a run still running holds the lock of the directory.
+func runDirLocked(dir string) bool {
+	f, err := os.OpenFile(filepath.Join(dir, runLockName), os.O_RDWR, 0)
+	if err != nil {
+		// runs that finished before their directory got a lock file
+		return false
+	}
+	defer f.Close()
+	return errors.Is(tryLockFile(f), errFileLocked)
+}
+
+// CollectGarbage removes the per-run directories under root that fall outside the retention policy.
+// Directories of runs still running are kept. It returns the removed paths.
+func CollectGarbage(root string, policy RetentionPolicy) ([]string, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	if !policy.enabled() {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list run directories: %w", err)
+	}
+	var runs []string
+	for _, entry := range entries {
+		if entry.IsDir() && runIDPattern.MatchString(entry.Name()) {
+			runs = append(runs, entry.Name())
+		}
+	}
+	// run ids start with their UTC start time, so the lexical order is the chronological order
+	sort.Sort(sort.Reverse(sort.StringSlice(runs)))
+
+	log := logger.Get("GarbageCollector")
+	deadline := time.Now().UTC().AddDate(0, 0, -policy.KeepDays)
+	var removed []string
+	var errs []error
+	for i, run := range runs {
+		if !policy.expired(i, run, deadline) {
+			continue
+		}
+		path := filepath.Join(root, run)
+		if runDirLocked(path) {
+			log.Debug("run is still running, its artifacts are kept", zap.String("path", path))
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		log.Info("removed run artifacts", zap.String("path", path))
+		removed = append(removed, path)
+	}
+	return removed, errors.Join(errs...)
+}
+
+// expired tells whether the run at the given position (newest first) should be removed.
+func (p RetentionPolicy) expired(position int, runID string, deadline time.Time) bool {
+	if p.KeepRuns > 0 && position >= p.KeepRuns {
+		return true
+	}
+	if p.KeepDays <= 0 {
+		return false
+	}
+	started, err := time.Parse("20060102T150405", runID[:len("20060102T150405")])
+	return err == nil && started.Before(deadline)
+}
@@ -0,0 +1,40 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCollectGarbageKeepsRunningRuns(t *testing.T) {
+	root := t.TempDir()
+	runs := []string{"20250101T000000-1", "20250102T000000-2", "20250103T000000-3"}
+	for _, run := range runs {
+		if _, err := createLogDir(root, run); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the oldest run is still running
+	unlock, err := lockRunDir(filepath.Join(root, runs[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	removed, err := CollectGarbage(root, RetentionPolicy{KeepRuns: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0] != filepath.Join(root, runs[1]) {
+		t.Fatalf("removed %v, want only the finished run outside the retention", removed)
+	}
+	if _, err := os.Stat(filepath.Join(root, runs[0])); err != nil {
+		t.Fatalf("the directory of the running run was removed: %v", err)
+	}
+
+	// once it finished it is removed too
+	unlock()
+	if removed, err = CollectGarbage(root, RetentionPolicy{KeepRuns: 1}); err != nil || len(removed) != 1 {
+		t.Fatalf("removed %v (%v), want the finished run removed", removed, err)
+	}
+}
@@ -0,0 +1,60 @@
+package executor
+
+import (
+	"time"
+)
+
+// Attempt describes a failed attempt of a batch, it is handed to the RetryPolicy.
+type Attempt struct {
+	// Number of the attempt, zero for the first one.
+	Number uint
+	// ExitCode of the process, -1 when it did not exit normally (killed, failed to start, ...).
+	ExitCode int
+	// Err is the error of the attempt.
+	Err error
+	// Duration of the attempt.
+	Duration time.Duration
+	// OutputTail is the end of the attempt output, empty unless output capture or sampling keeps it.
+	OutputTail string
+}
+
+// RetryDecision tells whether a failed batch is attempted again and after which delay.
+type RetryDecision struct {
+	Retry bool
+	Delay time.Duration
+}
+
+// RetryPolicy decides what happens after a failed attempt, embedders can set Config.RetryPolicy
+// to encode domain specific rules (e.g. retry exit code 75 after a minute, never retry exit code 2).
+type RetryPolicy interface {
+	Decide(attempt Attempt) RetryDecision
+}
+
+// RetryPolicyFunc adapts a function to a RetryPolicy.
+type RetryPolicyFunc func(attempt Attempt) RetryDecision
+
+func (f RetryPolicyFunc) Decide(attempt Attempt) RetryDecision {
+	return f(attempt)
+}
+
+// MaxRetries is the default policy (--retry), retrying a failed batch immediately up to the given number of times.
+type MaxRetries uint
+
+func (m MaxRetries) Decide(attempt Attempt) RetryDecision {
+	return RetryDecision{Retry: attempt.Number < uint(m)}
+}
+
+// attempt describes the latest failed attempt of the batch.
+func (e *ExecRequest) attempt(err error, duration time.Duration) Attempt {
+	tail := e.capture.String()
+	if tail == "" {
+		tail = e.tail.String()
+	}
+	return Attempt{
+		Number:     e.TryCount,
+		ExitCode:   exitCodeOf(err),
+		Err:        err,
+		Duration:   duration,
+		OutputTail: tail,
+	}
+}
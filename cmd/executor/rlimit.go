@@ -0,0 +1,87 @@
+package executor
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const rlimitUnlimited = "unlimited"
+
+// rlimitNames lists the resource limits that can be set on spawned processes.
+var rlimitNames = []string{"nofile", "nproc", "core", "fsize"}
+
+// rlimit is a parsed resource limit, Max equal to math.MaxUint64 means unlimited.
+type rlimit struct {
+	Name string
+	Cur  uint64
+	Max  uint64
+}
+
+// parseRlimit parses `name=soft[:hard]` (e.g. `nofile=65536` or `core=0:unlimited`),
+// when hard is omitted it equals soft.
+func parseRlimit(spec string) (rlimit, error) {
+	name, value, found := strings.Cut(spec, "=")
+	if !found {
+		return rlimit{}, fmt.Errorf("invalid rlimit %q, expected name=soft[:hard]", spec)
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	known := false
+	for _, n := range rlimitNames {
+		known = known || n == name
+	}
+	if !known {
+		return rlimit{}, fmt.Errorf("unknown rlimit %q (%s)", name, strings.Join(rlimitNames, ", "))
+	}
+	soft, hard, hasHard := strings.Cut(value, ":")
+	cur, err := parseRlimitValue(soft)
+	if err != nil {
+		return rlimit{}, err
+	}
+	limit := rlimit{Name: name, Cur: cur, Max: cur}
+	if hasHard {
+		if limit.Max, err = parseRlimitValue(hard); err != nil {
+			return rlimit{}, err
+		}
+	}
+	if limit.Cur > limit.Max {
+		return rlimit{}, fmt.Errorf("soft limit of %s is greater than its hard limit", name)
+	}
+	return limit, nil
+}
+
+func parseRlimitValue(raw string) (uint64, error) {
+	raw = strings.TrimSpace(raw)
+	if strings.EqualFold(raw, rlimitUnlimited) {
+		return math.MaxUint64, nil
+	}
+	v, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rlimit value %q: %w", raw, err)
+	}
+	return v, nil
+}
+
+// parseRlimits parses every rlimit spec.
+func parseRlimits(specs []string) ([]rlimit, error) {
+	limits := make([]rlimit, 0, len(specs))
+	for _, spec := range specs {
+		limit, err := parseRlimit(spec)
+		if err != nil {
+			return nil, err
+		}
+		limits = append(limits, limit)
+	}
+	return limits, nil
+}
+
+func validateRlimits(specs []string) error {
+	if len(specs) == 0 {
+		return nil
+	}
+	if _, err := parseRlimits(specs); err != nil {
+		return err
+	}
+	return validateRlimitSupport()
+}
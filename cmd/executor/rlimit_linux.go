@@ -0,0 +1,42 @@
+//go:build linux
+
+package executor
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var rlimitResources = map[string]int{
+	"fsize":  syscall.RLIMIT_FSIZE,
+	"core":   syscall.RLIMIT_CORE,
+	"nproc":  6, // RLIMIT_NPROC, missing from the syscall package
+	"nofile": syscall.RLIMIT_NOFILE,
+}
+
+func validateRlimitSupport() error {
+	return nil
+}
+
+// applyRlimits sets the resource limits of a running process using prlimit(2).
+func applyRlimits(pid int, specs []string) error {
+	limits, err := parseRlimits(specs)
+	if err != nil {
+		return err
+	}
+	for _, limit := range limits {
+		value := syscall.Rlimit{Cur: limit.Cur, Max: limit.Max}
+		_, _, errno := syscall.RawSyscall6(
+			syscall.SYS_PRLIMIT64,
+			uintptr(pid),
+			uintptr(rlimitResources[limit.Name]),
+			uintptr(unsafe.Pointer(&value)),
+			0, 0, 0,
+		)
+		if errno != 0 {
+			return fmt.Errorf("failed to set rlimit %s: %w", limit.Name, errno)
+		}
+	}
+	return nil
+}
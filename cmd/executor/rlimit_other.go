@@ -0,0 +1,13 @@
+//go:build !linux
+
+package executor
+
+import "errors"
+
+func validateRlimitSupport() error {
+	return errors.New("rlimits are only available on linux")
+}
+
+func applyRlimits(_ int, _ []string) error {
+	return nil
+}
@@ -0,0 +1,16 @@
+package executor
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+const runIDRandomBytes = 3
+
+// newRunID returns a unique, time sortable identifier for a run (e.g. 20250102T150405-a1b2c3).
+func newRunID() string {
+	suffix := make([]byte, runIDRandomBytes)
+	_, _ = rand.Read(suffix)
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix)
+}
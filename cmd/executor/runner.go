@@ -0,0 +1,79 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+const runnerProbeTimeout = 10 * time.Second
+
+// runnerSpec describes how a language runner evaluates inline code.
+type runnerSpec struct {
+	// programs are tried in order, the first one found on PATH is used
+	programs    []string
+	args        []string
+	versionFlag string
+}
+
+var runners = map[string]runnerSpec{
+	"python": {programs: []string{"python3", "python"}, args: []string{"-c"}, versionFlag: "--version"},
+	"node":   {programs: []string{"node", "nodejs"}, args: []string{"-e"}, versionFlag: "--version"},
+	"ruby":   {programs: []string{"ruby"}, args: []string{"-e"}, versionFlag: "--version"},
+	"perl":   {programs: []string{"perl"}, args: []string{"-e"}, versionFlag: "-v"},
+	"bash":   {programs: []string{"bash"}, args: []string{"-c"}, versionFlag: "--version"},
+}
+
+// RunnerNames returns the sorted names of the built-in runners.
+func RunnerNames() []string {
+	names := make([]string, 0, len(runners))
+	for name := range runners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AvailableRunners returns the sorted names of the built-in runners whose program is on PATH.
+func AvailableRunners() []string {
+	var names []string
+	for _, name := range RunnerNames() {
+		for _, candidate := range runners[name].programs {
+			if _, err := exec.LookPath(candidate); err == nil {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// resolveRunner finds the program of the named runner and probes its version.
+// It returns the program, its arguments (the evaluated command is appended to them) and the reported version.
+func resolveRunner(name string) (string, []string, string, error) {
+	spec, ok := runners[name]
+	if !ok {
+		return "", nil, "", fmt.Errorf("unknown runner %q (%s)", name, strings.Join(RunnerNames(), ", "))
+	}
+	for _, candidate := range spec.programs {
+		program, err := exec.LookPath(candidate)
+		if err != nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), runnerProbeTimeout)
+		out, err := exec.CommandContext(ctx, program, spec.versionFlag).CombinedOutput()
+		cancel()
+		if err != nil {
+			return "", nil, "", fmt.Errorf("runner %s (%s) failed its version probe: %w", name, program, err)
+		}
+		version := strings.TrimSpace(string(out))
+		if first, _, found := strings.Cut(version, "\n"); found {
+			version = first
+		}
+		return program, append([]string{}, spec.args...), version, nil
+	}
+	return "", nil, "", fmt.Errorf("runner %s requested but none of %v is on PATH", name, spec.programs)
+}
@@ -0,0 +1,96 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+
+	"github.com/FMotalleb/executor/logger"
+)
+
+// defaultSampleTail is the amount of output kept for the batches that are not sampled.
+const defaultSampleTail = 64 << 10
+
+// SampleRate is the fraction of batches whose output is fully logged, parsed from `n/d` (e.g. 1/100).
+// It implements pflag.Value so it can be used directly as a flag, the zero value logs every batch.
+type SampleRate struct {
+	N int64
+	D int64
+}
+
+func (s *SampleRate) String() string {
+	if s.D == 0 {
+		return ""
+	}
+	return strconv.FormatInt(s.N, 10) + "/" + strconv.FormatInt(s.D, 10)
+}
+
+func (s *SampleRate) Set(raw string) error {
+	n, d, found := strings.Cut(raw, "/")
+	if !found {
+		return fmt.Errorf("invalid sample rate %q, expected n/d (e.g. 1/100)", raw)
+	}
+	var err error
+	var rate SampleRate
+	if rate.N, err = strconv.ParseInt(strings.TrimSpace(n), 10, 64); err != nil {
+		return fmt.Errorf("invalid sample rate %q: %w", raw, err)
+	}
+	if rate.D, err = strconv.ParseInt(strings.TrimSpace(d), 10, 64); err != nil {
+		return fmt.Errorf("invalid sample rate %q: %w", raw, err)
+	}
+	if rate.N < 0 || rate.D <= 0 || rate.N > rate.D {
+		return fmt.Errorf("invalid sample rate %q, expected 0 <= n <= d and d > 0", raw)
+	}
+	*s = rate
+	return nil
+}
+
+func (s *SampleRate) Type() string {
+	return "n/d"
+}
+
+// SampleConfig controls output sampling: the sampled batches are fully logged,
+// the others keep only the tail of their output in memory and write it to their log if they fail.
+type SampleConfig struct {
+	Rate SampleRate
+	// Tail is the number of trailing output bytes kept for the batches that are not sampled.
+	Tail ByteSize
+}
+
+// Validate fills the default tail size.
+func (s *SampleConfig) Validate() error {
+	if s.Tail == 0 {
+		s.Tail = defaultSampleTail
+	}
+	return nil
+}
+
+// newTail returns the tail buffer of a new batch, nil when the batch is sampled (its output is fully logged).
+func (s SampleConfig) newTail() *outputCapture {
+	if s.Rate.D == 0 || rand.Int64N(s.Rate.D) < s.Rate.N {
+		return nil
+	}
+	return newOutputCapture(int(s.Tail))
+}
+
+// sampled tells whether the full output of the batch is logged.
+func (e *ExecRequest) sampled() bool {
+	return e.tail == nil
+}
+
+// flushTail writes the kept output tail of a batch that is not sampled into its log.
+func (e *ExecRequest) flushTail() error {
+	if e.sampled() {
+		return nil
+	}
+	out, err := e.logWriter()
+	if err != nil {
+		return err
+	}
+	e.tailFlushed = true
+	_, wErr := io.WriteString(out, e.tail.String())
+	return errors.Join(wErr, logger.CloseWriter(out))
+}
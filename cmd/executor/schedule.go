@@ -0,0 +1,140 @@
+package executor
+
+import (
+	"container/heap"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// evaluateNotBefore renders the not-before template of the batch, an empty template (or result) means no constraint.
+// The template must render an RFC 3339 timestamp or unix seconds.
+func (e *ExecRequest) evaluateNotBefore(tmpl string) error {
+	if tmpl == "" {
+		return nil
+	}
+	raw, err := e.evaluateTemplate(tmpl)
+	if err != nil {
+		return fmt.Errorf("failed to evaluate not-before template: %w", err)
+	}
+	e.NotBefore, err = parseTimestamp(strings.TrimSpace(raw))
+	if err != nil {
+		return fmt.Errorf("not-before template must render a timestamp: %w", err)
+	}
+	return nil
+}
+
+// parseTimestamp accepts RFC 3339 timestamps and unix seconds, an empty string is the zero time.
+func parseTimestamp(raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+// scheduler hands out batches in dispatch order, holding back the ones whose not-before time is in the future.
+// Held batches are released in the order of their not-before time, ahead of the remaining batches.
+type scheduler struct {
+	pending []*ExecRequest
+	held    notBeforeHeap
+}
+
+func newScheduler(batches []*ExecRequest) *scheduler {
+	return &scheduler{pending: batches}
+}
+
+// next returns the next batch that may start at now.
+// When no batch is ready it returns nil and the time the earliest held batch becomes ready,
+// once every batch was handed out it returns nil and the zero time.
+func (s *scheduler) next(now time.Time) (*ExecRequest, time.Time) {
+	if len(s.held) != 0 && !s.held[0].NotBefore.After(now) {
+		return heap.Pop(&s.held).(*ExecRequest), time.Time{}
+	}
+	for len(s.pending) != 0 {
+		req := s.pending[0]
+		s.pending[0] = nil
+		s.pending = s.pending[1:]
+		if !req.NotBefore.After(now) {
+			return req, time.Time{}
+		}
+		heap.Push(&s.held, req)
+	}
+	if len(s.held) != 0 {
+		return nil, s.held[0].NotBefore
+	}
+	return nil, time.Time{}
+}
+
+// drain removes and returns the batches not handed out yet, the held ones first (by their not-before time).
+func (s *scheduler) drain() []*ExecRequest {
+	batches := make([]*ExecRequest, 0, len(s.held)+len(s.pending))
+	for len(s.held) != 0 {
+		batches = append(batches, heap.Pop(&s.held).(*ExecRequest))
+	}
+	batches = append(batches, s.pending...)
+	s.pending = nil
+	return batches
+}
+
+// heldSource holds back the batches of a source pulling them one by one (shared queue, broker, followed input)
+// until their not-before time, like the scheduler does for planned batches. Batches that are due are handed out
+// as they arrive, held batches are released in the order of their not-before time.
+type heldSource struct {
+	source batchSource
+	held   notBeforeHeap
+	// done is set once the source handed out every batch.
+	done bool
+}
+
+func holdNotBefore(source batchSource) *heldSource {
+	return &heldSource{source: source}
+}
+
+func (s *heldSource) next(now time.Time) (*ExecRequest, time.Time) {
+	if len(s.held) != 0 && !s.held[0].NotBefore.After(now) {
+		return heap.Pop(&s.held).(*ExecRequest), time.Time{}
+	}
+	for !s.done {
+		req, readyAt := s.source.next(now)
+		switch {
+		case req == nil && readyAt.IsZero():
+			s.done = true
+		case req == nil:
+			if len(s.held) != 0 && s.held[0].NotBefore.Before(readyAt) {
+				return nil, s.held[0].NotBefore
+			}
+			return nil, readyAt
+		case req.NotBefore.After(now):
+			heap.Push(&s.held, req)
+		default:
+			return req, time.Time{}
+		}
+	}
+	if len(s.held) != 0 {
+		return nil, s.held[0].NotBefore
+	}
+	return nil, time.Time{}
+}
+
+// notBeforeHeap is a min-heap of batches ordered by their not-before time.
+type notBeforeHeap []*ExecRequest
+
+func (h notBeforeHeap) Len() int           { return len(h) }
+func (h notBeforeHeap) Less(i, j int) bool { return h[i].NotBefore.Before(h[j].NotBefore) }
+func (h notBeforeHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *notBeforeHeap) Push(x any) {
+	*h = append(*h, x.(*ExecRequest))
+}
+
+func (h *notBeforeHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return last
+}
@@ -0,0 +1,39 @@
+package executor
+
+import (
+	"testing"
+	"time"
+)
+
+// pulledSource hands out its batches one by one, like a broker or a shared queue.
+type pulledSource []*ExecRequest
+
+func (s *pulledSource) next(time.Time) (*ExecRequest, time.Time) {
+	if len(*s) == 0 {
+		return nil, time.Time{}
+	}
+	req := (*s)[0]
+	*s = (*s)[1:]
+	return req, time.Time{}
+}
+
+func TestHeldSourceHonorsNotBefore(t *testing.T) {
+	now := time.Now()
+	later := &ExecRequest{Offset: 0, NotBefore: now.Add(time.Hour)}
+	due := &ExecRequest{Offset: 1}
+	source := holdNotBefore(&pulledSource{later, due})
+
+	if req, _ := source.next(now); req != due {
+		t.Fatalf("got %+v, want the batch that is due", req)
+	}
+	req, readyAt := source.next(now)
+	if req != nil || !readyAt.Equal(later.NotBefore) {
+		t.Fatalf("got %+v ready at %v, want the held batch to be waited for until %v", req, readyAt, later.NotBefore)
+	}
+	if req, _ := source.next(later.NotBefore); req != later {
+		t.Fatalf("got %+v, want the held batch once it is due", req)
+	}
+	if req, readyAt := source.next(later.NotBefore); req != nil || !readyAt.IsZero() {
+		t.Fatalf("got %+v ready at %v, want the end of the source", req, readyAt)
+	}
+}
@@ -0,0 +1,65 @@
+package executor
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/FMotalleb/executor/template"
+)
+
+// redactedSecret replaces the values resolved by `secret` in the logs.
+const redactedSecret = "******"
+
+// render evaluates a template that is rendered when a process is spawned, `secret "name"` resolves
+// the secret through the configured providers there. Resolved values are remembered (see redact).
+func (e *ExecRequest) render(tmpl string, vars map[string]any) (string, error) {
+	funcs := make(map[string]any, len(e.funcs)+1)
+	for name, fn := range e.funcs {
+		funcs[name] = fn
+	}
+	funcs["secret"] = func(name string) (string, error) {
+		value, err := e.secretResolver.Resolve(e.rootCtx, name)
+		if err != nil {
+			return "", err
+		}
+		if value != "" {
+			e.resolvedSecrets = append(e.resolvedSecrets, value)
+		}
+		return value, nil
+	}
+	return template.EvaluateTemplateWith(tmpl, vars, funcs)
+}
+
+// fetchedSecrets returns the values of the secrets fetched for the run, they are redacted like those resolved
+// by `secret` since templates may interpolate them (`.secrets`) and they are in the environment.
+func (e *ExecRequest) fetchedSecrets() []string {
+	values := make([]string, 0, len(e.secrets))
+	for _, value := range e.secrets {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// redact hides the secret values of the current attempt, for logging. Longer values are replaced first
+// so a secret containing another one is hidden entirely.
+func (e *ExecRequest) redact(s string) string {
+	slices.SortFunc(e.resolvedSecrets, func(a, b string) int { return len(b) - len(a) })
+	for _, value := range e.resolvedSecrets {
+		s = strings.ReplaceAll(s, value, redactedSecret)
+	}
+	return s
+}
+
+// redactAll is redact applied to every element.
+func (e *ExecRequest) redactAll(values []string) []string {
+	if len(e.resolvedSecrets) == 0 {
+		return values
+	}
+	redacted := make([]string, len(values))
+	for i, value := range values {
+		redacted[i] = e.redact(value)
+	}
+	return redacted
+}
@@ -0,0 +1,12 @@
+package executor
+
+import "testing"
+
+func TestRedactFetchedSecrets(t *testing.T) {
+	r := &ExecRequest{secrets: map[string]string{"DB_PASSWORD": "hunter2", "DB_URL": "pg://app:hunter2@db"}}
+	r.resolvedSecrets = r.fetchedSecrets()
+	got := r.redact("psql pg://app:hunter2@db -W hunter2")
+	if want := "psql " + redactedSecret + " -W " + redactedSecret; got != want {
+		t.Fatalf("redacted %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,84 @@
+package executor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Shard selects the subset of batches processed by this node, parsed from `index/count` (e.g. 2/5, index starts at 1).
+// Batches are assigned by a hash of their offset and size, so every node launched with the same configuration
+// and a different index processes a disjoint subset without any coordination.
+// It implements pflag.Value so it can be used directly as a flag, the zero value processes every batch.
+type Shard struct {
+	Index int
+	Count int
+}
+
+func (s *Shard) String() string {
+	if s.Count == 0 {
+		return ""
+	}
+	return strconv.Itoa(s.Index) + "/" + strconv.Itoa(s.Count)
+}
+
+func (s *Shard) Set(raw string) error {
+	index, count, found := strings.Cut(raw, "/")
+	if !found {
+		return fmt.Errorf("invalid shard %q, expected index/count (e.g. 2/5)", raw)
+	}
+	var err error
+	var shard Shard
+	if shard.Index, err = strconv.Atoi(strings.TrimSpace(index)); err != nil {
+		return fmt.Errorf("invalid shard %q: %w", raw, err)
+	}
+	if shard.Count, err = strconv.Atoi(strings.TrimSpace(count)); err != nil {
+		return fmt.Errorf("invalid shard %q: %w", raw, err)
+	}
+	if shard.Count <= 0 || shard.Index < 1 || shard.Index > shard.Count {
+		return fmt.Errorf("invalid shard %q, index must be between 1 and count", raw)
+	}
+	*s = shard
+	return nil
+}
+
+func (s *Shard) Type() string {
+	return "index/count"
+}
+
+// owns tells whether the batch belongs to this shard.
+func (s Shard) owns(r *ExecRequest) bool {
+	if s.Count <= 1 {
+		return true
+	}
+	h := fnv.New64a()
+	var key [16]byte
+	binary.BigEndian.PutUint64(key[:8], uint64(r.Offset))
+	binary.BigEndian.PutUint64(key[8:], uint64(r.BatchSize))
+	_, _ = h.Write(key[:])
+	return h.Sum64()%uint64(s.Count) == uint64(s.Index-1)
+}
+
+// apply drops the batches owned by other shards.
+func (s Shard) apply(log *zap.Logger, batches []*ExecRequest) []*ExecRequest {
+	if s.Count <= 1 {
+		return batches
+	}
+	kept := batches[:0]
+	for _, r := range batches {
+		if s.owns(r) {
+			kept = append(kept, r)
+		}
+	}
+	log.Info(
+		"selected shard",
+		zap.String("shard", s.String()),
+		zap.Int("kept", len(kept)),
+		zap.Int("dropped", len(batches)-len(kept)),
+	)
+	return kept
+}
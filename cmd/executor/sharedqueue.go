@@ -0,0 +1,197 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/FMotalleb/executor/queue"
+	"go.uber.org/zap"
+)
+
+// sharedQueuePoll is how often an idle process looks for batches while other processes still work on the queue.
+const sharedQueuePoll = time.Second
+
+// sharedQueue pulls batches from a redis queue shared by independent executor processes.
+// Processes launched with the same configuration share the queue, the first one plans the run.
+type sharedQueue struct {
+	ctx   context.Context
+	log   *zap.Logger
+	cfg   Config
+	run   runInfo
+	queue *queue.Redis
+
+	lock sync.Mutex
+	// leased maps the batches handed out by this process to their lease.
+	leased map[[2]int64]queue.Lease
+	stop   context.CancelFunc
+}
+
+// openSharedQueue connects to the queue and pushes the batches returned by plan if this process is the first one.
+func openSharedQueue(
+	ctx context.Context,
+	log *zap.Logger,
+	cfg Config,
+	run runInfo,
+	plan func() ([]*ExecRequest, error),
+) (*sharedQueue, error) {
+	prefix := "executor:" + cfg.hash()
+	if cfg.Name != "" {
+		prefix = "executor:" + cfg.Name + ":" + cfg.hash()
+	}
+	q, err := queue.OpenRedis(ctx, cfg.Queue.Path, prefix, cfg.Queue.Visibility)
+	if err != nil {
+		return nil, err
+	}
+	log = log.With(zap.String("queue", prefix))
+	planner, err := q.Claim(ctx)
+	if err != nil {
+		_ = q.Close()
+		return nil, err
+	}
+	if !planner {
+		log.Info("joining a run planned by another process")
+		if planner, err = q.WaitReady(ctx, sharedQueuePoll); err != nil {
+			_ = q.Close()
+			return nil, err
+		}
+		if planner {
+			log.Warn("the planning process stopped responding, taking over the planning")
+		}
+	}
+	if planner {
+		if err := pushPlan(ctx, log, q, plan); err != nil {
+			_ = q.Close()
+			return nil, err
+		}
+	}
+	renewCtx, stop := context.WithCancel(ctx)
+	s := &sharedQueue{
+		ctx:    ctx,
+		log:    log,
+		cfg:    cfg,
+		run:    run,
+		queue:  q,
+		leased: make(map[[2]int64]queue.Lease),
+		stop:   stop,
+	}
+	go s.renewLeases(renewCtx)
+	return s, nil
+}
+
+// pushPlan plans the run and pushes its batches, the claim is held meanwhile so waiting processes do not take over.
+func pushPlan(ctx context.Context, log *zap.Logger, q *queue.Redis, plan func() ([]*ExecRequest, error)) error {
+	release := q.HoldClaim(ctx)
+	defer release()
+	batches, err := plan()
+	if err != nil {
+		return err
+	}
+	entries := make([]queue.Entry, 0, len(batches))
+	for _, r := range batches {
+		entries = append(entries, queue.Entry{Offset: r.Offset, BatchSize: r.BatchSize, Items: r.items})
+	}
+	if err := q.Push(ctx, entries); err != nil {
+		return err
+	}
+	log.Info("planned the run and pushed its batches to the shared queue", zap.Int("count", len(entries)))
+	return nil
+}
+
+// next pulls the next batch, while other processes still hold batches it polls (their leases may expire)
+// and once the queue is drained it returns nil and the zero time.
+func (s *sharedQueue) next(now time.Time) (*ExecRequest, time.Time) {
+	entry, lease, ok, err := s.queue.Pop(s.ctx)
+	if err != nil {
+		s.log.Error("failed to pull a batch from the shared queue", zap.Error(err))
+		return nil, now.Add(sharedQueuePoll)
+	}
+	if ok {
+		req, err := dequeued(s.ctx, s.cfg, s.run, entry)
+		if err != nil {
+			// the batch fails the same way on every process, it is dropped instead of being handed out forever
+			s.log.Error("batch is not processed", zap.Int64("offset", entry.Offset), zap.Error(err))
+			if err := s.queue.Ack(s.ctx, lease); err != nil {
+				s.log.Error("failed to ack batch", zap.Error(err))
+			}
+			return nil, now
+		}
+		s.lock.Lock()
+		s.leased[[2]int64{req.Offset, req.BatchSize}] = lease
+		s.lock.Unlock()
+		return req, time.Time{}
+	}
+	reaped, err := s.queue.Reap(s.ctx)
+	if err != nil {
+		s.log.Error("failed to requeue expired batches", zap.Error(err))
+	}
+	if reaped != 0 {
+		s.log.Warn("batches of a process that stopped responding are handed out again", zap.Int("count", reaped))
+		return nil, now
+	}
+	drained, err := s.queue.Drained(s.ctx)
+	if err != nil {
+		s.log.Error("failed to check the shared queue", zap.Error(err))
+		return nil, now.Add(sharedQueuePoll)
+	}
+	if drained {
+		return nil, time.Time{}
+	}
+	return nil, now.Add(sharedQueuePoll)
+}
+
+// ack removes the batch from the shared queue, whatever its result. If the lease was lost meanwhile
+// the batch is left to the process holding it now, so it is completed once.
+func (s *sharedQueue) ack(r *ExecRequest, _ error) error {
+	id := [2]int64{r.Offset, r.BatchSize}
+	s.lock.Lock()
+	lease, ok := s.leased[id]
+	delete(s.leased, id)
+	s.lock.Unlock()
+	if !ok {
+		return nil
+	}
+	// the run context may already be done, the result is known anyway
+	err := s.queue.Ack(context.WithoutCancel(s.ctx), lease)
+	if errors.Is(err, queue.ErrLeaseLost) {
+		s.log.Warn(
+			"lease of the batch expired and it was handed out again, its result is left to the other process",
+			zap.Int64("offset", r.Offset),
+		)
+		return nil
+	}
+	return err
+}
+
+// renewLeases extends the leases of the batches held by this process until ctx is done.
+func (s *sharedQueue) renewLeases(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.Queue.Visibility / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.lock.Lock()
+		leases := make([]queue.Lease, 0, len(s.leased))
+		for _, lease := range s.leased {
+			leases = append(leases, lease)
+		}
+		s.lock.Unlock()
+		lost, err := s.queue.Extend(ctx, leases)
+		if err != nil && ctx.Err() == nil {
+			s.log.Error("failed to renew batch leases", zap.Error(err))
+		}
+		if len(lost) != 0 {
+			s.log.Warn("leases of running batches expired before they were renewed, the batches are handed out again", zap.Int("count", len(lost)))
+		}
+	}
+}
+
+// Close stops renewing the leases, batches still held are handed out again once their lease expires.
+func (s *sharedQueue) Close() error {
+	s.stop()
+	return s.queue.Close()
+}
@@ -0,0 +1,25 @@
+package executor
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// ShellArgs returns the arguments making the shell run the command passed after them:
+// /C for cmd, -Command for PowerShell and -c for every other (POSIX) shell.
+func ShellArgs(shell string) []string {
+	switch shellName(shell) {
+	case "cmd":
+		return []string{"/C"}
+	case "powershell", "pwsh":
+		return []string{"-Command"}
+	default:
+		return []string{"-c"}
+	}
+}
+
+// shellName is the lower-cased base name of the shell without its .exe extension.
+func shellName(shell string) string {
+	name := strings.ToLower(filepath.Base(shell))
+	return strings.TrimSuffix(name, ".exe")
+}
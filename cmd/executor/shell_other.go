@@ -0,0 +1,13 @@
+//go:build !windows
+
+package executor
+
+import "os/exec"
+
+// DefaultShell is the shell commands run with when none is configured.
+func DefaultShell() string {
+	return "/bin/sh"
+}
+
+// setShellCommandLine is a no-op, arguments reach the process unchanged outside windows.
+func setShellCommandLine(_ *exec.Cmd) {}
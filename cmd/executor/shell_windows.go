@@ -0,0 +1,31 @@
+//go:build windows
+
+package executor
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// DefaultShell is the shell commands run with when none is configured, the command interpreter of
+// the system (%ComSpec%).
+func DefaultShell() string {
+	if shell := os.Getenv("ComSpec"); shell != "" {
+		return shell
+	}
+	return "cmd.exe"
+}
+
+// setShellCommandLine passes the arguments of cmd verbatim: it does not parse its command line with the
+// quoting rules Go escapes arguments for, so a quoted command would reach it mangled.
+func setShellCommandLine(proc *exec.Cmd) {
+	if shellName(proc.Path) != "cmd" {
+		return
+	}
+	if proc.SysProcAttr == nil {
+		proc.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	proc.SysProcAttr.CmdLine = syscall.EscapeArg(proc.Args[0]) + " " + strings.Join(proc.Args[1:], " ")
+}
@@ -0,0 +1,15 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package executor
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyProgress relays SIGINFO (Ctrl-T) to c.
+func notifyProgress(c chan<- os.Signal) bool {
+	signal.Notify(c, syscall.SIGINFO)
+	return true
+}
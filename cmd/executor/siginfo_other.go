@@ -0,0 +1,10 @@
+//go:build !(darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package executor
+
+import "os"
+
+// notifyProgress is unsupported, SIGINFO only exists on BSD and macOS.
+func notifyProgress(_ chan<- os.Signal) bool {
+	return false
+}
@@ -0,0 +1,267 @@
+package executor
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// exitCodeUnknown is used in the exit code histogram for attempts that failed before
+// the process could report an exit status (e.g. template or pipe errors).
+const exitCodeUnknown = -1
+
+// runStats collects the counters of a run, they are summarized when the run is finished.
+type runStats struct {
+	lock      sync.Mutex
+	attempts  int
+	succeeded int
+	failed    int
+	skipped   int
+	exitCodes map[int]int
+	startedAt time.Time
+	// total is the number of planned batches, zero when unknown, dispatched counts the batches handed to workers.
+	total      int
+	dispatched int
+	batches    []BatchRecord
+	// keep bounds batches for runs whose source never ends, zero keeps every record. dropped counts the
+	// records dropped meanwhile, the counters still cover them.
+	keep    int
+	dropped int
+	last    *BatchRecord
+}
+
+// keepBatchRecords is the number of batch records kept for the report of a run whose source never ends
+// (consumer and follow modes), otherwise the records (and their captured output) would grow forever.
+const keepBatchRecords = 10000
+
+func newRunStats() *runStats {
+	return &runStats{
+		exitCodes: make(map[int]int),
+		startedAt: time.Now(),
+	}
+}
+
+// limitRecords keeps only the most recent batch records, between keep/2 and keep of them.
+func (s *runStats) limitRecords(keep int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.keep = keep
+}
+
+// addRecord appends the record of a finished batch, dropping the oldest half of the records once there are
+// more than keep (at once, so records are not shifted on every batch).
+func (s *runStats) addRecord(record BatchRecord) {
+	s.batches = append(s.batches, record)
+	if s.keep <= 0 || len(s.batches) <= s.keep {
+		return
+	}
+	drop := len(s.batches) - s.keep/2
+	s.dropped += drop
+	s.batches = slices.Clone(s.batches[drop:])
+}
+
+// exitCodeOf maps the result of an attempt into its exit code.
+func exitCodeOf(err error) int {
+	if err == nil {
+		return 0
+	}
+	exitErr := new(ExitError)
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return exitCodeUnknown
+}
+
+// Error classes of failed batches.
+const (
+	ErrorClassExit  = "exit"
+	ErrorClassOOM   = "oom"
+	ErrorClassOther = "error"
+)
+
+// errorClassOf categorizes the failure of an attempt, a successful attempt has no class.
+func errorClassOf(err error) string {
+	exitErr := new(ExitError)
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrMaxRSSExceeded):
+		return ErrorClassOOM
+	case errors.As(err, &exitErr):
+		return ErrorClassExit
+	default:
+		return ErrorClassOther
+	}
+}
+
+// recordAttempt counts a single attempt of a batch.
+func (s *runStats) recordAttempt(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.attempts++
+	s.exitCodes[exitCodeOf(err)]++
+}
+
+// recordBatch counts the final outcome of a batch, err is the result of its last attempt.
+// It returns the record of the batch in the report.
+func (s *runStats) recordBatch(r *ExecRequest, err error, duration time.Duration) BatchRecord {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	record := BatchRecord{
+		BatchID:   r.BatchID,
+		Offset:    r.Offset,
+		BatchSize: r.BatchSize,
+		Label:     r.Label,
+		Task:      r.Task,
+		Stream:    r.Stream,
+		Attempts:  r.TryCount + 1,
+		ExitCode:  exitCodeOf(err),
+		Success:   err == nil,
+		Skipped:   r.skipped,
+		Duration:  duration,
+		LogPath:   r.logPath(),
+		Output:    r.capture.String(),
+
+		Annotations: r.annotations.list(),
+	}
+	if r.skipped {
+		// a skipped batch did not run: it is neither succeeded nor failed and not the previous batch of the next one
+		record.Attempts = 0
+		record.LogPath = ""
+		s.skipped++
+		s.addRecord(record)
+		return record
+	}
+	if err != nil {
+		record.Error = err.Error()
+		record.ErrorClass = errorClassOf(err)
+		s.failed++
+	} else {
+		s.succeeded++
+		if !r.sampled() && !r.tailFlushed {
+			// batches that are not sampled only keep a log of their failed attempts
+			record.LogPath = ""
+		}
+	}
+	s.addRecord(record)
+	s.last = &record
+	return record
+}
+
+// previous summarizes the last completed batch for the template of the next one.
+// The map is empty until the first batch completes, in parallel runs "last" depends on timing,
+// so this is mainly useful in sequential runs (a single processor).
+func (s *runStats) previous() map[string]any {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.last == nil {
+		return map[string]any{}
+	}
+	annotations := make(map[string]string, len(s.last.Annotations))
+	for _, a := range s.last.Annotations {
+		annotations[a.Kind] = a.Message
+	}
+	return map[string]any{
+		"offset":      s.last.Offset,
+		"batchSize":   s.last.BatchSize,
+		"limit":       s.last.Offset + s.last.BatchSize,
+		"attempts":    s.last.Attempts,
+		"exitCode":    s.last.ExitCode,
+		"success":     s.last.Success,
+		"duration":    s.last.Duration,
+		"annotations": annotations,
+		"cursor":      annotations[cursorAnnotation],
+	}
+}
+
+// report builds the report of the run so far.
+func (s *runStats) report(aborted bool) *Report {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	finished := time.Now()
+	histogram := make(map[string]int, len(s.exitCodes))
+	for code, count := range s.exitCodes {
+		histogram[strconv.Itoa(code)] = count
+	}
+	batches := slices.Clone(s.batches)
+	sort.SliceStable(batches, func(i, j int) bool {
+		return batches[i].Offset < batches[j].Offset
+	})
+	return &Report{
+		StartedAt:  s.startedAt,
+		FinishedAt: finished,
+		Duration:   finished.Sub(s.startedAt),
+		Aborted:    aborted,
+		Succeeded:  s.succeeded,
+		Failed:     s.failed,
+		Skipped:    s.skipped,
+		Attempts:   s.attempts,
+		Dropped:    s.dropped,
+		ExitCodes:  histogram,
+		Groups:     groupByLabel(batches),
+		Batches:    batches,
+	}
+}
+
+// exitCodeHistogram is a zap marshaller that prints exit codes in ascending order.
+type exitCodeHistogram map[int]int
+
+func (h exitCodeHistogram) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	codes := make([]int, 0, len(h))
+	for code := range h {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		enc.AddInt(strconv.Itoa(code), h[code])
+	}
+	return nil
+}
+
+// log writes the summary of the run.
+func (s *runStats) log(log *zap.Logger) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	log.Info(
+		"run summary",
+		zap.Int("succeeded_batches", s.succeeded),
+		zap.Int("failed_batches", s.failed),
+		zap.Int("skipped_batches", s.skipped),
+		zap.Int("attempts", s.attempts),
+		zap.Object("exit_codes", exitCodeHistogram(s.exitCodes)),
+	)
+}
+
+// groupByLabel summarizes batches per label, nil if no batch has a label.
+func groupByLabel(batches []BatchRecord) map[string]*GroupSummary {
+	var groups map[string]*GroupSummary
+	for _, b := range batches {
+		if b.Label == "" {
+			continue
+		}
+		if groups == nil {
+			groups = make(map[string]*GroupSummary)
+		}
+		g, ok := groups[b.Label]
+		if !ok {
+			g = new(GroupSummary)
+			groups[b.Label] = g
+		}
+		g.Batches++
+		g.Attempts += int(b.Attempts)
+		g.TotalDuration += b.Duration
+		g.MaxDuration = max(g.MaxDuration, b.Duration)
+		if b.Success {
+			g.Succeeded++
+		} else {
+			g.Failed++
+		}
+	}
+	return groups
+}
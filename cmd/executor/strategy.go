@@ -0,0 +1,120 @@
+package executor
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// Strategy decides the order in which planned batches are handed to the workers.
+// Implementations receive the batches in their natural order and return them in dispatch order,
+// they may reorder the given slice in place.
+type Strategy interface {
+	Arrange(batches []*ExecRequest) []*ExecRequest
+}
+
+// StrategyFunc is an adapter to allow the use of ordinary functions as a Strategy.
+type StrategyFunc func(batches []*ExecRequest) []*ExecRequest
+
+// Arrange calls f(batches).
+func (f StrategyFunc) Arrange(batches []*ExecRequest) []*ExecRequest {
+	return f(batches)
+}
+
+const DefaultStrategy = "fifo"
+
+var (
+	strategiesLock sync.RWMutex
+	strategies     = map[string]Strategy{
+		"fifo":          StrategyFunc(fifo),
+		"lifo":          StrategyFunc(lifo),
+		"shuffle":       StrategyFunc(shuffle),
+		"priority":      StrategyFunc(byPriority),
+		"weighted":      StrategyFunc(weighted),
+		"size-balanced": StrategyFunc(sizeBalanced),
+	}
+)
+
+// RegisterStrategy makes a distribution strategy available under the given name.
+// Registering an existing name replaces the previous strategy.
+func RegisterStrategy(name string, s Strategy) {
+	strategiesLock.Lock()
+	defer strategiesLock.Unlock()
+	strategies[name] = s
+}
+
+// GetStrategy returns the strategy registered under the given name.
+func GetStrategy(name string) (Strategy, error) {
+	strategiesLock.RLock()
+	defer strategiesLock.RUnlock()
+	s, ok := strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown distribution strategy: %q", name)
+	}
+	return s, nil
+}
+
+// StrategyNames returns the sorted names of the registered strategies.
+func StrategyNames() []string {
+	strategiesLock.RLock()
+	defer strategiesLock.RUnlock()
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fifo keeps the natural order.
+func fifo(batches []*ExecRequest) []*ExecRequest {
+	return batches
+}
+
+// lifo dispatches the last batch first.
+func lifo(batches []*ExecRequest) []*ExecRequest {
+	slices.Reverse(batches)
+	return batches
+}
+
+// shuffle dispatches batches in a random order.
+func shuffle(batches []*ExecRequest) []*ExecRequest {
+	rand.Shuffle(len(batches), func(i, j int) {
+		batches[i], batches[j] = batches[j], batches[i]
+	})
+	return batches
+}
+
+// byPriority dispatches batches with higher priority first, ties keep their natural order.
+func byPriority(batches []*ExecRequest) []*ExecRequest {
+	sort.SliceStable(batches, func(i, j int) bool {
+		return batches[i].Priority > batches[j].Priority
+	})
+	return batches
+}
+
+// weighted is a random order where batches with a higher priority (used as weight) tend to go first.
+// Batches with a non-positive weight are treated as weight 1.
+func weighted(batches []*ExecRequest) []*ExecRequest {
+	// Efraimidis-Spirakis: sort by u^(1/w) descending.
+	keys := make(map[*ExecRequest]float64, len(batches))
+	for _, b := range batches {
+		w := float64(max(b.Priority, 1))
+		keys[b] = math.Pow(rand.Float64(), 1/w)
+	}
+	sort.SliceStable(batches, func(i, j int) bool {
+		return keys[batches[i]] > keys[batches[j]]
+	})
+	return batches
+}
+
+// sizeBalanced dispatches the largest batches first so the run does not end waiting on a big straggler.
+func sizeBalanced(batches []*ExecRequest) []*ExecRequest {
+	sort.SliceStable(batches, func(i, j int) bool {
+		return batches[i].BatchSize > batches[j].BatchSize
+	})
+	return batches
+}
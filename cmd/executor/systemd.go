@@ -0,0 +1,50 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+const systemdRunProgram = "systemd-run"
+
+// SystemdConfig holds the settings of the systemd-run backend.
+// When enabled each batch is launched inside a transient scope unit, delegating resource accounting
+// and cgroup cleanup to systemd.
+type SystemdConfig struct {
+	Enabled    bool
+	User       bool
+	Properties []string
+}
+
+// Validate makes sure systemd-run is usable on this host when the backend is enabled.
+func (s SystemdConfig) Validate() error {
+	if !s.Enabled {
+		return nil
+	}
+	if runtime.GOOS != "linux" {
+		return errors.New("systemd-run backend is only available on linux")
+	}
+	if _, err := exec.LookPath(systemdRunProgram); err != nil {
+		return fmt.Errorf("systemd-run backend requested but %s is not available: %w", systemdRunProgram, err)
+	}
+	return nil
+}
+
+// wrap returns the program and arguments needed to run the given command inside a transient scope.
+func (s SystemdConfig) wrap(name string, program string, args []string) (string, []string) {
+	if !s.Enabled {
+		return program, args
+	}
+	wrapped := []string{"--scope", "--quiet", "--collect", "--description=executor " + name}
+	if s.User {
+		wrapped = append(wrapped, "--user")
+	}
+	for _, p := range s.Properties {
+		wrapped = append(wrapped, "--property="+p)
+	}
+	wrapped = append(wrapped, "--", program)
+	wrapped = append(wrapped, args...)
+	return systemdRunProgram, wrapped
+}
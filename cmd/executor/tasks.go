@@ -0,0 +1,95 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// task is one of the commands every batch fans out into.
+type task struct {
+	name    string
+	command string
+}
+
+// parseTasks parses the `name=template` task definitions, names must be unique and safe in file names.
+func parseTasks(raw []string) ([]task, error) {
+	tasks := make([]task, 0, len(raw))
+	seen := make(map[string]bool, len(raw))
+	for _, def := range raw {
+		name, command, ok := strings.Cut(def, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.TrimSpace(command) == "" {
+			return nil, fmt.Errorf("invalid task %q, expected name=command", def)
+		}
+		if !namePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid task name %q, only letters, digits, '.', '_' and '-' are allowed", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("task %q is defined twice", name)
+		}
+		seen[name] = true
+		tasks = append(tasks, task{name: name, command: command})
+	}
+	return tasks, nil
+}
+
+// validateTasks parses the tasks of the config, they replace the command of the batches.
+func (c *Config) validateTasks() error {
+	if len(c.Tasks) == 0 {
+		return nil
+	}
+	if c.Consume.Enabled() || c.Follow || c.Queue.Path != "" {
+		return errors.New("tasks cannot be combined with consuming messages, following the input or a queue")
+	}
+	tasks, err := parseTasks(c.Tasks)
+	if err != nil {
+		return err
+	}
+	c.tasks = tasks
+	return nil
+}
+
+// fanOut replaces every batch with one sibling batch per task, in task order. Siblings share the bounds
+// and items of the batch but run their own command, with their own retries and log.
+func (c *Config) fanOut(batches []*ExecRequest) []*ExecRequest {
+	if len(c.tasks) == 0 {
+		return batches
+	}
+	siblings := make([]*ExecRequest, 0, len(batches)*len(c.tasks))
+	for _, r := range batches {
+		for i, t := range c.tasks {
+			sibling := r
+			if i != 0 {
+				sibling = r.sibling()
+			}
+			sibling.Task = t.name
+			sibling.Command = t.command
+			siblings = append(siblings, sibling)
+		}
+	}
+	return siblings
+}
+
+// assignTask makes the batch run the task with the given name (e.g. a sibling batch handed over by another instance).
+func (e *ExecRequest) assignTask(cfg Config, name string) error {
+	for _, t := range cfg.tasks {
+		if t.name == name {
+			e.Task, e.Command = t.name, t.command
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown task %q", name)
+}
+
+// sibling copies a planned batch, the per batch state (log, output tails, annotations) is not shared.
+func (e *ExecRequest) sibling() *ExecRequest {
+	copied := *e
+	copied.BatchID = uuid.NewString()
+	copied.annotations = new(annotationSet)
+	copied.tail = e.tail.fresh()
+	copied.capture = e.capture.fresh()
+	return &copied
+}
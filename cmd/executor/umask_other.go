@@ -0,0 +1,12 @@
+//go:build !unix
+
+package executor
+
+import "errors"
+
+func applyUmask(m OctalMode) error {
+	if m.IsSet {
+		return errors.New("umask is not supported on this platform")
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build unix
+
+package executor
+
+import "syscall"
+
+// applyUmask sets the file creation mask of executor, spawned processes inherit it.
+func applyUmask(m OctalMode) error {
+	if m.IsSet {
+		syscall.Umask(int(m.Value))
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package executor
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+)
+
+// Version is the version of the executor binary, set at build time (falls back to the module version).
+var Version string
+
+// binaryVersion returns the version of the running binary, empty when it is unknown (e.g. a local build).
+func binaryVersion() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return ""
+}
+
+// majorVersion returns the major component of a semantic version (v1.4.2 and 1.4.2 both yield 1).
+func majorVersion(version string) string {
+	major, _, _ := strings.Cut(strings.TrimPrefix(version, "v"), ".")
+	return major
+}
+
+// checkVersion refuses to resume work recorded by a binary of another major version, whose scheduling may differ
+// (which offsets make up a batch, which batches are skipped), unless allowed. Unknown versions are not compared.
+func checkVersion(what, recorded string, allow bool) error {
+	current := binaryVersion()
+	if recorded == "" || current == "" || majorVersion(recorded) == majorVersion(current) {
+		return nil
+	}
+	if allow {
+		return nil
+	}
+	return fmt.Errorf(
+		"%s was written by executor %s, this is executor %s (another major version), use --allow-version-change to resume it anyway",
+		what,
+		recorded,
+		current,
+	)
+}
@@ -0,0 +1,237 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+	"go.uber.org/zap"
+)
+
+// DefaultWasmTimeout bounds every call of a WASM module.
+const DefaultWasmTimeout = 10 * time.Second
+
+// WasmConfig runs WASM scripts (WASI command modules, written in any language compiling to wasm32-wasi) on the
+// batches. A module is called with a JSON request on stdin and answers with JSON on stdout, see README.
+type WasmConfig struct {
+	// Transform is called before every attempt with the variables of the batch, it may add or override
+	// variables (seen by the templates rendered when the process is spawned) or skip the batch.
+	Transform string
+	// Retry is called after every failed attempt and decides whether (and when) the batch is retried,
+	// replacing the retry policy.
+	Retry string
+	// Timeout bounds every call of a module.
+	Timeout time.Duration
+}
+
+// Enabled tells whether a module is configured.
+func (c WasmConfig) Enabled() bool {
+	return c.Transform != "" || c.Retry != ""
+}
+
+// Validate checks that the modules exist.
+func (c WasmConfig) Validate() error {
+	if c.Timeout < 0 {
+		return errors.New("wasm timeout cannot be negative")
+	}
+	for _, path := range []string{c.Transform, c.Retry} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("wasm module not found: %w", err)
+		}
+	}
+	return nil
+}
+
+// wasmScripts holds the compiled modules of a run. A nil *wasmScripts runs nothing.
+type wasmScripts struct {
+	log       *zap.Logger
+	runtime   wazero.Runtime
+	transform wazero.CompiledModule
+	retry     wazero.CompiledModule
+	timeout   time.Duration
+}
+
+// open compiles the configured modules, nil when none is configured.
+func (c WasmConfig) open(ctx context.Context, log *zap.Logger) (*wasmScripts, error) {
+	if !c.Enabled() {
+		return nil, nil
+	}
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	wasi_snapshot_preview1.MustInstantiate(ctx, runtime)
+	w := &wasmScripts{log: log, runtime: runtime, timeout: c.Timeout}
+	if w.timeout == 0 {
+		w.timeout = DefaultWasmTimeout
+	}
+	compile := func(path string) (wazero.CompiledModule, error) {
+		if path == "" {
+			return nil, nil
+		}
+		code, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read wasm module: %w", err)
+		}
+		module, err := runtime.CompileModule(ctx, code)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile wasm module %s: %w", path, err)
+		}
+		return module, nil
+	}
+	var err error
+	if w.transform, err = compile(c.Transform); err != nil {
+		_ = runtime.Close(ctx)
+		return nil, err
+	}
+	if w.retry, err = compile(c.Retry); err != nil {
+		_ = runtime.Close(ctx)
+		return nil, err
+	}
+	return w, nil
+}
+
+// Close releases the runtime and the compiled modules.
+func (w *wasmScripts) Close() error {
+	if w == nil {
+		return nil
+	}
+	return w.runtime.Close(context.Background())
+}
+
+// apply makes the run use the modules: the transform module as the innermost middleware,
+// the retry module as the retry policy.
+func (w *wasmScripts) apply(ctx context.Context, cfg *Config) {
+	if w == nil {
+		return
+	}
+	if w.transform != nil {
+		cfg.Middlewares = append(cfg.Middlewares, w.transformMiddleware)
+	}
+	if w.retry != nil {
+		cfg.RetryPolicy = wasmRetryPolicy{ctx: ctx, scripts: w}
+	}
+}
+
+// call runs a module with the request as JSON on stdin and decodes its JSON output into response.
+func (w *wasmScripts) call(ctx context.Context, module wazero.CompiledModule, request any, response any) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	config := wazero.NewModuleConfig().
+		// anonymous, so concurrent batches can instantiate the module at the same time
+		WithName("").
+		WithStdin(bytes.NewReader(body)).
+		WithStdout(stdout).
+		WithStderr(stderr)
+	instance, err := w.runtime.InstantiateModule(ctx, module, config)
+	if instance != nil {
+		_ = instance.Close(ctx)
+	}
+	if err != nil {
+		if exit := new(sys.ExitError); errors.As(err, &exit) {
+			err = fmt.Errorf("wasm module exited with status %d", exit.ExitCode())
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	if err := json.Unmarshal(stdout.Bytes(), response); err != nil {
+		return fmt.Errorf("wasm module must write a JSON object: %w", err)
+	}
+	return nil
+}
+
+// wasmTransformRequest is the request of the transform module, the variables exclude the secrets.
+type wasmTransformRequest struct {
+	Hook string         `json:"hook"`
+	Vars map[string]any `json:"vars"`
+}
+
+type wasmTransformResponse struct {
+	// Vars are added to the variables of the batch, overriding those of executor.
+	Vars map[string]any `json:"vars"`
+	// Skip skips the batch, Reason is logged.
+	Skip   bool   `json:"skip"`
+	Reason string `json:"reason"`
+}
+
+// transformMiddleware calls the transform module before every attempt.
+func (w *wasmScripts) transformMiddleware(next ProcessFunc) ProcessFunc {
+	return func(ctx context.Context, r *ExecRequest) error {
+		r.scriptVars = nil
+		vars := r.getVarMap()
+		delete(vars, "secrets")
+		var resp wasmTransformResponse
+		if err := w.call(ctx, w.transform, wasmTransformRequest{Hook: "transform", Vars: vars}, &resp); err != nil {
+			return fmt.Errorf("wasm transform failed: %w", err)
+		}
+		if resp.Skip {
+			return fmt.Errorf("%w by the wasm transform: %s", ErrSkipBatch, resp.Reason)
+		}
+		r.scriptVars = resp.Vars
+		return next(ctx, r)
+	}
+}
+
+// wasmRetryRequest describes the failed attempt to the retry module.
+type wasmRetryRequest struct {
+	Hook    string `json:"hook"`
+	Attempt struct {
+		Number     uint   `json:"number"`
+		ExitCode   int    `json:"exitCode"`
+		Error      string `json:"error"`
+		Duration   string `json:"duration"`
+		OutputTail string `json:"outputTail"`
+	} `json:"attempt"`
+}
+
+type wasmRetryResponse struct {
+	Retry bool `json:"retry"`
+	// Delay is a Go duration (e.g. 30s), empty retries immediately.
+	Delay string `json:"delay"`
+}
+
+// wasmRetryPolicy asks the retry module, a failing module gives up on the batch.
+type wasmRetryPolicy struct {
+	ctx     context.Context
+	scripts *wasmScripts
+}
+
+func (p wasmRetryPolicy) Decide(a Attempt) RetryDecision {
+	req := wasmRetryRequest{Hook: "retry"}
+	req.Attempt.Number = a.Number
+	req.Attempt.ExitCode = a.ExitCode
+	req.Attempt.Duration = a.Duration.String()
+	req.Attempt.OutputTail = a.OutputTail
+	if a.Err != nil {
+		req.Attempt.Error = a.Err.Error()
+	}
+	var resp wasmRetryResponse
+	if err := p.scripts.call(p.ctx, p.scripts.retry, req, &resp); err != nil {
+		p.scripts.log.Error("wasm retry decision failed, the batch is not retried", zap.Error(err))
+		return RetryDecision{}
+	}
+	decision := RetryDecision{Retry: resp.Retry}
+	if resp.Delay != "" {
+		delay, err := time.ParseDuration(resp.Delay)
+		if err != nil {
+			p.scripts.log.Error("wasm retry delay is not a duration, retrying immediately", zap.String("delay", resp.Delay), zap.Error(err))
+		}
+		decision.Delay = delay
+	}
+	return decision
+}
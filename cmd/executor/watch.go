@@ -0,0 +1,257 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/FMotalleb/executor/logger"
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// WatchConfig re-triggers the run whenever a file below the watched paths changes.
+type WatchConfig struct {
+	// Paths are the files and directories watched, directories are watched recursively.
+	Paths []string
+	// Ignore are glob patterns matched against each path component (e.g. .git or *.tmp), matching paths are not watched.
+	Ignore []string
+	// Debounce is how long the file system has to stay quiet before a change triggers a run.
+	Debounce time.Duration
+	// Restart cancels the current run on a change, otherwise the run finishes and the next one starts afterwards.
+	Restart bool
+}
+
+// Validate checks the watched paths and the ignore patterns.
+func (w WatchConfig) Validate() error {
+	if len(w.Paths) == 0 {
+		return errors.New("at least one path to watch is required")
+	}
+	for _, path := range w.Paths {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("cannot watch %s: %w", path, err)
+		}
+	}
+	for _, pattern := range w.Ignore {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid ignore pattern %q: %w", pattern, err)
+		}
+	}
+	if w.Debounce < 0 {
+		return errors.New("debounce cannot be negative")
+	}
+	return nil
+}
+
+// Watch runs the configuration once and again after every (debounced) change below the watched paths,
+// until ctx is done. Failed runs are logged and do not stop the watch.
+func Watch(ctx context.Context, cfg Config, w WatchConfig) error {
+	log := logger.Get("Watch")
+	if err := errors.Join(w.Validate(), validateRepeatedState(cfg)); err != nil {
+		return err
+	}
+	// every run of a watch is identical on purpose
+	cfg.History.DuplicateWindow = 0
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start watching: %w", err)
+	}
+	defer watcher.Close()
+	filter := newWatchFilter(cfg, w.Ignore)
+	for _, path := range w.Paths {
+		if err := filter.add(watcher, path); err != nil {
+			return err
+		}
+	}
+	changes := make(chan struct{}, 1)
+	go debounceEvents(ctx, log, watcher, filter, w.Debounce, changes)
+	log.Info("watching for changes", zap.Strings("paths", w.Paths), zap.Bool("restart", w.Restart))
+
+	runner := New(WithConfig(cfg), WithLogger(logger.Get("")))
+	for {
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() {
+			_, err := runner.Run(runCtx)
+			done <- err
+		}()
+		rerun := false
+		for running := true; running; {
+			select {
+			case err := <-done:
+				if errors.Is(err, ErrInvalidConfig) {
+					cancel()
+					return err
+				}
+				if err != nil && ctx.Err() == nil && runCtx.Err() == nil {
+					log.Warn("run failed, waiting for the next change", zap.Error(err))
+				}
+				running = false
+			case <-changes:
+				rerun = true
+				if w.Restart {
+					log.Info("files changed, restarting the run")
+					cancel()
+				} else {
+					log.Info("files changed, running again once the current run finished")
+				}
+			}
+		}
+		cancel()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if !rerun {
+			select {
+			case <-changes:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		log.Info("files changed, running again")
+	}
+}
+
+// debounceEvents signals changes once no relevant event arrived for the debounce period.
+func debounceEvents(
+	ctx context.Context,
+	log *zap.Logger,
+	watcher *fsnotify.Watcher,
+	filter *watchFilter,
+	debounce time.Duration,
+	changes chan<- struct{},
+) {
+	timer := time.NewTimer(0)
+	<-timer.C
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filter.ignored(event.Name) {
+				continue
+			}
+			if event.Has(fsnotify.Create) {
+				// new directories are watched too
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := filter.add(watcher, event.Name); err != nil {
+						log.Warn("failed to watch new directory", zap.String("path", event.Name), zap.Error(err))
+					}
+				}
+			}
+			log.Debug("file changed", zap.String("path", event.Name), zap.String("op", event.Op.String()))
+			timer.Reset(debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Warn("file watcher error", zap.Error(err))
+		case <-timer.C:
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// watchFilter drops the events of ignored paths and of the files executor writes itself
+// (batch logs, per-run log directories, reports, queue and done keys), so a run never triggers the next one.
+type watchFilter struct {
+	ignore []string
+	logDir string
+	name   string
+	// owned are the files written by executor, their temporary siblings (same prefix) are owned too.
+	owned []string
+}
+
+func newWatchFilter(cfg Config, ignore []string) *watchFilter {
+	f := &watchFilter{ignore: ignore, name: cfg.Name}
+	if cfg.LogDir != "" && !cfg.LogToStdErr {
+		f.logDir = absPath(cfg.LogDir)
+	}
+	// a state journal is refused with watch (see validateRepeatedState)
+	owned := []string{cfg.Report.Path, cfg.Queue.Path}
+	if cfg.Report.Path != "" {
+		// the markdown summary is written next to the report
+		owned = append(owned, strings.TrimSuffix(cfg.Report.Path, filepath.Ext(cfg.Report.Path))+".md")
+	}
+	if cfg.DoneKey.Template != "" {
+		owned = append(owned, cfg.DoneKey.Store)
+	}
+	for _, path := range owned {
+		if path != "" && !strings.Contains(path, "://") {
+			f.owned = append(f.owned, absPath(path))
+		}
+	}
+	return f
+}
+
+// add watches path, directories are walked and every directory below them is watched.
+func (f *watchFilter) add(watcher *fsnotify.Watcher, path string) error {
+	return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != path && f.ignored(p) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && p != path {
+			return nil
+		}
+		if err := watcher.Add(p); err != nil {
+			return fmt.Errorf("cannot watch %s: %w", p, err)
+		}
+		return nil
+	})
+}
+
+// ignored tells whether a change of path must not trigger a run.
+func (f *watchFilter) ignored(path string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		for _, pattern := range f.ignore {
+			if ok, _ := filepath.Match(pattern, part); ok {
+				return true
+			}
+		}
+	}
+	path = absPath(path)
+	for _, owned := range f.owned {
+		if strings.HasPrefix(path, owned) {
+			return true
+		}
+	}
+	if f.logDir == "" {
+		return false
+	}
+	rel, err := filepath.Rel(f.logDir, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	// batch logs and health check scratch files are written into the log dir itself
+	first, _, nested := strings.Cut(filepath.ToSlash(rel), "/")
+	if !nested && (strings.HasPrefix(first, "exec-") || strings.HasPrefix(first, ".executor-")) {
+		return true
+	}
+	return (f.name != "" && first == f.name) || runIDPattern.MatchString(first)
+}
+
+// absPath returns the absolute form of path, or path itself when it cannot be resolved.
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
@@ -0,0 +1,123 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	webhookRequestTimeout = 10 * time.Second
+	// webhookBackoff is the delay before the first retry of a failed delivery, it doubles with every retry.
+	webhookBackoff = time.Second
+)
+
+// webhook POSTs every event as JSON. When a secret is configured, the body is signed with HMAC-SHA256 and the
+// signature is sent as `X-Executor-Signature: sha256=<hex>`, so the receiver can verify the sender.
+type webhook struct {
+	url     string
+	secret  []byte
+	retries int
+	client  *http.Client
+}
+
+func newWebhook(u string, secret string, retries int) *webhook {
+	return &webhook{
+		url:     u,
+		secret:  []byte(secret),
+		retries: retries,
+		client:  &http.Client{Timeout: webhookRequestTimeout},
+	}
+}
+
+func (w *webhook) name() string {
+	return "webhook " + redactURL(w.url)
+}
+
+// send delivers the event as JSON.
+func (w *webhook) send(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return w.deliver(ctx, e.Event, body)
+}
+
+// deliver POSTs the body, network errors and 5xx/429 responses are retried with an exponential backoff.
+func (w *webhook) deliver(ctx context.Context, event string, body []byte) error {
+	backoff := webhookBackoff
+	for attempt := 0; ; attempt++ {
+		retryable, err := w.post(ctx, event, body)
+		if err == nil || !retryable || attempt >= w.retries {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// post sends the body once, it tells whether a failure is worth retrying.
+func (w *webhook) post(ctx context.Context, event string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Executor-Event", event)
+	if len(w.secret) != 0 {
+		mac := hmac.New(sha256.New, w.secret)
+		mac.Write(body)
+		req.Header.Set("X-Executor-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		// the url may carry a token (e.g. Slack or Telegram), it is kept out of the error
+		if uErr := new(url.Error); errors.As(err, &uErr) {
+			err = fmt.Errorf("%s %s: %w", uErr.Op, redactURL(uErr.URL), uErr.Err)
+		}
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusBadRequest {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	retryable := resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+	return retryable, fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// validateHTTPURL checks that raw is an http(s) url.
+func validateHTTPURL(what string, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid %s url: %w", what, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%s url must be http or https, got %q", what, redactURL(raw))
+	}
+	return nil
+}
+
+// redactURL strips the credentials, path and query of a url for logging (webhook urls often embed a token).
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "<invalid url>"
+	}
+	return u.Scheme + "://" + u.Host
+}
@@ -0,0 +1,102 @@
+/*
+Copyright © 2025 Motalleb Fallahnezhad
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/FMotalleb/executor/cmd/executor"
+	"github.com/FMotalleb/executor/template"
+	"github.com/spf13/cobra"
+)
+
+// templateFlags are the flags evaluated as Go template per batch.
+var templateFlags = []string{"command", "stdin", "label", "priority", "not-before", "done-key"}
+
+var (
+	explainOffset    int64
+	explainBatchSize int64
+	explainItem      string
+	explainAll       bool
+)
+
+// explainCmd evaluates a template (or the default of a template flag) against a sample batch.
+var explainCmd = &cobra.Command{
+	Use:   "explain <flag|template>",
+	Short: "Evaluate a template against a sample batch",
+	Long: `Evaluates the given template snippet against a sample batch and prints the
+result along with the available template variables and functions.
+Given a flag name (e.g. command or --done-key) it describes the flag instead,
+template flags have their default value evaluated.`,
+	Example: `  executor explain '{{ .offset | sum .batchSize }}'
+  executor explain --item a.csv '{{ .item | toUpper }}'
+  executor explain command`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+		tmpl := args[0]
+		if flag := rootCmd.Flags().Lookup(strings.TrimPrefix(tmpl, "--")); flag != nil {
+			fmt.Fprintf(out, "--%s (%s)\n  %s\n", flag.Name, flag.Value.Type(), flag.Usage)
+			fmt.Fprintf(out, "  default: %q\n", flag.DefValue)
+			if !slices.Contains(templateFlags, flag.Name) {
+				return nil
+			}
+			tmpl = flag.DefValue
+			fmt.Fprintln(out)
+		}
+		vars := executor.SampleVars(explainOffset, explainBatchSize, explainItem)
+		result, err := template.EvaluateTemplate(tmpl, vars)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "result:\n  %s\n\n", result)
+		printVars(out, vars)
+		fmt.Fprintln(out, "\nfunctions:")
+		fmt.Fprintf(out, "  %s\n", strings.Join(template.FuncNames(explainAll), " "))
+		if !explainAll {
+			fmt.Fprintln(out, "  (and the Sprig functions, use --all to list them)")
+		}
+		return nil
+	},
+}
+
+// printVars lists the template variables of the sample batch with their values.
+func printVars(out io.Writer, vars map[string]any) {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	fmt.Fprintln(out, "variables:")
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(w, "  .%s\t%v\n", name, vars[name])
+	}
+	_ = w.Flush()
+}
+
+func init() {
+	explainCmd.Flags().Int64Var(&explainOffset, "offset", 0, "Offset of the sample batch")
+	explainCmd.Flags().Int64Var(&explainBatchSize, "batch-size", defaultBatchSize, "Size of the sample batch")
+	explainCmd.Flags().StringVar(&explainItem, "item", "", "Input item of the sample batch (.item), empty for a run without input source")
+	explainCmd.Flags().BoolVar(&explainAll, "all", false, "List the Sprig functions as well")
+	rootCmd.AddCommand(explainCmd)
+}
@@ -0,0 +1,84 @@
+/*
+Copyright © 2025 Motalleb Fallahnezhad
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/FMotalleb/executor/cmd/executor"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gapsState  string
+	gapsRanges executor.RangeList
+	gapsTasks  []string
+	gapsOutput string
+)
+
+// gapsCmd reports the offsets that were never completed according to a state journal.
+var gapsCmd = &cobra.Command{
+	Use:   "gaps",
+	Short: "Report offsets never completed by recorded runs",
+	Long: `Reads the state journal (--state) of previous runs and prints the parts of
+the given ranges that no run completed successfully, one begin:end range per
+line. The output can be fed back with --range @<file> to fill the gaps.
+With tasks, an offset is a gap until every task completed it: the tasks
+recorded in the journal and those given with --task.`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		if gapsState == "" {
+			return errors.New("--state is required")
+		}
+		if len(gapsRanges) == 0 {
+			return errors.New("at least one --range is required")
+		}
+		gaps, err := executor.FindGaps(gapsState, gapsRanges, gapsTasks)
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		if gapsOutput != "" {
+			f, err := os.Create(gapsOutput)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+		for _, r := range gaps {
+			if _, err := fmt.Fprintln(out, r.String()); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	gapsCmd.Flags().StringVar(&gapsState, "state", "", "State journal of the recorded runs")
+	gapsCmd.Flags().Var(&gapsRanges, "range", "Range of offsets to check as begin:end, repeatable")
+	gapsCmd.Flags().StringArrayVar(
+		&gapsTasks,
+		"task",
+		nil,
+		"Name of a task that must complete every offset too, repeatable (the tasks recorded in the journal are always checked)",
+	)
+	gapsCmd.Flags().StringVarP(&gapsOutput, "output", "o", "", "Write the gaps to this file instead of stdout")
+	rootCmd.AddCommand(gapsCmd)
+}
@@ -0,0 +1,57 @@
+/*
+Copyright © 2025 Motalleb Fallahnezhad
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/FMotalleb/executor/cmd/executor"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gcLogDir    string
+	gcName      string
+	gcRetention executor.RetentionPolicy
+)
+
+// gcCmd removes old run artifacts according to the retention policy.
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove old per-run artifacts",
+	Long: `Removes per-run log directories (created with --per-run-log-dir) that fall
+outside the retention policy, keeping the newest --keep-runs runs and/or
+the runs younger than --keep-days days. Directories of runs still running
+are never removed.`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		removed, err := executor.CollectGarbage(filepath.Join(gcLogDir, gcName), gcRetention)
+		for _, path := range removed {
+			fmt.Fprintln(cmd.OutOrStdout(), path)
+		}
+		return err
+	},
+}
+
+func init() {
+	gcCmd.Flags().StringVar(&gcLogDir, "log-dir", ".", "Directory holding the per-run log directories")
+	gcCmd.Flags().StringVar(&gcName, "name", "", "Name of the executor instance (--name) whose runs are collected")
+	gcCmd.Flags().IntVar(&gcRetention.KeepRuns, "keep-runs", 0, "Number of newest runs to keep, 0 disables the rule")
+	gcCmd.Flags().IntVar(&gcRetention.KeepDays, "keep-days", 0, "Remove runs older than this many days, 0 disables the rule")
+	cobra.CheckErr(gcCmd.RegisterFlagCompletionFunc("name", nameCompletion))
+	rootCmd.AddCommand(gcCmd)
+}
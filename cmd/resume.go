@@ -0,0 +1,86 @@
+/*
+Copyright © 2025 Motalleb Fallahnezhad
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/FMotalleb/executor/cmd/executor"
+	"github.com/FMotalleb/executor/queue"
+	"github.com/spf13/cobra"
+)
+
+var (
+	resumeQueue              string
+	resumeAllowVersionChange bool
+)
+
+// resumeCmd finishes the unacked batches of a queue left behind by an interrupted run.
+var resumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Run the unacked batches of an interrupted run",
+	Long: `Reads the queue (--queue) of a run that crashed or was interrupted and runs
+exactly the batches it never finished, with the flags of the original run.
+Once every batch is acknowledged the queue file is removed.`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		if resumeQueue == "" {
+			return errors.New("--queue is required")
+		}
+		q, err := queue.Open(resumeQueue)
+		if err != nil {
+			return err
+		}
+		args := q.Args()
+		pending := len(q.Pending())
+		if err := q.Close(); err != nil {
+			return err
+		}
+		if pending == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "nothing to resume")
+			return nil
+		}
+		if err := rootCmd.Flags().Parse(args); err != nil {
+			return fmt.Errorf("failed to restore the flags of the interrupted run: %w", err)
+		}
+		if err := rootCmd.PreRunE(rootCmd, nil); err != nil {
+			return err
+		}
+		if err := executor.LoadPlugins(pluginPaths); err != nil {
+			return err
+		}
+		cfg.Queue = executor.QueueConfig{
+			Path:               resumeQueue,
+			Args:               args,
+			Resume:             true,
+			AllowVersionChange: resumeAllowVersionChange,
+		}
+		cfg.State.AllowVersionChange = cfg.State.AllowVersionChange || resumeAllowVersionChange
+		return runOnce(executor.NewSystemContext())
+	},
+}
+
+func init() {
+	resumeCmd.Flags().StringVar(&resumeQueue, "queue", "", "Queue file of the interrupted run")
+	resumeCmd.Flags().BoolVar(
+		&resumeAllowVersionChange,
+		"allow-version-change",
+		false,
+		"Resume a queue (and state journal) written by another major version of executor",
+	)
+	rootCmd.AddCommand(resumeCmd)
+}
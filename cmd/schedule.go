@@ -0,0 +1,65 @@
+/*
+Copyright © 2025 Motalleb Fallahnezhad
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"errors"
+
+	"github.com/FMotalleb/executor/cmd/executor"
+	"github.com/spf13/cobra"
+)
+
+var cronCfg executor.CronConfig
+
+// scheduleCmd keeps running and launches the configured run on a cron schedule.
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Launch the batches on a cron schedule",
+	Long: `Keeps running and launches the batches configured by the usual flags whenever
+the cron expression is due. When a run is due while the previous one still runs,
+the overlap policy skips it, queues it (at most one run waits) or kills the previous run.
+Each run is recorded in the run history with the schedule as its trigger.`,
+	Example: `  executor schedule --cron '0 2 * * *' -l 10000 -c './nightly-import {{ .offset }} {{ .limit }}'
+  executor schedule --cron '@every 15m' --overlap queue --input-glob 'inbox/*.csv' -c 'load {{ .path }}'`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return rootCmd.PreRunE(cmd, args)
+	},
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if daemonCfg.Enabled() || daemonCfg.MetricsFile != "" {
+			return errors.New("--every and --metrics-file cannot be combined with a schedule")
+		}
+		return executor.Cron(executor.NewSystemContext(), cfg, cronCfg)
+	},
+}
+
+func init() {
+	// the run flags are shared with the root command, so they must be registered first (root.go is initialized before)
+	scheduleCmd.Flags().AddFlagSet(rootCmd.Flags())
+	scheduleCmd.Flags().StringVar(
+		&cronCfg.Spec,
+		"cron",
+		"",
+		"Cron expression of the runs (e.g. '0 2 * * *', '@hourly', '@every 10m', 'CRON_TZ=Europe/Berlin 0 2 * * *')",
+	)
+	scheduleCmd.Flags().StringVar(
+		&cronCfg.Overlap,
+		"overlap",
+		executor.OverlapSkip,
+		"What happens when a run is due while the previous one still runs: skip, queue or kill",
+	)
+	rootCmd.AddCommand(scheduleCmd)
+}
@@ -0,0 +1,70 @@
+/*
+Copyright © 2025 Motalleb Fallahnezhad
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"errors"
+	"time"
+
+	"github.com/FMotalleb/executor/cmd/executor"
+	"github.com/spf13/cobra"
+)
+
+var watchCfg executor.WatchConfig
+
+// watchCmd re-runs the configured batches whenever the watched files change.
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Run the batches again whenever the watched files change",
+	Long: `Runs the batches configured by the usual flags, then watches the given paths
+and runs them again once the file system stayed quiet for the debounce period.
+A change during a run triggers one more run after it, or restarts it with --restart.
+Batch logs, reports and the queue written by executor never trigger a run.
+A state journal (--state) is refused, each run would skip the batches the
+previous ones completed.`,
+	Example: `  executor watch --path ./src -l 100 -c 'make test-shard SHARD={{ .offset }}'
+  executor watch --path ./data --ignore '*.tmp' --restart --input-glob 'data/*.csv' -c 'load {{ .path }}'`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return rootCmd.PreRunE(cmd, args)
+	},
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if daemonCfg.Enabled() || daemonCfg.MetricsFile != "" {
+			return errors.New("--every and --metrics-file cannot be combined with watching")
+		}
+		return executor.Watch(executor.NewSystemContext(), cfg, watchCfg)
+	},
+}
+
+func init() {
+	// the run flags are shared with the root command, so they must be registered first (root.go is initialized before)
+	watchCmd.Flags().AddFlagSet(rootCmd.Flags())
+	watchCmd.Flags().StringArrayVar(&watchCfg.Paths, "path", nil, "File or directory (watched recursively) to watch, repeatable")
+	watchCmd.Flags().StringArrayVar(
+		&watchCfg.Ignore,
+		"ignore",
+		[]string{".git"},
+		"Glob matched against each path component, matching paths are not watched (repeatable)",
+	)
+	watchCmd.Flags().DurationVar(
+		&watchCfg.Debounce,
+		"debounce",
+		300*time.Millisecond,
+		"How long the file system has to stay quiet before a change triggers a run",
+	)
+	watchCmd.Flags().BoolVar(&watchCfg.Restart, "restart", false, "Cancel the current run on a change instead of letting it finish")
+	rootCmd.AddCommand(watchCmd)
+}
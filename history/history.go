@@ -0,0 +1,141 @@
+// Package history keeps a record of the runs started on a host, used to detect accidental duplicate runs.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const fileMode = 0o644
+
+// Entry is a single run, it is written when the run starts.
+type Entry struct {
+	RunID string `json:"run_id"`
+	Name  string `json:"name,omitempty"`
+	// ConfigHash identifies the resolved configuration (command, shell, environment, plan, ...).
+	ConfigHash string `json:"config_hash"`
+	// Range is a human readable summary of the processed offsets or input.
+	Range     string    `json:"range"`
+	StartedAt time.Time `json:"started_at"`
+	// Trigger is what launched the run (e.g. its cron schedule), empty for runs started by hand.
+	Trigger string `json:"trigger,omitempty"`
+}
+
+// pruneSize is the size from which Append drops the expired entries, so the file appended to by every run
+// (of a daemon or a schedule) stays small while it is only rewritten once in a while.
+const pruneSize = 64 << 10
+
+// Append adds the entry to the history file at path, creating it (and its directory) if needed.
+// Entries that started more than retention before the entry are dropped once the file grew past pruneSize,
+// a zero retention keeps every entry.
+func Append(path string, e Entry, retention time.Duration) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, fileMode)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	// a single write of a line is atomic enough for concurrent appends of small entries
+	_, wErr := f.Write(append(data, '\n'))
+	if err := errors.Join(wErr, f.Sync(), f.Close()); err != nil {
+		return err
+	}
+	if retention <= 0 {
+		return nil
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() < pruneSize {
+		return err
+	}
+	return prune(path, e.StartedAt.Add(-retention))
+}
+
+// prune rewrites the history without the entries that started before cutoff, if the oldest entry did.
+// The file is replaced atomically, an entry appended by another process during the rewrite may be lost.
+func prune(path string, cutoff time.Time) error {
+	entries, err := Read(path)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 || !entries[0].StartedAt.Before(cutoff) {
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to prune history: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if e.StartedAt.Before(cutoff) {
+			continue
+		}
+		if err := enc.Encode(e); err != nil {
+			_ = tmp.Close()
+			return err
+		}
+	}
+	if err := errors.Join(w.Flush(), tmp.Chmod(fileMode), tmp.Sync(), tmp.Close()); err != nil {
+		return fmt.Errorf("failed to prune history: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace history: %w", err)
+	}
+	return nil
+}
+
+// Read returns every entry of the history file at path, oldest first. A missing file has no entries,
+// lines that fail to decode (e.g. torn by a crash) are skipped.
+func Read(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	return entries, nil
+}
+
+// Recent returns the most recent entry with the given config hash that started within window before now.
+func Recent(entries []Entry, hash string, window time.Duration, now time.Time) (Entry, bool) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.ConfigHash == hash && now.Sub(e.StartedAt) <= window {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// DefaultPath returns the default history file in the user's cache directory, empty if it cannot be resolved.
+func DefaultPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "executor", "history.jsonl")
+}
@@ -0,0 +1,63 @@
+package input
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// csvRows yields one item per row of a CSV file, the header row names the columns.
+type csvRows struct {
+	reader *csv.Reader
+	closer io.Closer
+	header []string
+}
+
+// openCSV opens a CSV input and reads its header, `-` reads stdin.
+func openCSV(path string) (*csvRows, error) {
+	var r io.ReadCloser = io.NopCloser(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		r = f
+	}
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.Join(errors.New("csv input has no header row"), r.Close())
+	}
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to read csv header: %w", err), r.Close())
+	}
+	// spreadsheet exports often start with a byte order mark
+	for i, name := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+	}
+	return &csvRows{reader: reader, closer: r, header: header}, nil
+}
+
+// Next returns the next row as a map of column name to value, exposed as `.row` (and `.item`).
+func (c *csvRows) Next(ctx context.Context) (Item, error) {
+	if err := ctx.Err(); err != nil {
+		return Item{}, err
+	}
+	record, err := c.reader.Read()
+	if err != nil {
+		return Item{}, err
+	}
+	row := make(map[string]string, len(c.header))
+	for i, name := range c.header {
+		row[name] = record[i]
+	}
+	return Item{Value: row, Vars: map[string]any{"row": row}}, nil
+}
+
+func (c *csvRows) Close() error {
+	return c.closer.Close()
+}
@@ -0,0 +1,119 @@
+package input
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// globFiles yields one item per regular file matching a glob pattern, in lexical order.
+type globFiles struct {
+	paths []string
+}
+
+// openGlob enumerates the files matching pattern, `**` matches any number of directories.
+func openGlob(pattern string) (*globFiles, error) {
+	pattern = filepath.ToSlash(filepath.Clean(pattern))
+	root, rest := splitGlob(pattern)
+	segments := strings.Split(rest, "/")
+	// without `**` the walk never needs to go deeper than the pattern
+	maxDepth := len(segments)
+	if slices.Contains(segments, "**") {
+		maxDepth = -1
+	}
+	var paths []string
+	err := filepath.WalkDir(filepath.FromSlash(root), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(filepath.FromSlash(root), p)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if maxDepth >= 0 && rel != "." && strings.Count(filepath.ToSlash(rel), "/")+1 >= maxDepth {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if matchSegments(segments, strings.Split(filepath.ToSlash(rel), "/")) {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &globFiles{paths: paths}, nil
+}
+
+// splitGlob splits the pattern into the directory before the first wildcard and the remaining pattern.
+func splitGlob(pattern string) (string, string) {
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if strings.ContainsAny(segment, "*?[\\") {
+			root := strings.Join(segments[:i], "/")
+			if root == "" && strings.HasPrefix(pattern, "/") {
+				root = "/"
+			} else if root == "" {
+				root = "."
+			}
+			return root, strings.Join(segments[i:], "/")
+		}
+	}
+	// no wildcard, the pattern is a plain path
+	return path.Dir(pattern), path.Base(pattern)
+}
+
+// matchSegments matches path segments against pattern segments, `**` matches zero or more segments.
+func matchSegments(pattern []string, name []string) bool {
+	for len(pattern) != 0 {
+		if pattern[0] == "**" {
+			for skip := 0; skip <= len(name); skip++ {
+				if matchSegments(pattern[1:], name[skip:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// Next returns the next file, its path is exposed as `.item` and `.path`, along with `.basename` and `.dir`.
+func (g *globFiles) Next(ctx context.Context) (Item, error) {
+	if err := ctx.Err(); err != nil {
+		return Item{}, err
+	}
+	if len(g.paths) == 0 {
+		return Item{}, io.EOF
+	}
+	p := g.paths[0]
+	g.paths = g.paths[1:]
+	return Item{
+		Value: p,
+		Vars: map[string]any{
+			"path":     p,
+			"basename": filepath.Base(p),
+			"dir":      filepath.Dir(p),
+		},
+	}, nil
+}
+
+func (g *globFiles) Close() error {
+	return nil
+}
@@ -0,0 +1,178 @@
+package input
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const httpTimeout = 30 * time.Second
+
+// HTTPConfig describes a paginated REST endpoint used as input.
+type HTTPConfig struct {
+	// URL of the first page.
+	URL string
+	// ItemsPath is the JSONPath of the item list in each response, `$` when the response is the list.
+	ItemsPath string
+	// PageParam is the query parameter holding the page number (starting at 1), for page based pagination.
+	PageParam string
+	// CursorPath is the JSONPath of the next cursor in each response, for cursor based pagination.
+	CursorPath string
+	// CursorParam is the query parameter the cursor is sent in.
+	CursorParam string
+	// Headers are sent with every request, as `Name: value`.
+	Headers []string
+}
+
+// Validate checks the pagination settings.
+func (c HTTPConfig) Validate() error {
+	if c.URL == "" {
+		return nil
+	}
+	if _, err := url.Parse(c.URL); err != nil {
+		return fmt.Errorf("invalid http input url: %w", err)
+	}
+	if c.CursorPath != "" && c.PageParam != "" {
+		return errors.New("http input uses either page or cursor pagination, not both")
+	}
+	if (c.CursorPath == "") != (c.CursorParam == "") {
+		return errors.New("cursor pagination requires both the cursor path and the cursor parameter")
+	}
+	for _, header := range c.Headers {
+		if !strings.Contains(header, ":") {
+			return fmt.Errorf("invalid http header %q, expected Name: value", header)
+		}
+	}
+	return nil
+}
+
+// httpPages walks a paginated endpoint, yielding one item per element of each page.
+type httpPages struct {
+	cfg    HTTPConfig
+	client *http.Client
+	next   *url.URL
+	page   int
+	items  []any
+	// cursors holds the cursors already followed, a cursor seen again would loop over the same pages forever.
+	cursors map[string]bool
+}
+
+func openHTTP(cfg HTTPConfig) (*httpPages, error) {
+	first, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	h := &httpPages{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: httpTimeout},
+		next:    first,
+		page:    1,
+		cursors: make(map[string]bool),
+	}
+	if cfg.PageParam != "" {
+		h.next = withParam(first, cfg.PageParam, strconv.Itoa(h.page))
+	}
+	return h, nil
+}
+
+// Next returns the next element of the current page, fetching the next page when needed.
+func (h *httpPages) Next(ctx context.Context) (Item, error) {
+	for len(h.items) == 0 {
+		if h.next == nil {
+			return Item{}, io.EOF
+		}
+		if err := h.fetch(ctx); err != nil {
+			return Item{}, err
+		}
+	}
+	item := h.items[0]
+	h.items = h.items[1:]
+	return Item{Value: item}, nil
+}
+
+// fetch reads the current page and computes the url of the next one, nil once the last page was read.
+func (h *httpPages) fetch(ctx context.Context) error {
+	current := h.next
+	body, err := h.get(ctx, current)
+	if err != nil {
+		return err
+	}
+	raw, err := lookupPath(body, h.cfg.ItemsPath)
+	if err != nil {
+		return fmt.Errorf("failed to extract items from %s: %w", current.Redacted(), err)
+	}
+	items, ok := raw.([]any)
+	if raw != nil && !ok {
+		return fmt.Errorf("items of %s are not a list", current.Redacted())
+	}
+	h.items = items
+	h.next = nil
+	switch {
+	case h.cfg.CursorPath != "":
+		cursor, err := lookupPath(body, h.cfg.CursorPath)
+		if err != nil {
+			return fmt.Errorf("failed to extract cursor from %s: %w", current.Redacted(), err)
+		}
+		if next := fmt.Sprint(cursor); cursor != nil && next != "" {
+			if h.cursors[next] {
+				return fmt.Errorf("%s returned the cursor %q again, the pagination would never end", current.Redacted(), next)
+			}
+			h.cursors[next] = true
+			h.next = withParam(current, h.cfg.CursorParam, next)
+		}
+	case h.cfg.PageParam != "":
+		if len(items) != 0 {
+			h.page++
+			h.next = withParam(current, h.cfg.PageParam, strconv.Itoa(h.page))
+		}
+	}
+	return nil
+}
+
+func (h *httpPages) get(ctx context.Context, u *url.URL) (any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for _, header := range h.cfg.Headers {
+		name, value, _ := strings.Cut(header, ":")
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("GET %s: unexpected status %s", u.Redacted(), resp.Status)
+	}
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	var body any
+	if err := decoder.Decode(&body); err != nil {
+		return nil, fmt.Errorf("GET %s: invalid json: %w", u.Redacted(), err)
+	}
+	return body, nil
+}
+
+// withParam returns a copy of u with the query parameter set.
+func withParam(u *url.URL, name string, value string) *url.URL {
+	next := *u
+	query := next.Query()
+	query.Set(name, value)
+	next.RawQuery = query.Encode()
+	return &next
+}
+
+func (h *httpPages) Close() error {
+	h.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,141 @@
+package input
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Item is a single unit of work read from an input source.
+type Item struct {
+	// Value is exposed as `.item` in templates.
+	Value any
+	// Vars are additional template variables of the item (e.g. the columns of a row).
+	Vars map[string]any
+}
+
+// Source yields work items in order.
+type Source interface {
+	// Next returns the next item, or io.EOF once the source is exhausted.
+	Next(ctx context.Context) (Item, error)
+	// Close releases the resources held by the source.
+	Close() error
+}
+
+// Config selects the input source, at most one source can be configured.
+type Config struct {
+	// File is read line by line, each line is an item, `-` reads stdin.
+	File string
+	// Delimiter separates the items of File, DelimiterNewline (default) or DelimiterNul.
+	Delimiter string
+	// CSV is read row by row, the header row names the columns, `-` reads stdin.
+	CSV string
+	// JSONL is read line by line, each line is decoded as a JSON value, `-` reads stdin.
+	JSONL string
+	// Glob enumerates the matching files, `**` matches any number of directories.
+	Glob string
+	// SQL is a query paged through with LIMIT/OFFSET, each row is an item.
+	SQL string
+	// SQLDSN is the database the SQL query runs on (postgres://... or mysql://...).
+	SQLDSN string
+	// HTTP walks a paginated REST endpoint, each element of the pages is an item.
+	HTTP HTTPConfig
+	// Matrix axes (`name=a,b` or `name=0..9`), each combination of the axes is an item.
+	Matrix []string
+	// Plugin is a source registered by a plugin (see Register), as `name` or `name:argument`.
+	Plugin string
+	// PageSize is the number of rows fetched per query, independent of the batch size since every query
+	// skips the rows before its page. Zero uses DefaultPageSize.
+	PageSize int
+}
+
+// Enabled tells whether an input source is configured.
+func (c Config) Enabled() bool {
+	return c.File != "" || c.CSV != "" || c.JSONL != "" || c.Glob != "" || c.SQL != "" || c.HTTP.URL != "" || len(c.Matrix) != 0 ||
+		c.Plugin != ""
+}
+
+// Validate checks the input configuration.
+func (c Config) Validate() error {
+	configured := 0
+	for _, source := range []string{c.File, c.CSV, c.JSONL, c.Glob, c.SQL, c.HTTP.URL, c.Plugin} {
+		if source != "" {
+			configured++
+		}
+	}
+	if len(c.Matrix) != 0 {
+		configured++
+	}
+	if configured > 1 {
+		return errors.New("only one input source can be used at a time")
+	}
+	if c.SQL != "" && c.SQLDSN == "" {
+		return errors.New("sql input requires a dsn")
+	}
+	if c.PageSize < 0 {
+		return errors.New("page size cannot be negative")
+	}
+	if len(c.Matrix) != 0 {
+		if _, err := openMatrix(c.Matrix); err != nil {
+			return err
+		}
+	}
+	if err := c.HTTP.Validate(); err != nil {
+		return err
+	}
+	if c.Plugin != "" {
+		if _, _, err := lookupPlugin(c.Plugin); err != nil {
+			return err
+		}
+	}
+	switch c.Delimiter {
+	case "", DelimiterNewline, DelimiterNul:
+	default:
+		return fmt.Errorf("unknown input delimiter %q (expected %s or %s)", c.Delimiter, DelimiterNewline, DelimiterNul)
+	}
+	return nil
+}
+
+// Open opens the configured source.
+func (c Config) Open() (Source, error) {
+	switch {
+	case c.File != "":
+		return openLines(c.File, c.Delimiter)
+	case c.CSV != "":
+		return openCSV(c.CSV)
+	case c.JSONL != "":
+		return openJSONL(c.JSONL)
+	case c.Glob != "":
+		return openGlob(c.Glob)
+	case c.SQL != "":
+		return openSQL(c.SQLDSN, c.SQL, c.PageSize)
+	case c.HTTP.URL != "":
+		return openHTTP(c.HTTP)
+	case len(c.Matrix) != 0:
+		return openMatrix(c.Matrix)
+	case c.Plugin != "":
+		open, arg, err := lookupPlugin(c.Plugin)
+		if err != nil {
+			return nil, err
+		}
+		return open(arg)
+	default:
+		return nil, errors.New("no input source configured")
+	}
+}
+
+// ReadAll drains the source.
+func ReadAll(ctx context.Context, src Source) ([]Item, error) {
+	var items []Item
+	for {
+		item, err := src.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			return items, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read input item %d: %w", len(items), err)
+		}
+		items = append(items, item)
+	}
+}
@@ -0,0 +1,43 @@
+package input
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// jsonLines yields one item per JSON value (usually an object) of a JSON-lines file.
+type jsonLines struct {
+	lines *lines
+	index int
+}
+
+// openJSONL opens a JSON-lines input, `-` reads stdin.
+func openJSONL(path string) (*jsonLines, error) {
+	l, err := openLines(path, DelimiterNewline)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonLines{lines: l}, nil
+}
+
+// Next decodes the next line, numbers are kept as written (json.Number) so large ids are not rounded.
+func (j *jsonLines) Next(ctx context.Context) (Item, error) {
+	item, err := j.lines.Next(ctx)
+	if err != nil {
+		return Item{}, err
+	}
+	j.index++
+	decoder := json.NewDecoder(bytes.NewBufferString(item.Value.(string)))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return Item{}, fmt.Errorf("invalid json in item %d: %w", j.index, err)
+	}
+	return Item{Value: value}, nil
+}
+
+func (j *jsonLines) Close() error {
+	return j.lines.Close()
+}
@@ -0,0 +1,44 @@
+package input
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// lookupPath resolves a simple JSONPath in dot notation (`$.data.items`, `$.pages[0].next`) on a decoded JSON value.
+// A missing key resolves to nil.
+func lookupPath(value any, path string) (any, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return value, nil
+	}
+	for _, part := range strings.Split(path, ".") {
+		key, indexes, _ := strings.Cut(part, "[")
+		if key != "" {
+			object, ok := value.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("cannot read key %q of a non-object", key)
+			}
+			value = object[key]
+		}
+		if indexes == "" {
+			continue
+		}
+		for _, index := range strings.Split(strings.TrimSuffix(indexes, "]"), "][") {
+			i, err := strconv.Atoi(index)
+			if err != nil {
+				return nil, fmt.Errorf("invalid index %q in path %q", index, path)
+			}
+			list, ok := value.([]any)
+			if !ok {
+				return nil, fmt.Errorf("cannot index a non-list with %d", i)
+			}
+			if i < 0 || i >= len(list) {
+				return nil, nil
+			}
+			value = list[i]
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,85 @@
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxLineSize is the longest line accepted from a line based input.
+const maxLineSize = 16 * 1024 * 1024
+
+// Item delimiters of line based inputs.
+const (
+	// DelimiterNewline splits items on line feeds, a trailing carriage return is dropped.
+	DelimiterNewline = "newline"
+	// DelimiterNul splits items on NUL bytes (like `xargs -0`), items are taken verbatim.
+	DelimiterNul = "nul"
+)
+
+// lines yields one item per non-empty line.
+type lines struct {
+	scanner *bufio.Scanner
+	closer  io.Closer
+	nul     bool
+}
+
+// openLines opens a line based input, `-` reads stdin.
+func openLines(path string, delimiter string) (*lines, error) {
+	var r io.ReadCloser = io.NopCloser(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		r = f
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	nul := delimiter == DelimiterNul
+	if nul {
+		scanner.Split(scanNul)
+	}
+	return &lines{scanner: scanner, closer: r, nul: nul}, nil
+}
+
+func (l *lines) Next(ctx context.Context) (Item, error) {
+	for l.scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return Item{}, err
+		}
+		line := l.scanner.Text()
+		if !l.nul {
+			line = strings.TrimSuffix(line, "\r")
+		}
+		if line == "" {
+			continue
+		}
+		return Item{Value: line}, nil
+	}
+	if err := l.scanner.Err(); err != nil {
+		return Item{}, err
+	}
+	return Item{}, io.EOF
+}
+
+func (l *lines) Close() error {
+	return l.closer.Close()
+}
+
+// scanNul is a bufio.SplitFunc splitting on NUL bytes.
+func scanNul(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
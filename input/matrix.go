@@ -0,0 +1,132 @@
+package input
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxMatrixSize caps the combinations of a matrix, and so the values of a range axis.
+const maxMatrixSize = 1_000_000
+
+// axisNamePattern keeps axis names usable as template variables.
+var axisNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// reservedAxisNames are the variables of a batch, an axis named after one would shadow it in the templates.
+var reservedAxisNames = []string{
+	"offset", "batchSize", "limit", "tryCount", "maxTryCount", "prev", "secrets", "runID", "name", "batchID",
+	"task", "worker", "hostname", "tempDir", "now", "deadline", "item", "items",
+}
+
+// axis is one dimension of a matrix.
+type axis struct {
+	name   string
+	values []any
+}
+
+// parseAxis parses `name=a,b,c`, `name=[a,b,c]` or `name=0..9` (inclusive integer range).
+func parseAxis(spec string) (axis, error) {
+	name, raw, found := strings.Cut(spec, "=")
+	name = strings.TrimSpace(name)
+	if !found || !axisNamePattern.MatchString(name) {
+		return axis{}, fmt.Errorf("invalid matrix axis %q, expected name=values", spec)
+	}
+	if slices.Contains(reservedAxisNames, name) {
+		return axis{}, fmt.Errorf("matrix axis %q would shadow the batch variable of the same name", name)
+	}
+	raw = strings.TrimSpace(raw)
+	raw = strings.TrimSuffix(strings.TrimPrefix(raw, "["), "]")
+	if begin, end, isRange := strings.Cut(raw, ".."); isRange {
+		from, fErr := strconv.Atoi(strings.TrimSpace(begin))
+		to, tErr := strconv.Atoi(strings.TrimSpace(end))
+		if fErr != nil || tErr != nil || to < from {
+			return axis{}, fmt.Errorf("invalid matrix range %q, expected from..to", raw)
+		}
+		// the difference of the unsigned values is exact, to-from could overflow
+		if uint64(to)-uint64(from) >= maxMatrixSize {
+			return axis{}, fmt.Errorf("matrix range %q has more than %d values", raw, maxMatrixSize)
+		}
+		values := make([]any, 0, to-from+1)
+		for i := from; i <= to; i++ {
+			values = append(values, i)
+		}
+		return axis{name: name, values: values}, nil
+	}
+	var values []any
+	for _, value := range strings.Split(raw, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return axis{}, fmt.Errorf("matrix axis %q has no values", name)
+	}
+	return axis{name: name, values: values}, nil
+}
+
+// matrix yields one item per combination of the axes (the cartesian product), the first axis varies slowest.
+type matrix struct {
+	axes    []axis
+	indexes []int
+	done    bool
+}
+
+func openMatrix(specs []string) (*matrix, error) {
+	m := &matrix{}
+	seen := make(map[string]bool, len(specs))
+	size := 1
+	for _, spec := range specs {
+		a, err := parseAxis(spec)
+		if err != nil {
+			return nil, err
+		}
+		if seen[a.name] {
+			return nil, fmt.Errorf("duplicated matrix axis %q", a.name)
+		}
+		seen[a.name] = true
+		if size *= len(a.values); size > maxMatrixSize {
+			return nil, fmt.Errorf("matrix has more than %d combinations", maxMatrixSize)
+		}
+		m.axes = append(m.axes, a)
+	}
+	m.indexes = make([]int, len(m.axes))
+	return m, nil
+}
+
+// Next returns the next combination, each axis is exposed as a template variable (e.g. `.region`)
+// and the whole combination as `.item`.
+func (m *matrix) Next(ctx context.Context) (Item, error) {
+	if err := ctx.Err(); err != nil {
+		return Item{}, err
+	}
+	if m.done || len(m.axes) == 0 {
+		return Item{}, io.EOF
+	}
+	combination := make(map[string]any, len(m.axes))
+	for i, a := range m.axes {
+		combination[a.name] = a.values[m.indexes[i]]
+	}
+	// advance like an odometer, the last axis varies fastest
+	m.done = true
+	for i := len(m.axes) - 1; i >= 0; i-- {
+		m.indexes[i]++
+		if m.indexes[i] < len(m.axes[i].values) {
+			m.done = false
+			break
+		}
+		m.indexes[i] = 0
+	}
+	vars := make(map[string]any, len(combination))
+	for name, value := range combination {
+		vars[name] = value
+	}
+	return Item{Value: combination, Vars: vars}, nil
+}
+
+func (m *matrix) Close() error {
+	return nil
+}
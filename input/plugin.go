@@ -0,0 +1,58 @@
+package input
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Opener opens a source registered by a plugin, arg is the part of Config.Plugin after the name (may be empty).
+type Opener func(arg string) (Source, error)
+
+var (
+	pluginsLock sync.RWMutex
+	plugins     = map[string]Opener{}
+)
+
+// Register makes a source available as Config.Plugin under the given name.
+func Register(name string, open Opener) error {
+	if name == "" || strings.Contains(name, ":") {
+		return fmt.Errorf("invalid input source name %q", name)
+	}
+	pluginsLock.Lock()
+	defer pluginsLock.Unlock()
+	if _, ok := plugins[name]; ok {
+		return fmt.Errorf("input source %q is already registered", name)
+	}
+	plugins[name] = open
+	return nil
+}
+
+// Plugins returns the names of the registered sources, sorted.
+func Plugins() []string {
+	pluginsLock.RLock()
+	defer pluginsLock.RUnlock()
+	names := make([]string, 0, len(plugins))
+	for name := range plugins {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// lookupPlugin splits `name:argument` and returns the opener of the named source.
+func lookupPlugin(spec string) (Opener, string, error) {
+	name, arg, _ := strings.Cut(spec, ":")
+	pluginsLock.RLock()
+	open, ok := plugins[name]
+	pluginsLock.RUnlock()
+	if !ok {
+		registered := Plugins()
+		if len(registered) == 0 {
+			return nil, "", fmt.Errorf("unknown input source %q, no plugin registered an input source", name)
+		}
+		return nil, "", fmt.Errorf("unknown input source %q, registered sources: %s", name, strings.Join(registered, ", "))
+	}
+	return open, arg, nil
+}
@@ -2,9 +2,11 @@ package logger
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/natefinch/lumberjack"
 	"go.uber.org/zap"
@@ -14,9 +16,20 @@ type FileWriter struct {
 	name          string
 	output        io.Writer
 	hasNamePrefix bool
+	// path of the log file, empty when writing to stderr.
+	path  string
+	flush FlushPolicy
+
+	lock sync.Mutex
+	// pending is the output buffered by FlushSize.
+	pending []byte
+	syncer  fileSyncer
 }
 
-func NewFileWriter(name string, logDir string) io.Writer {
+// NewFileWriter returns a writer that appends into `<logDir>/<name>.log`.
+// A non-zero mode forces the permissions of the log file regardless of the umask,
+// the flush policy decides how often the output is written and synced to disk.
+func NewFileWriter(name string, logDir string, mode os.FileMode, flush FlushPolicy) io.Writer {
 	log := Get(name + ".ByteWriter")
 	// Configure log rotation for this process
 	logRoot := logDir
@@ -28,6 +41,11 @@ func NewFileWriter(name string, logDir string) io.Writer {
 		}
 	}
 	logFile := filepath.Join(logRoot, name+".log")
+	if mode != 0 {
+		if err := createWithMode(logFile, mode); err != nil {
+			log.Error("failed to set log file mode", zap.Error(err))
+		}
+	}
 	lumberjackLogger := &lumberjack.Logger{
 		Filename: logFile,
 	}
@@ -36,7 +54,23 @@ func NewFileWriter(name string, logDir string) io.Writer {
 		name:          name,
 		hasNamePrefix: false,
 		output:        lumberjackLogger,
+		path:          logFile,
+		flush:         flush,
+		syncer:        fileSyncer{path: logFile},
+	}
+}
+
+// createWithMode makes sure the file exists with the given permissions,
+// lumberjack keeps the mode of an existing file when it opens it.
+func createWithMode(path string, mode os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
 	}
+	return os.Chmod(path, mode)
 }
 
 func NewStdErrWriter(name string) io.Writer {
@@ -47,6 +81,37 @@ func NewStdErrWriter(name string) io.Writer {
 	}
 }
 
+// Close writes the buffered output, closes the log file and syncs it to disk (unless the flush policy never syncs),
+// closing a stderr writer is a no-op.
+func (b *FileWriter) Close() error {
+	if b.path == "" {
+		return nil
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	_, wErr := b.writePending()
+	if err := errors.Join(wErr, CloseWriter(b.output)); err != nil {
+		return errors.Join(err, b.syncer.close())
+	}
+	if !b.flush.syncsOnClose() {
+		return b.syncer.close()
+	}
+	err := b.syncer.sync()
+	if errors.Is(err, os.ErrNotExist) {
+		// nothing was ever written
+		err = nil
+	}
+	return errors.Join(err, b.syncer.close())
+}
+
+// CloseWriter closes w if it is an io.Closer.
+func CloseWriter(w io.Writer) error {
+	if c, ok := w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
 func (b *FileWriter) Write(p []byte) (n int, err error) {
 	lines := bytes.Split(p, []byte("\n"))
 	var buff []byte
@@ -60,8 +125,47 @@ func (b *FileWriter) Write(p []byte) (n int, err error) {
 		buff = append(buff, line...)
 		buff = append(buff, '\n')
 	}
-	if n, err := b.output.Write(buff); err != nil {
-		return n, err
+	if b.path == "" {
+		if n, err := b.output.Write(buff); err != nil {
+			return n, err
+		}
+		return len(p), nil
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	switch b.flush.Mode {
+	case FlushSize:
+		b.pending = append(b.pending, buff...)
+		if len(b.pending) < b.flush.Size {
+			return len(p), nil
+		}
+		if n, err := b.writePending(); err != nil {
+			return n, err
+		}
+		if err := b.syncer.sync(); err != nil {
+			return 0, err
+		}
+	case FlushLine:
+		if n, err := b.output.Write(buff); err != nil {
+			return n, err
+		}
+		if err := b.syncer.sync(); err != nil {
+			return 0, err
+		}
+	default:
+		if n, err := b.output.Write(buff); err != nil {
+			return n, err
+		}
 	}
 	return len(p), nil
 }
+
+// writePending writes the output buffered by FlushSize.
+func (b *FileWriter) writePending() (int, error) {
+	if len(b.pending) == 0 {
+		return 0, nil
+	}
+	n, err := b.output.Write(b.pending)
+	b.pending = b.pending[:0]
+	return n, err
+}
@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileWriterCloseWritesBufferedOutput(t *testing.T) {
+	dir := t.TempDir()
+	w := NewFileWriter("batch", dir, 0, FlushPolicy{Mode: FlushSize, Size: 1 << 20})
+	if _, err := io.WriteString(w, "first\nsecond"); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "batch.log")
+	if data, _ := os.ReadFile(path); len(data) != 0 {
+		t.Fatalf("output was written before the buffer filled up: %q", data)
+	}
+	if err := CloseWriter(w); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "first\nsecond\n"; got != want {
+		t.Fatalf("log file holds %q, want %q", got, want)
+	}
+}
+
+func TestFileWriterCloseWithoutOutput(t *testing.T) {
+	dir := t.TempDir()
+	w := NewFileWriter("batch", dir, 0, FlushPolicy{})
+	if err := CloseWriter(w); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "batch.log")); !os.IsNotExist(err) {
+		t.Fatalf("closing an unused writer created the log file: %v", err)
+	}
+}
+
+func TestStdErrWriterCloseIsNoop(t *testing.T) {
+	if err := CloseWriter(NewStdErrWriter("batch")); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+}
+
+func TestFileSyncerFollowsRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "batch.log")
+	if err := os.WriteFile(path, []byte("first\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := fileSyncer{path: path}
+	defer s.close()
+	if err := s.sync(); err != nil {
+		t.Fatal(err)
+	}
+	// lumberjack rotates by renaming the log and creating a new one
+	if err := os.Rename(path, filepath.Join(dir, "batch-backup.log")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("second\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.sync(); err != nil {
+		t.Fatal(err)
+	}
+	opened, err := s.file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	live, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(opened, live) {
+		t.Fatal("the syncer still syncs the rotated file instead of the live log")
+	}
+}
@@ -0,0 +1,97 @@
+package logger
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+)
+
+// EncryptedExt is the extension of encrypted log files.
+const EncryptedExt = ".log.age"
+
+// backupTimeFormat matches the naming lumberjack uses for rotated files.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// EncryptedFile is an age encrypted log file, the data is only complete once it is closed.
+// It is safe for concurrent use, stdout and stderr of a batch are written from different goroutines.
+type EncryptedFile struct {
+	// lock keeps concurrent writes from interleaving the chunks of the age stream.
+	lock sync.Mutex
+	file *os.File
+	age  io.WriteCloser
+}
+
+// NewEncryptedFile creates `<logDir>/<name>.log.age` encrypted to the given recipients.
+// An age stream cannot be appended to, an existing file is moved aside to `<name>-<timestamp>.log.age`
+// the same way lumberjack keeps rotated logs.
+// A zero mode creates the file with 0600.
+func NewEncryptedFile(name string, logDir string, mode os.FileMode, recipients []age.Recipient) (*EncryptedFile, error) {
+	if logDir == "" {
+		var err error
+		if logDir, err = os.Getwd(); err != nil {
+			return nil, err
+		}
+	}
+	path := filepath.Join(logDir, name+EncryptedExt)
+	if err := moveAside(path); err != nil {
+		return nil, err
+	}
+	if mode == 0 {
+		mode = 0o600
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		return nil, errors.Join(err, f.Close())
+	}
+	w, err := age.Encrypt(f, recipients...)
+	if err != nil {
+		return nil, errors.Join(err, f.Close())
+	}
+	return &EncryptedFile{file: f, age: w}, nil
+}
+
+// moveAside renames an existing file at path to a timestamped backup.
+func moveAside(path string) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	base := strings.TrimSuffix(path, EncryptedExt)
+	backup := base + "-" + time.Now().UTC().Format(backupTimeFormat) + EncryptedExt
+	return os.Rename(path, backup)
+}
+
+func (e *EncryptedFile) Write(p []byte) (int, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.age.Write(p)
+}
+
+// Close finalizes the age stream and syncs the file to disk.
+func (e *EncryptedFile) Close() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	aErr := e.age.Close()
+	sErr := e.file.Sync()
+	return errors.Join(aErr, sErr, e.file.Close())
+}
+
+// NewWriter returns a writer formatting output like the file writer into w,
+// closing it leaves w open so several attempts can share one stream.
+func NewWriter(name string, w io.Writer) io.Writer {
+	return &FileWriter{
+		name:          name,
+		hasNamePrefix: false,
+		output:        w,
+	}
+}
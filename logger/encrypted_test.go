@@ -0,0 +1,68 @@
+package logger
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestEncryptedFileConcurrentWrites(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	file, err := NewEncryptedFile("batch", dir, 0, []age.Recipient{identity.Recipient()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const lines = 2000
+	w := NewWriter("batch", file)
+	wg := new(sync.WaitGroup)
+	for _, stream := range []string{"stdout", "stderr"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range lines {
+				if _, err := fmt.Fprintf(w, "%s line %d\n", stream, i); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "batch"+EncryptedExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := age.Decrypt(f, identity)
+	if err != nil {
+		t.Fatalf("log is not a valid age stream: %v", err)
+	}
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		seen[scanner.Text()] = true
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("failed to decrypt the log: %v", err)
+	}
+	for _, stream := range []string{"stdout", "stderr"} {
+		for i := range lines {
+			if line := fmt.Sprintf("%s line %d", stream, i); !seen[line] {
+				t.Fatalf("line %q is missing from the decrypted log", line)
+			}
+		}
+	}
+}
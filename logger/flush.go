@@ -0,0 +1,92 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Flush modes of log files, they trade durability against the IO overhead of each write.
+const (
+	// FlushClose writes the output as it arrives and syncs the file to disk once it is closed (default).
+	FlushClose = "close"
+	// FlushLine writes and syncs the output on every write, so each line reaches the disk before the next one.
+	FlushLine = "line"
+	// FlushSize buffers the output in memory, it is written and synced every Size bytes and once the file is closed.
+	FlushSize = "size"
+	// FlushNever writes the output as it arrives and leaves syncing to the operating system.
+	FlushNever = "never"
+)
+
+// FlushPolicy decides how often a log file is written and synced to disk, the zero value is FlushClose.
+type FlushPolicy struct {
+	Mode string
+	// Size is the amount of output buffered before it is written, only used by FlushSize.
+	Size int
+}
+
+// Validate checks the mode and the buffer size.
+func (p FlushPolicy) Validate() error {
+	switch p.Mode {
+	case "", FlushClose, FlushLine, FlushNever:
+		return nil
+	case FlushSize:
+		if p.Size <= 0 {
+			return fmt.Errorf("flush size must be greater than zero")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown flush mode %q (expected %s, %s, %s or %s)", p.Mode, FlushClose, FlushLine, FlushSize, FlushNever)
+	}
+}
+
+// syncsOnClose tells whether the file is synced once it is closed.
+func (p FlushPolicy) syncsOnClose() bool {
+	return p.Mode != FlushNever
+}
+
+// fileSyncer syncs a file written through another handle (lumberjack does not expose its file),
+// the handle is opened on the first sync and kept until the writer is closed. lumberjack rotates by renaming
+// the file and creating a new one at path, the handle is then reopened so the live log is synced.
+type fileSyncer struct {
+	path string
+	file *os.File
+}
+
+func (s *fileSyncer) sync() error {
+	if s.file != nil && !s.current() {
+		// the rotated file may still hold output written since the last sync
+		err := errors.Join(s.file.Sync(), s.file.Close())
+		s.file = nil
+		if err != nil {
+			return err
+		}
+	}
+	if s.file == nil {
+		f, err := os.OpenFile(s.path, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		s.file = f
+	}
+	return s.file.Sync()
+}
+
+// current tells whether the handle still refers to the file at path, rather than to a rotated backup.
+func (s *fileSyncer) current() bool {
+	opened, err := s.file.Stat()
+	if err != nil {
+		return false
+	}
+	live, err := os.Stat(s.path)
+	return err == nil && os.SameFile(opened, live)
+}
+
+func (s *fileSyncer) close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
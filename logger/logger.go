@@ -7,7 +7,8 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
-var logger *zap.Logger
+// logger is the global logger, it discards everything until Initialize is called.
+var logger = zap.NewNop()
 
 func Get(name string) *zap.Logger {
 	return logger.Named(name)
@@ -0,0 +1,47 @@
+package logger
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// RateLimitedWriter paces writes to the underlying writer to a fixed amount of bytes per second.
+// It is safe for concurrent use, so stdout and stderr of a process may share the same budget.
+type RateLimitedWriter struct {
+	output      io.Writer
+	bytesPerSec int
+	lock        sync.Mutex
+	next        time.Time
+}
+
+// NewRateLimitedWriter wraps the writer with a limiter, a non-positive rate disables the limit.
+func NewRateLimitedWriter(w io.Writer, bytesPerSec int) io.Writer {
+	if bytesPerSec <= 0 {
+		return w
+	}
+	return &RateLimitedWriter{
+		output:      w,
+		bytesPerSec: bytesPerSec,
+	}
+}
+
+// Close closes the underlying writer.
+func (r *RateLimitedWriter) Close() error {
+	return CloseWriter(r.output)
+}
+
+// Write passes p to the underlying writer as a whole (to keep lines intact)
+// and then holds the caller back until the written amount fits in the rate.
+func (r *RateLimitedWriter) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	time.Sleep(r.next.Sub(now))
+	n, err := r.output.Write(p)
+	r.next = r.next.Add(time.Duration(n) * time.Second / time.Duration(r.bytesPerSec))
+	return n, err
+}
@@ -18,6 +18,9 @@ package main
 
 import "github.com/FMotalleb/executor/cmd"
 
+// version is set at build time (-ldflags "-X main.version=...").
+var version string
+
 func main() {
-	cmd.Execute()
+	cmd.Execute(version)
 }
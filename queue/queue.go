@@ -0,0 +1,233 @@
+// Package queue is an on-disk queue of planned batches, they are durably enqueued before the run starts and
+// acknowledged once their result is known, so an interrupted run can be resumed with exactly the unacked batches.
+package queue
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"syscall"
+
+	"github.com/FMotalleb/executor/input"
+)
+
+const fileMode = 0o600
+
+// Events recorded in the queue file.
+const (
+	// EventRun holds the arguments of the run that filled the queue.
+	EventRun = "run"
+	// EventPush enqueues a batch.
+	EventPush = "push"
+	// EventAck removes a batch from the queue.
+	EventAck = "ack"
+)
+
+// Entry is a single line of the queue file.
+type Entry struct {
+	Event string `json:"event"`
+	// Args are the command line arguments of the run, only set on run entries.
+	Args []string `json:"args,omitempty"`
+	// Version is the version of the executor binary that filled the queue, only set on run entries.
+	Version   string `json:"version,omitempty"`
+	Offset    int64  `json:"offset,omitempty"`
+	BatchSize int64  `json:"batch_size,omitempty"`
+	// Items are the work items of the batch when an input source is used.
+	Items []input.Item `json:"items,omitempty"`
+}
+
+// Queue is an append-only file of push and ack entries, every write is synced before it returns.
+type Queue struct {
+	lock    sync.Mutex
+	path    string
+	file    *os.File
+	args    []string
+	version string
+	pending []Entry
+	acked   int
+}
+
+// Open reads the queue at path (a missing file is an empty queue) and opens it for appending.
+func Open(path string) (*Queue, error) {
+	entries, err := read(path)
+	if err != nil {
+		return nil, err
+	}
+	q := &Queue{path: path}
+	acked := make(map[[2]int64]bool)
+	for _, e := range entries {
+		if e.Event == EventAck {
+			acked[[2]int64{e.Offset, e.BatchSize}] = true
+		}
+	}
+	for _, e := range entries {
+		switch e.Event {
+		case EventRun:
+			q.args = e.Args
+			q.version = e.Version
+		case EventPush:
+			if !acked[[2]int64{e.Offset, e.BatchSize}] {
+				q.pending = append(q.pending, e)
+			}
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, fileMode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open queue: %w", err)
+	}
+	q.file = f
+	return q, nil
+}
+
+// Args returns the arguments of the run that filled the queue, nil if the queue is empty.
+func (q *Queue) Args() []string {
+	return q.args
+}
+
+// Version returns the executor version of the run that filled the queue, empty if unknown.
+func (q *Queue) Version() string {
+	return q.version
+}
+
+// Pending returns the batches that were pushed but never acknowledged, in the order they were pushed.
+func (q *Queue) Pending() []Entry {
+	return q.pending
+}
+
+// Push starts the queue over with the given run arguments, executor version and batches, they are synced to disk
+// before Push returns. The previous content is replaced atomically, so a crash leaves either the old or the new queue behind.
+func (q *Queue) Push(args []string, version string, batches []Entry) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	tmp, err := os.CreateTemp(filepath.Dir(q.path), filepath.Base(q.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write queue: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(Entry{Event: EventRun, Args: args, Version: version}); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	for _, b := range batches {
+		b.Event = EventPush
+		if err := enc.Encode(b); err != nil {
+			_ = tmp.Close()
+			return err
+		}
+	}
+	if err := errors.Join(w.Flush(), tmp.Sync(), tmp.Close()); err != nil {
+		return fmt.Errorf("failed to write queue: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), q.path); err != nil {
+		return fmt.Errorf("failed to replace queue: %w", err)
+	}
+	// the renamed file replaced the one opened for appending
+	f, err := os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND, fileMode)
+	if err != nil {
+		return fmt.Errorf("failed to open queue: %w", err)
+	}
+	_ = q.file.Close()
+	q.file = f
+	q.args, q.pending, q.acked = args, batches, 0
+	return syncDir(filepath.Dir(q.path))
+}
+
+// Ack removes the batch from the queue.
+func (q *Queue) Ack(offset int64, batchSize int64) error {
+	if q == nil {
+		return nil
+	}
+	data, err := json.Marshal(Entry{Event: EventAck, Offset: offset, BatchSize: batchSize})
+	if err != nil {
+		return err
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if _, err := q.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write queue: %w", err)
+	}
+	if err := q.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync queue: %w", err)
+	}
+	q.acked++
+	return nil
+}
+
+// Close closes the queue, a queue whose batches were all acknowledged is removed.
+func (q *Queue) Close() error {
+	if q == nil {
+		return nil
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	err := q.file.Close()
+	if err == nil && q.acked >= len(q.pending) {
+		err = os.Remove(q.path)
+	}
+	return err
+}
+
+// read returns every intact entry of the queue file, a missing file has no entries.
+// An entry that fails to decode is only tolerated as the last line (an ack torn by a crash).
+func read(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open queue: %w", err)
+	}
+	defer f.Close()
+	var entries []Entry
+	reader := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		data, readErr := reader.ReadBytes('\n')
+		if len(data) != 0 {
+			var e Entry
+			if err := json.Unmarshal(data, &e); err != nil {
+				if _, peekErr := reader.Peek(1); !errors.Is(peekErr, io.EOF) {
+					return nil, fmt.Errorf("corrupted queue at line %d: %w", line, err)
+				}
+				break
+			}
+			entries = append(entries, e)
+		}
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+		if readErr != nil {
+			return nil, fmt.Errorf("failed to read queue: %w", readErr)
+		}
+	}
+	return entries, nil
+}
+
+// syncDir makes a rename in the directory durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && !dirSyncUnsupported(err) {
+		return fmt.Errorf("failed to sync directory %s: %w", dir, err)
+	}
+	return nil
+}
+
+// dirSyncUnsupported tells whether syncing a directory failed because the platform (windows) or the file
+// system does not support it, rather than because the data did not reach the disk.
+func dirSyncUnsupported(err error) bool {
+	return runtime.GOOS == "windows" ||
+		errors.Is(err, os.ErrInvalid) ||
+		errors.Is(err, syscall.EINVAL) ||
+		errors.Is(err, errors.ErrUnsupported)
+}
@@ -0,0 +1,276 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// finishedTTL is how long the keys of a drained queue are kept, so nodes that start late do not plan the run again.
+	finishedTTL = time.Hour
+	// claimTTL is how long the claim of the planning process lasts without being renewed, once it expires
+	// (e.g. the planning process crashed) another process takes over the planning.
+	claimTTL = 30 * time.Second
+)
+
+// ErrLeaseLost is returned when acknowledging a batch whose lease expired and was handed out to another process,
+// the result is discarded since the other process runs the batch again.
+var ErrLeaseLost = errors.New("lease of the batch was lost to another process")
+
+// popScript moves the first pending batch to the processing list and leases it until ARGV[1] (unix milliseconds),
+// the lease gets a fencing token (KEYS[5] is the token counter) so a stale holder can not settle it.
+var popScript = redis.NewScript(`
+local v = redis.call('LMOVE', KEYS[1], KEYS[2], 'LEFT', 'RIGHT')
+if not v then
+	return false
+end
+local token = redis.call('INCR', KEYS[5])
+redis.call('ZADD', KEYS[3], ARGV[1], v)
+redis.call('HSET', KEYS[4], v, token)
+return {v, token}
+`)
+
+// extendScript renews the leases (ARGV[2..], raw batch and token pairs) still held until ARGV[1], it returns the lost ones.
+var extendScript = redis.NewScript(`
+local lost = {}
+for i = 2, #ARGV, 2 do
+	if redis.call('HGET', KEYS[2], ARGV[i]) == ARGV[i + 1] then
+		redis.call('ZADD', KEYS[1], 'XX', ARGV[1], ARGV[i])
+	else
+		table.insert(lost, ARGV[i])
+	end
+end
+return lost
+`)
+
+// ackScript removes a batch from the processing list and drops its lease, unless the lease (token ARGV[2]) was lost.
+var ackScript = redis.NewScript(`
+if redis.call('HGET', KEYS[3], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call('LREM', KEYS[1], 1, ARGV[1])
+redis.call('ZREM', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[3], ARGV[1])
+return 1
+`)
+
+// reapScript moves the batches whose lease expired before ARGV[1] back to the pending list.
+var reapScript = redis.NewScript(`
+local expired = redis.call('ZRANGEBYSCORE', KEYS[3], '-inf', ARGV[1])
+for _, v in ipairs(expired) do
+	if redis.call('LREM', KEYS[2], 1, v) > 0 then
+		redis.call('RPUSH', KEYS[1], v)
+	end
+	redis.call('ZREM', KEYS[3], v)
+	redis.call('HDEL', KEYS[4], v)
+end
+return #expired
+`)
+
+// Lease is a batch pulled from the queue by this process, its fencing token tells it apart from later leases
+// of the same batch.
+type Lease struct {
+	raw   string
+	token string
+}
+
+// Redis is a work queue shared by independent executor processes through a Redis server.
+// The first process to arrive plans the run and pushes its batches, every process then pulls batches from the
+// pending list. If the planning process dies before the batches are pushed its claim expires and a waiting process
+// plans the run instead. A pulled batch is leased for the visibility timeout (extended while it runs), a batch
+// whose lease expires (e.g. its process crashed) is handed out again. Leases are fenced: a process that lost
+// the lease of a batch can neither renew nor acknowledge it, so a batch is only ever completed by its last holder.
+// Every lease lives in Redis, a restarted process never has to recover any state of its own.
+type Redis struct {
+	client     *redis.Client
+	visibility time.Duration
+
+	planned    string
+	ready      string
+	pending    string
+	processing string
+	leases     string
+	owners     string
+	fence      string
+}
+
+// OpenRedis connects to the server at url (redis://[user:pass@]host:port/db), every key starts with prefix.
+func OpenRedis(ctx context.Context, url string, prefix string, visibility time.Duration) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to connect to redis: %w", err), client.Close())
+	}
+	return &Redis{
+		client:     client,
+		visibility: visibility,
+		planned:    prefix + ":planned",
+		ready:      prefix + ":ready",
+		pending:    prefix + ":pending",
+		processing: prefix + ":processing",
+		leases:     prefix + ":leases",
+		owners:     prefix + ":owners",
+		fence:      prefix + ":fence",
+	}, nil
+}
+
+// Claim tells whether this process is the one planning the run, the claim expires unless it is held (see HoldClaim).
+func (q *Redis) Claim(ctx context.Context) (bool, error) {
+	return q.client.SetNX(ctx, q.planned, time.Now().UTC().Format(time.RFC3339), claimTTL).Result()
+}
+
+// HoldClaim renews the claim of the planning process until the returned function is called (or Push made it permanent).
+func (q *Redis) HoldClaim(ctx context.Context) func() {
+	ctx, stop := context.WithCancel(ctx)
+	go func() {
+		ticker := time.NewTicker(claimTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				q.client.Expire(ctx, q.planned, claimTTL)
+			}
+		}
+	}()
+	return stop
+}
+
+// Push enqueues the planned batches and marks the queue ready.
+func (q *Redis) Push(ctx context.Context, batches []Entry) error {
+	values := make([]any, 0, len(batches))
+	for _, b := range batches {
+		b.Event = EventPush
+		data, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		values = append(values, data)
+	}
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if len(values) != 0 {
+			pipe.RPush(ctx, q.pending, values...)
+		}
+		pipe.Set(ctx, q.ready, "1", 0)
+		pipe.Persist(ctx, q.planned)
+		return nil
+	})
+	return err
+}
+
+// WaitReady waits until the planning process pushed the batches. If its claim expires first (the planning process
+// died) this process claims the run and WaitReady returns true, the caller plans the run then.
+func (q *Redis) WaitReady(ctx context.Context, poll time.Duration) (bool, error) {
+	for {
+		n, err := q.client.Exists(ctx, q.ready).Result()
+		if err != nil || n != 0 {
+			return false, err
+		}
+		if claimed, err := q.Claim(ctx); err != nil || claimed {
+			return claimed, err
+		}
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(poll):
+		}
+	}
+}
+
+// Pop leases the next pending batch, it returns the lease (used to renew and ack it) and false once nothing is pending.
+func (q *Redis) Pop(ctx context.Context) (Entry, Lease, bool, error) {
+	deadline := time.Now().Add(q.visibility).UnixMilli()
+	keys := []string{q.pending, q.processing, q.leases, q.owners, q.fence}
+	result, err := popScript.Run(ctx, q.client, keys, deadline).StringSlice()
+	if errors.Is(err, redis.Nil) {
+		return Entry{}, Lease{}, false, nil
+	}
+	if err != nil {
+		return Entry{}, Lease{}, false, fmt.Errorf("failed to pop batch: %w", err)
+	}
+	lease := Lease{raw: result[0], token: result[1]}
+	var e Entry
+	if err := json.Unmarshal([]byte(lease.raw), &e); err != nil {
+		return Entry{}, lease, false, fmt.Errorf("failed to decode batch: %w", err)
+	}
+	return e, lease, true, nil
+}
+
+// Extend renews the given leases, it returns the leases that were lost (expired and handed out again) instead.
+func (q *Redis) Extend(ctx context.Context, leases []Lease) ([]Lease, error) {
+	if len(leases) == 0 {
+		return nil, nil
+	}
+	args := make([]any, 0, 1+2*len(leases))
+	args = append(args, time.Now().Add(q.visibility).UnixMilli())
+	for _, l := range leases {
+		args = append(args, l.raw, l.token)
+	}
+	lostRaws, err := extendScript.Run(ctx, q.client, []string{q.leases, q.owners}, args...).StringSlice()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	var lost []Lease
+	for _, l := range leases {
+		if slices.Contains(lostRaws, l.raw) {
+			lost = append(lost, l)
+		}
+	}
+	return lost, nil
+}
+
+// Ack removes a leased batch from the queue, it returns ErrLeaseLost if the lease was handed out to another process.
+func (q *Redis) Ack(ctx context.Context, lease Lease) error {
+	acked, err := ackScript.Run(ctx, q.client, []string{q.processing, q.leases, q.owners}, lease.raw, lease.token).Int()
+	if err != nil {
+		return err
+	}
+	if acked == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Reap hands out the batches whose lease expired again, it returns how many were requeued.
+func (q *Redis) Reap(ctx context.Context) (int, error) {
+	now := time.Now().UnixMilli()
+	return reapScript.Run(ctx, q.client, []string{q.pending, q.processing, q.leases, q.owners}, now).Int()
+}
+
+// Drained tells whether no batch is pending or being processed anymore.
+// The keys of a drained queue expire after a while, so the same run can be started again later.
+func (q *Redis) Drained(ctx context.Context) (bool, error) {
+	pipe := q.client.Pipeline()
+	pending := pipe.LLen(ctx, q.pending)
+	processing := pipe.LLen(ctx, q.processing)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	if pending.Val() != 0 || processing.Val() != 0 {
+		return false, nil
+	}
+	pipe = q.client.Pipeline()
+	for _, key := range []string{q.planned, q.ready, q.fence} {
+		pipe.Expire(ctx, key, finishedTTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return true, err
+}
+
+// Close disconnects from the server.
+func (q *Redis) Close() error {
+	if q == nil {
+		return nil
+	}
+	return q.client.Close()
+}
@@ -0,0 +1,36 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+)
+
+// Resolver resolves the secrets referenced by templates when a process is spawned, either by the name of
+// a configured secret or by a provider reference (`path#field`). Provider responses are cached.
+type Resolver struct {
+	named map[string]string
+	vault *Vault
+}
+
+// NewResolver returns a resolver over the already fetched secrets (by name) and the configured providers.
+func (c Config) NewResolver(named map[string]string) *Resolver {
+	r := &Resolver{named: named}
+	if c.Vault.Enabled() {
+		r.vault = NewVault(c.Vault)
+	}
+	return r
+}
+
+// Resolve returns the value of the secret with the given name or provider reference.
+func (r *Resolver) Resolve(ctx context.Context, name string) (string, error) {
+	if r == nil {
+		return "", fmt.Errorf("unknown secret %q, no secret provider is configured", name)
+	}
+	if value, ok := r.named[name]; ok {
+		return value, nil
+	}
+	if r.vault == nil {
+		return "", fmt.Errorf("unknown secret %q, no secret provider is configured", name)
+	}
+	return r.vault.Resolve(ctx, name)
+}
@@ -0,0 +1,62 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Config lists the secrets to fetch and the providers to fetch them from.
+// Each Ref is formatted as `NAME=reference`, the resolved value is exposed to commands as the
+// environment variable NAME and as the template variable `.secrets.NAME`.
+type Config struct {
+	Vault VaultConfig
+	Refs  []string
+}
+
+// Validate checks the references and provider settings.
+func (c Config) Validate() error {
+	if err := c.Vault.Validate(); err != nil {
+		return err
+	}
+	for _, ref := range c.Refs {
+		if _, _, err := splitRef(ref); err != nil {
+			return err
+		}
+	}
+	if len(c.Refs) != 0 && !c.Vault.Enabled() {
+		return errors.New("secrets are configured but no secret provider (vault address) is set")
+	}
+	return nil
+}
+
+// Fetch resolves every configured secret.
+func (c Config) Fetch(ctx context.Context) (map[string]string, error) {
+	if len(c.Refs) == 0 {
+		return nil, nil
+	}
+	vault := NewVault(c.Vault)
+	result := make(map[string]string, len(c.Refs))
+	for _, raw := range c.Refs {
+		name, ref, err := splitRef(raw)
+		if err != nil {
+			return nil, err
+		}
+		value, err := vault.Resolve(ctx, ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve secret %s: %w", name, err)
+		}
+		result[name] = value
+	}
+	return result, nil
+}
+
+func splitRef(raw string) (string, string, error) {
+	name, ref, found := strings.Cut(raw, "=")
+	name = strings.TrimSpace(name)
+	if !found || name == "" || ref == "" {
+		return "", "", fmt.Errorf("invalid secret %q, expected NAME=path#field", raw)
+	}
+	return name, strings.TrimSpace(ref), nil
+}
@@ -0,0 +1,170 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const vaultRequestTimeout = 30 * time.Second
+
+// VaultConfig holds the address and credentials used to read secrets from HashiCorp Vault.
+// Authentication uses Token if set, otherwise AppRole (RoleID/SecretID).
+type VaultConfig struct {
+	Address   string
+	Namespace string
+	Token     string `json:"-"`
+	RoleID    string
+	SecretID  string `json:"-"`
+	// AppRoleMount is the mount path of the AppRole auth method, defaults to approle.
+	AppRoleMount string
+}
+
+// Enabled tells whether a Vault address is configured.
+func (c VaultConfig) Enabled() bool {
+	return c.Address != ""
+}
+
+// Validate checks that some means of authentication is configured.
+func (c VaultConfig) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if c.Token == "" && c.RoleID == "" {
+		return errors.New("vault requires either a token or an approle role id")
+	}
+	return nil
+}
+
+// Vault reads secrets from the Vault HTTP API, responses are cached per path.
+type Vault struct {
+	cfg    VaultConfig
+	client *http.Client
+
+	lock  sync.Mutex
+	token string
+	cache map[string]map[string]any
+}
+
+// NewVault returns a Vault client for the given config.
+func NewVault(cfg VaultConfig) *Vault {
+	if cfg.AppRoleMount == "" {
+		cfg.AppRoleMount = "approle"
+	}
+	return &Vault{
+		cfg:    cfg,
+		client: &http.Client{Timeout: vaultRequestTimeout},
+		token:  cfg.Token,
+		cache:  make(map[string]map[string]any),
+	}
+}
+
+// Resolve reads a secret reference formatted as `path#field` (e.g. `secret/data/db#password`).
+// KV v2 responses (data nested under data) are unwrapped transparently.
+func (v *Vault) Resolve(ctx context.Context, ref string) (string, error) {
+	path, field, found := strings.Cut(ref, "#")
+	if !found || path == "" || field == "" {
+		return "", fmt.Errorf("invalid vault secret reference %q, expected path#field", ref)
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	data, ok := v.cache[path]
+	if !ok {
+		var err error
+		if data, err = v.read(ctx, path); err != nil {
+			return "", err
+		}
+		v.cache[path] = data
+	}
+	value, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("vault secret %q has no field %q", path, field)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+func (v *Vault) read(ctx context.Context, path string) (map[string]any, error) {
+	if v.token == "" {
+		if err := v.login(ctx); err != nil {
+			return nil, err
+		}
+	}
+	var resp struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := v.do(ctx, http.MethodGet, "/v1/"+strings.TrimPrefix(path, "/"), nil, &resp); err != nil {
+		return nil, fmt.Errorf("failed to read vault secret %q: %w", path, err)
+	}
+	// KV v2 wraps the secret as {"data": {"data": {...}, "metadata": {...}}}
+	if nested, ok := resp.Data["data"].(map[string]any); ok {
+		if _, hasMeta := resp.Data["metadata"]; hasMeta {
+			return nested, nil
+		}
+	}
+	return resp.Data, nil
+}
+
+func (v *Vault) login(ctx context.Context) error {
+	body, err := json.Marshal(map[string]string{
+		"role_id":   v.cfg.RoleID,
+		"secret_id": v.cfg.SecretID,
+	})
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := v.do(ctx, http.MethodPost, "/v1/auth/"+v.cfg.AppRoleMount+"/login", body, &resp); err != nil {
+		return fmt.Errorf("vault approle login failed: %w", err)
+	}
+	if resp.Auth.ClientToken == "" {
+		return errors.New("vault approle login returned no token")
+	}
+	v.token = resp.Auth.ClientToken
+	return nil
+}
+
+func (v *Vault) do(ctx context.Context, method string, path string, body []byte, out any) error {
+	url := strings.TrimSuffix(v.cfg.Address, "/") + path
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if v.token != "" {
+		req.Header.Set("X-Vault-Token", v.token)
+	}
+	if v.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.cfg.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// the body of a vault error never contains the secret, only error messages
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("vault responded %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
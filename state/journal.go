@@ -0,0 +1,241 @@
+package state
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const journalFileMode = 0o644
+
+// Events recorded in the journal.
+const (
+	// EventRun marks the beginning of a run.
+	EventRun = "run"
+	// EventStart is written (and synced) before a batch is spawned.
+	EventStart = "start"
+	// EventDone is written once a batch succeeded.
+	EventDone = "done"
+	// EventFail is written once a batch exhausted its retries.
+	EventFail = "fail"
+)
+
+// Record is a single line of the journal.
+type Record struct {
+	Event     string    `json:"event"`
+	RunID     string    `json:"run_id"`
+	Time      time.Time `json:"time"`
+	Offset    int64     `json:"offset,omitempty"`
+	BatchSize int64     `json:"batch_size,omitempty"`
+	Task      string    `json:"task,omitempty"`
+	ExitCode  int       `json:"exit_code,omitempty"`
+	// Output is the captured tail of the batch output, if enabled.
+	Output string `json:"output,omitempty"`
+	// Count is the number of results of the batch summarized by a compacted record, zero means one.
+	Count int `json:"count,omitempty"`
+	// Version is the version of the executor binary, only set on run records.
+	Version string `json:"version,omitempty"`
+}
+
+// Journal is an append-only, write-ahead log of batch state transitions stored as JSON lines.
+// Run and start records are fsynced before Append returns, so after a crash a batch is either known to be
+// completed, known to have failed, or known to have been in flight.
+// Results (done and fail records) are synced at most once per sync interval, losing one to a crash
+// only makes the batch look in flight again.
+type Journal struct {
+	lock         sync.Mutex
+	file         *os.File
+	syncInterval time.Duration
+	lastSync     time.Time
+	// flush syncs the results written since the last sync, it is pending while dirty.
+	flush *time.Timer
+	dirty bool
+	// err is the failure of a deferred sync, the deferred results may be lost so every later Append
+	// (and Close) fails with it.
+	err error
+}
+
+// Open compacts the existing journal at path (if any) and opens it for appending.
+// Compaction writes the replayed state to a temporary file and atomically renames it over the journal,
+// dropping torn records left by a crash in the middle of a write.
+// A zero syncInterval syncs every record.
+func Open(path string, syncInterval time.Duration) (*Journal, error) {
+	if err := compact(path); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, journalFileMode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state journal: %w", err)
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &Journal{file: f, syncInterval: syncInterval, lastSync: time.Now()}, nil
+}
+
+// Append writes the record and syncs it to disk, results may be synced later (see the sync interval).
+func (j *Journal) Append(r Record) error {
+	if j == nil {
+		return nil
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.err != nil {
+		return j.err
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write state journal: %w", err)
+	}
+	deferrable := r.Event == EventDone || r.Event == EventFail
+	if wait := j.syncInterval - time.Since(j.lastSync); deferrable && wait > 0 {
+		j.dirty = true
+		if j.flush == nil {
+			j.flush = time.AfterFunc(wait, j.flushPending)
+		}
+		return nil
+	}
+	return j.sync()
+}
+
+// sync flushes the journal to disk, the caller holds the lock.
+func (j *Journal) sync() error {
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync state journal: %w", err)
+	}
+	j.lastSync = time.Now()
+	j.dirty = false
+	if j.flush != nil {
+		j.flush.Stop()
+		j.flush = nil
+	}
+	return nil
+}
+
+// flushPending syncs the results deferred by the sync interval.
+func (j *Journal) flushPending() {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.flush = nil
+	if j.dirty && j.file != nil {
+		j.err = j.sync()
+	}
+}
+
+// Close syncs and closes the journal.
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	err := errors.Join(j.err, j.sync(), j.file.Close())
+	j.file = nil
+	return err
+}
+
+// readRecords reads every intact record of the journal, a missing journal has no records.
+// A record that fails to decode is only tolerated as the last line (a write torn by a crash).
+func readRecords(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state journal: %w", err)
+	}
+	defer f.Close()
+
+	var records []Record
+	reader := bufio.NewReader(f)
+	line := 0
+	for {
+		data, readErr := reader.ReadBytes('\n')
+		if len(data) != 0 {
+			line++
+			var r Record
+			if err := json.Unmarshal(data, &r); err != nil {
+				if _, peekErr := reader.Peek(1); !errors.Is(peekErr, io.EOF) {
+					return nil, fmt.Errorf("corrupted state journal at line %d: %w", line, err)
+				}
+				// torn write of the last record
+				break
+			}
+			records = append(records, r)
+		}
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+		if readErr != nil {
+			return nil, fmt.Errorf("failed to read state journal: %w", readErr)
+		}
+	}
+	return records, nil
+}
+
+// compact rewrites the journal keeping only the last record of each batch and every run record.
+func compact(path string) error {
+	records, err := readRecords(path)
+	if err != nil || records == nil {
+		return err
+	}
+	compacted := Replay(records).Records()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to compact state journal: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, r := range compacted {
+		if err := enc.Encode(r); err != nil {
+			_ = tmp.Close()
+			return err
+		}
+	}
+	if err := errors.Join(w.Flush(), tmp.Sync(), tmp.Close()); err != nil {
+		return fmt.Errorf("failed to compact state journal: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace state journal: %w", err)
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir makes a rename or file creation in the directory durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && !dirSyncUnsupported(err) {
+		return fmt.Errorf("failed to sync directory %s: %w", dir, err)
+	}
+	return nil
+}
+
+// dirSyncUnsupported tells whether syncing a directory failed because the platform (windows) or the file
+// system does not support it, rather than because the data did not reach the disk.
+func dirSyncUnsupported(err error) bool {
+	return runtime.GOOS == "windows" ||
+		errors.Is(err, os.ErrInvalid) ||
+		errors.Is(err, syscall.EINVAL) ||
+		errors.Is(err, errors.ErrUnsupported)
+}
@@ -0,0 +1,132 @@
+package state
+
+import (
+	"sort"
+)
+
+// BatchID identifies a batch by its bounds and task.
+type BatchID struct {
+	Offset    int64
+	BatchSize int64
+	// Task is the name of the task of the batch, empty for runs without tasks.
+	Task string
+}
+
+// State is the replayed content of a journal.
+type State struct {
+	// Runs holds the run records in the order they were written.
+	Runs []Record
+	// Completed holds batches whose last record is a success.
+	Completed map[BatchID]Record
+	// Failed holds batches whose last record is a failure after exhausting the retries.
+	Failed map[BatchID]Record
+	// InFlight holds batches that were started but never finished (e.g. executor crashed).
+	InFlight map[BatchID]Record
+	// results counts the recorded results (done or fail) of each batch.
+	results map[BatchID]int
+}
+
+// Load reads and replays the journal at path, a missing journal yields an empty state.
+func Load(path string) (*State, error) {
+	records, err := readRecords(path)
+	if err != nil {
+		return nil, err
+	}
+	return Replay(records), nil
+}
+
+// Replay builds the state from journal records, the last record of each batch wins.
+// A completed batch stays completed even if a later run started it again and crashed.
+func Replay(records []Record) *State {
+	s := &State{
+		Completed: make(map[BatchID]Record),
+		Failed:    make(map[BatchID]Record),
+		InFlight:  make(map[BatchID]Record),
+		results:   make(map[BatchID]int),
+	}
+	for _, r := range records {
+		id := BatchID{Offset: r.Offset, BatchSize: r.BatchSize, Task: r.Task}
+		switch r.Event {
+		case EventRun:
+			s.Runs = append(s.Runs, r)
+		case EventStart:
+			// only compacted records of batches with earlier results carry a count
+			s.results[id] += r.Count
+			if _, done := s.Completed[id]; done {
+				continue
+			}
+			delete(s.Failed, id)
+			s.InFlight[id] = r
+		case EventDone:
+			s.results[id] += max(r.Count, 1)
+			delete(s.InFlight, id)
+			delete(s.Failed, id)
+			s.Completed[id] = r
+		case EventFail:
+			s.results[id] += max(r.Count, 1)
+			delete(s.InFlight, id)
+			if _, done := s.Completed[id]; !done {
+				s.Failed[id] = r
+			}
+		}
+	}
+	return s
+}
+
+// Records returns the compacted records of the state: runs first, then batches ordered by offset.
+func (s *State) Records() []Record {
+	records := append([]Record{}, s.Runs...)
+	var batches []Record
+	for _, group := range []map[BatchID]Record{s.Completed, s.Failed, s.InFlight} {
+		for id, r := range group {
+			if count := s.results[id]; count > 1 {
+				r.Count = count
+			}
+			batches = append(batches, r)
+		}
+	}
+	sort.SliceStable(batches, func(i, j int) bool {
+		if batches[i].Offset != batches[j].Offset {
+			return batches[i].Offset < batches[j].Offset
+		}
+		if batches[i].BatchSize != batches[j].BatchSize {
+			return batches[i].BatchSize < batches[j].BatchSize
+		}
+		return batches[i].Task < batches[j].Task
+	})
+	return append(records, batches...)
+}
+
+// Version returns the executor version of the last run recorded in the journal with a version, empty if unknown.
+// Runs recorded without a version (e.g. by older executors) are skipped.
+func (s *State) Version() string {
+	for i := len(s.Runs) - 1; i >= 0; i-- {
+		if s.Runs[i].Version != "" {
+			return s.Runs[i].Version
+		}
+	}
+	return ""
+}
+
+// LastSuccessful returns the most recently completed batch.
+func (s *State) LastSuccessful() (Record, bool) {
+	var last Record
+	found := false
+	for _, r := range s.Completed {
+		if !found || r.Time.After(last.Time) {
+			last, found = r, true
+		}
+	}
+	return last, found
+}
+
+// ResultCount returns how many times a batch starting at offset finished (successfully or not) across all runs.
+func (s *State) ResultCount(offset int64) int {
+	count := 0
+	for id, n := range s.results {
+		if id.Offset == offset {
+			count += n
+		}
+	}
+	return count
+}
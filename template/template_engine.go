@@ -5,27 +5,63 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+)
+
+var (
+	registeredLock  sync.RWMutex
+	registeredFuncs = template.FuncMap{}
 )
 
+// RegisterFuncs makes the given functions available to every template evaluated afterwards,
+// registered functions take precedence over the built-in ones.
+func RegisterFuncs(funcs template.FuncMap) {
+	registeredLock.Lock()
+	defer registeredLock.Unlock()
+	for name, fn := range funcs {
+		registeredFuncs[name] = fn
+	}
+}
+
+// buildFuncMap returns the Sprig function set overlaid with executor's own helpers,
+// which take precedence where names collide (e.g. `join` keeps the `join list sep` order),
+// and the registered functions on top.
 func buildFuncMap() template.FuncMap {
+	result := sprig.TxtFuncMap()
+	for name, fn := range builtinFuncs() {
+		result[name] = fn
+	}
+	registeredLock.RLock()
+	defer registeredLock.RUnlock()
+	for name, fn := range registeredFuncs {
+		result[name] = fn
+	}
+	return result
+}
+
+func builtinFuncs() template.FuncMap {
 	result := template.FuncMap{
-		"env": os.Getenv,
+		"env": env,
 		"b64enc": func(s string) string {
 			return base64.StdEncoding.EncodeToString([]byte(s))
 		},
-		"sum": func(a int, b int) int {
-			return a + b
+		"sum": func(a any, b any) int64 {
+			return toInt64(a) + toInt64(b)
 		},
 		"b64dec":    b64dec,
 		"toUpper":   strings.ToUpper,
 		"toLower":   strings.ToLower,
 		"trim":      strings.TrimSpace,
-		"join":      strings.Join,
+		"join":      join,
 		"replace":   strings.ReplaceAll,
 		"hasPrefix": strings.HasPrefix,
 		"hasSuffix": strings.HasSuffix,
@@ -36,15 +72,31 @@ func buildFuncMap() template.FuncMap {
 		"toInt":     toInt,
 		"atoi":      strconv.Atoi,
 		"atob":      atob,
+		"file":      readFile,
+		"fileLines": readFileLines,
+		"pad":       pad,
+		"toHex":     toHex,
+		"toBase":    toBase,
+		"fromBase":  fromBase,
+		"secret":    secretPlaceholder,
 	}
 
 	return result
 }
 
 func EvaluateTemplate(text string, vars any) (string, error) {
+	return EvaluateTemplateWith(text, vars, nil)
+}
+
+// EvaluateTemplateWith evaluates the template with extra functions, they take precedence over every other function.
+func EvaluateTemplateWith(text string, vars any, funcs template.FuncMap) (string, error) {
 	templateObj := template.New("template")
 
-	templateObj = templateObj.Funcs(buildFuncMap())
+	funcMap := buildFuncMap()
+	for name, fn := range funcs {
+		funcMap[name] = fn
+	}
+	templateObj = templateObj.Funcs(funcMap)
 
 	templateObj, err := templateObj.Parse(text)
 	if err != nil {
@@ -59,6 +111,90 @@ func EvaluateTemplate(text string, vars any) (string, error) {
 	return output.String(), nil
 }
 
+// env returns the value of an environment variable of executor,
+// the optional default is returned when the variable is unset or empty.
+func env(name string, fallback ...string) (string, error) {
+	if len(fallback) > 1 {
+		return "", fmt.Errorf("env expects at most one default value, got %d", len(fallback))
+	}
+	if value := os.Getenv(name); value != "" || len(fallback) == 0 {
+		return value, nil
+	}
+	return fallback[0], nil
+}
+
+// secretPlaceholder stands in for `secret "name"` wherever no process is spawned (e.g. explain or labels),
+// the value of a secret is only resolved while the command of a batch is rendered.
+func secretPlaceholder(name string) string {
+	return "<secret " + name + ">"
+}
+
+// readFile returns the content of the file at path (relative to executor's working directory).
+func readFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// readFileLines returns the lines of the file at path without their line endings,
+// a trailing newline does not produce an empty last line.
+func readFileLines(path string) ([]string, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data = strings.TrimSuffix(strings.ReplaceAll(data, "\r\n", "\n"), "\n")
+	if data == "" {
+		return []string{}, nil
+	}
+	return strings.Split(data, "\n"), nil
+}
+
+// join concatenates the elements of any list (formatted with fmt.Sprint) using sep.
+func join(list any, sep string) (string, error) {
+	if strs, ok := list.([]string); ok {
+		return strings.Join(strs, sep), nil
+	}
+	value := reflect.ValueOf(list)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return "", fmt.Errorf("join expects a list, got %T", list)
+	}
+	parts := make([]string, value.Len())
+	for i := range parts {
+		parts[i] = fmt.Sprint(value.Index(i).Interface())
+	}
+	return strings.Join(parts, sep), nil
+}
+
+// pad renders an integer zero-padded to width digits, e.g. `pad 8 .offset` renders 00001000.
+func pad(width int, v any) string {
+	n := toInt64(v)
+	if n < 0 {
+		return "-" + fmt.Sprintf("%0*d", width-1, -n)
+	}
+	return fmt.Sprintf("%0*d", width, n)
+}
+
+// toHex renders an integer in lowercase hexadecimal.
+func toHex(v any) string {
+	return strconv.FormatInt(toInt64(v), 16)
+}
+
+// toBase renders an integer in the given base (2 to 36).
+func toBase(base int, v any) (string, error) {
+	if base < 2 || base > 36 {
+		return "", fmt.Errorf("base must be between 2 and 36, got %d", base)
+	}
+	return strconv.FormatInt(toInt64(v), base), nil
+}
+
+// fromBase parses an integer written in the given base (2 to 36).
+func fromBase(base int, s string) (int64, error) {
+	return strconv.ParseInt(strings.TrimSpace(s), base, 64)
+}
+
 func toJSON(v any) string {
 	data, err := json.Marshal(v)
 	if err != nil {
@@ -123,3 +259,54 @@ func toInt(v interface{}) int {
 		panic(fmt.Errorf("unsupported type: %T", val))
 	}
 }
+
+// toInt64 is the 64 bit variant of toInt, offsets are int64 so they do not overflow on 32 bit platforms.
+func toInt64(v interface{}) int64 {
+	switch val := v.(type) {
+	case int64:
+		return val
+	case int, int8, int16, int32:
+		return reflect.ValueOf(val).Int()
+	case uint, uint8, uint16, uint32, uint64:
+		uval := reflect.ValueOf(val).Uint()
+		if uval > math.MaxInt64 {
+			panic(fmt.Errorf("integer overflow: value %d exceeds int64 range", uval))
+		}
+		return int64(uval)
+	case float32:
+		return int64(val)
+	case float64:
+		return int64(val)
+	case string:
+		if i, err := strconv.ParseInt(val, 10, 64); err == nil {
+			return i
+		}
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return int64(f)
+		}
+		panic(fmt.Errorf("cannot convert string to int64: %s", val))
+	default:
+		panic(fmt.Errorf("unsupported type: %T", val))
+	}
+}
+
+// FuncNames returns the sorted names of executor's own and the registered template functions,
+// with sprig set the Sprig functions are included as well.
+func FuncNames(sprigFuncs bool) []string {
+	funcs := builtinFuncs()
+	if sprigFuncs {
+		funcs = buildFuncMap()
+	} else {
+		registeredLock.RLock()
+		for name, fn := range registeredFuncs {
+			funcs[name] = fn
+		}
+		registeredLock.RUnlock()
+	}
+	names := make([]string, 0, len(funcs))
+	for name := range funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}